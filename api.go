@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -16,6 +15,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,6 +29,14 @@ type APIServer struct {
 	onLog     func(CmdLog)
 	healthFn  func() HealthResp
 	connectFn func(string) error
+
+	tunnels    map[int]*tunnelForward
+	nextTunnel int
+
+	idempotency idempotencyCache
+
+	apiToken    string
+	permissions []string
 }
 
 type CmdLog struct {
@@ -47,18 +55,37 @@ type HealthResp struct {
 	GUIPort   int    `json:"gui_port,omitempty"`
 	Error     string `json:"error,omitempty"`
 	ErrorCode string `json:"error_code,omitempty"`
+	SocksPort int    `json:"socks_port,omitempty"`
+	// ExposedSubnets lists receiver LAN subnets reachable through it.
+	ExposedSubnets []string `json:"exposed_subnets,omitempty"`
+	// TokenRequired and Permissions describe the pairing code's access
+	// rules; /health itself stays open so callers can discover them.
+	TokenRequired bool     `json:"token_required,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
 }
 
 type ExecReq struct {
-	Cmd        string `json:"cmd"`
-	Cwd        string `json:"cwd,omitempty"`
-	TimeoutSec int    `json:"timeout_sec,omitempty"`
+	Cmd            string            `json:"cmd,omitempty"`
+	Args           []string          `json:"args,omitempty"`
+	Shell          string            `json:"shell,omitempty"`
+	Cwd            string            `json:"cwd,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Stdin          string            `json:"stdin,omitempty"`
+	TimeoutSec     int               `json:"timeout_sec,omitempty"`
+	MaxOutputBytes int               `json:"max_output_bytes,omitempty"`
+	RunAs          string            `json:"run_as,omitempty"`
 }
 
 type ExecResp struct {
-	Stdout string `json:"stdout"`
-	Stderr string `json:"stderr"`
-	Code   int    `json:"code"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	Code            int    `json:"code"`
+	StdoutTruncated bool   `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool   `json:"stderr_truncated,omitempty"`
+	DurationMs      int64  `json:"duration_ms"`
+	Signal          string `json:"signal,omitempty"`
+	KilledChildren  int    `json:"killed_children"`
+	RunAs           string `json:"run_as,omitempty"`
 }
 
 type ConnectReq struct {
@@ -66,19 +93,29 @@ type ConnectReq struct {
 }
 
 type ReadReq struct {
-	Path   string `json:"path"`
-	Offset int    `json:"offset,omitempty"`
-	Limit  int    `json:"limit,omitempty"`
+	Path       string `json:"path"`
+	Offset     int    `json:"offset,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	Tail       int    `json:"tail,omitempty"`
+	ByteOffset *int64 `json:"byte_offset,omitempty"`
+	ByteLimit  int    `json:"byte_limit,omitempty"`
+	MaxBytes   int    `json:"max_bytes,omitempty"`
 }
 
 type ReadResp struct {
 	Content    string `json:"content"`
 	TotalLines int    `json:"total_lines"`
+	ByteOffset int64  `json:"byte_offset"`
+	Bytes      int64  `json:"bytes"`
+	TotalBytes int64  `json:"total_bytes"`
+	EOF        bool   `json:"eof"`
+	Truncated  bool   `json:"truncated,omitempty"`
 }
 
 type WriteReq struct {
 	Path    string `json:"path"`
 	Content string `json:"content"`
+	RunAs   string `json:"run_as,omitempty"`
 }
 
 type EditReq struct {
@@ -86,6 +123,7 @@ type EditReq struct {
 	StartLine int    `json:"start_line"`
 	EndLine   int    `json:"end_line"`
 	Content   string `json:"content"`
+	RunAs     string `json:"run_as,omitempty"`
 }
 
 type PatchReq struct {
@@ -93,6 +131,7 @@ type PatchReq struct {
 	Old        string `json:"old"`
 	New        string `json:"new"`
 	ReplaceAll bool   `json:"replace_all,omitempty"`
+	RunAs      string `json:"run_as,omitempty"`
 }
 
 type PatchResp struct {
@@ -119,6 +158,7 @@ type UploadReq struct {
 	Path   string `json:"path"`
 	Data   string `json:"data"`
 	Append bool   `json:"append,omitempty"`
+	RunAs  string `json:"run_as,omitempty"`
 }
 
 type UploadResp struct {
@@ -140,6 +180,12 @@ type DownloadResp struct {
 	EOF       bool   `json:"eof"`
 }
 
+const (
+	apiVersionHeader = "X-Telehand-Api"
+	apiV1            = "1"
+	apiV2            = "2"
+)
+
 func NewAPIServer(bindIP string, startPort int, onLog func(CmdLog), healthFn func() HealthResp, connectFn func(string) error) *APIServer {
 	s := &APIServer{
 		bindIP:    bindIP,
@@ -149,16 +195,33 @@ func NewAPIServer(bindIP string, startPort int, onLog func(CmdLog), healthFn fun
 		connectFn: connectFn,
 	}
 	s.mux = http.NewServeMux()
-	s.mux.HandleFunc("/health", s.handleHealth)
-	s.mux.HandleFunc("/connect", s.wrap(s.handleConnect))
-	s.mux.HandleFunc("/exec", s.wrap(s.handleExec))
-	s.mux.HandleFunc("/read", s.wrap(s.handleRead))
-	s.mux.HandleFunc("/write", s.wrap(s.handleWrite))
-	s.mux.HandleFunc("/edit", s.wrap(s.handleEdit))
-	s.mux.HandleFunc("/patch", s.wrap(s.handlePatch))
-	s.mux.HandleFunc("/ls", s.wrap(s.handleLs))
-	s.mux.HandleFunc("/upload", s.wrap(s.handleUpload))
-	s.mux.HandleFunc("/download", s.wrap(s.handleDownload))
+	s.mux.HandleFunc("/health", s.versioned(apiV1, s.handleHealth))
+	s.mux.HandleFunc("/v1/health", s.versioned(apiV1, s.handleHealth))
+	s.mux.HandleFunc("/v2/health", s.versioned(apiV2, s.handleHealth))
+	s.route("/connect", s.handleConnect)
+	s.route("/exec", s.handleExec)
+	s.route("/read", s.handleRead)
+	s.route("/write", s.handleWrite)
+	s.route("/edit", s.handleEdit)
+	s.route("/patch", s.handlePatch)
+	s.route("/ls", s.handleLs)
+	s.route("/upload", s.handleUpload)
+	s.route("/download", s.handleDownload)
+	s.route("/sync/manifest", s.handleSyncManifest)
+	s.route("/sync/put", s.handleSyncPut)
+	s.route("/sync/delete", s.handleSyncDelete)
+	s.route("/archive", s.handleArchive)
+	s.route("/extract", s.handleExtract)
+	s.route("/watch", s.handleWatch)
+	s.route("/ps", s.handlePs)
+	s.route("/proc/inspect", s.handleProcInspect)
+	s.route("/proc/signal", s.handleProcSignal)
+	s.route("/sysinfo", s.handleSysInfo)
+	s.route("/tunnel", s.handleTunnel)
+	s.route("/batch", s.handleBatch)
+	s.mux.HandleFunc("/v2/", s.versioned(apiV2, func(w http.ResponseWriter, r *http.Request) {
+		jsonErrWithCode(w, "unknown path "+r.URL.Path, ErrorCodeNotFound, http.StatusNotFound)
+	}))
 	return s
 }
 
@@ -208,45 +271,112 @@ func (s *APIServer) addLog(method, path, summary string) {
 	}
 }
 
-func (s *APIServer) wrap(handler func(http.ResponseWriter, *http.Request)) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+// route registers a POST handler under its legacy path, /v1 and /v2.
+// Legacy and /v1 keep the historical statuses (e.g. 200 for a missing
+// file on /read); /v2 derives the status from error_code via apiV2Status.
+func (s *APIServer) route(path string, handler func(http.ResponseWriter, *http.Request)) {
+	if idempotentRoutes[path] {
+		handler = s.idempotent(path, handler)
+	}
+	// Access checks run first so a denied call never reaches the
+	// idempotency cache.
+	handler = s.authorized(path, handler)
+	s.mux.HandleFunc(path, s.wrap(apiV1, handler))
+	s.mux.HandleFunc("/v1"+path, s.wrap(apiV1, handler))
+	s.mux.HandleFunc("/v2"+path, s.wrap(apiV2, handler))
+}
+
+// versioned tags every response with its API version (read by
+// jsonErrWithCode to pick the status), a request ID and Server-Timing.
+func (s *APIServer) versioned(version string, handler func(http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		w := &timingWriter{ResponseWriter: rw, start: time.Now()}
+		w.Header().Set(requestIDHeader, newRequestID(r))
+		w.Header().Set(apiVersionHeader, version)
+		if version == apiV2 {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		handler(w, r)
+	}
+}
+
+func (s *APIServer) wrap(version string, handler func(http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return s.versioned(version, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		handler(w, r)
+	})
+}
+
+// methodNotAllowed keeps the plain-text reply on legacy routes.
+func methodNotAllowed(w http.ResponseWriter) {
+	if isAPIv2(w) {
+		jsonErrWithCode(w, "method not allowed", ErrorCodeMethodNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+func isAPIv2(w http.ResponseWriter) bool {
+	return w.Header().Get(apiVersionHeader) == apiV2
+}
+
+// apiVersionPrefix returns "/v1" or "/v2" when path is versioned.
+func apiVersionPrefix(path string) string {
+	for _, prefix := range []string{"/v1", "/v2"} {
+		if strings.HasPrefix(path, prefix+"/") {
+			return prefix
+		}
 	}
+	return ""
 }
 
 func (s *APIServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	if s.healthFn != nil {
-		json.NewEncoder(w).Encode(s.healthFn())
-		return
-	}
-	json.NewEncoder(w).Encode(HealthResp{
+	resp := HealthResp{
 		Status:  "ok",
 		Phase:   "unknown",
 		APIPort: s.Port(),
-	})
+	}
+	if s.healthFn != nil {
+		resp = s.healthFn()
+	}
+	token, permissions := s.access()
+	resp.TokenRequired = token != ""
+	resp.Permissions = permissions
+	json.NewEncoder(w).Encode(resp)
 }
 
 func jsonErr(w http.ResponseWriter, msg string, code int) {
 	jsonErrWithCode(w, msg, "", code)
 }
 
+// apiErr reports err with an error_code derived from it (see apiErrorCode).
+func apiErr(w http.ResponseWriter, err error, code int) {
+	jsonErrWithCode(w, err.Error(), apiErrorCode(err), code)
+}
+
+// jsonErrWithCode writes the error body. Every error carries error_code,
+// falling back to one implied by code; /v2 routes also replace code with
+// the taxonomy status.
 func jsonErrWithCode(w http.ResponseWriter, msg string, errCode string, code int) {
-	w.WriteHeader(code)
-	resp := map[string]string{"error": msg}
-	if errCode != "" {
-		resp["error_code"] = errCode
+	if errCode == "" {
+		errCode = errorCodeForStatus(code)
 	}
-	json.NewEncoder(w).Encode(resp)
+	if isAPIv2(w) {
+		if status, ok := apiV2Status[errCode]; ok {
+			code = status
+		}
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg, "error_code": errCode})
 }
 
 func (s *APIServer) handleExec(w http.ResponseWriter, r *http.Request) {
@@ -255,10 +385,30 @@ func (s *APIServer) handleExec(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "invalid request body", 400)
 		return
 	}
-	if req.Cmd == "" {
-		jsonErr(w, "cmd is required", 400)
+	argv, err := resolveExecCommand(req)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+	for k := range req.Env {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			jsonErr(w, fmt.Sprintf("invalid env name: %q", k), 400)
+			return
+		}
+	}
+	id, err := resolveRunAs(req.RunAs)
+	if err != nil {
+		apiErr(w, err, 400)
 		return
 	}
+	env := id.env()
+	if env == nil {
+		env = req.Env
+	} else {
+		for k, v := range req.Env {
+			env[k] = v
+		}
+	}
 	timeout := req.TimeoutSec
 	if timeout <= 0 {
 		timeout = 30
@@ -269,18 +419,46 @@ func (s *APIServer) handleExec(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	shell, flag := getShell()
-	cmd := exec.CommandContext(ctx, shell, flag, req.Cmd)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	if req.Cwd != "" {
 		cmd.Dir = req.Cwd
+	} else if id != nil {
+		if st, err := os.Stat(id.Home); err == nil && st.IsDir() {
+			cmd.Dir = id.Home
+		}
+	}
+	cmd.Env = mergeExecEnv(os.Environ(), env)
+	applyRunAs(cmd, id)
+	if req.Stdin != "" {
+		cmd.Stdin = strings.NewReader(req.Stdin)
 	}
 
-	var stdout, stderr strings.Builder
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	maxOutput := normalizeExecMaxOutput(req.MaxOutputBytes)
+	stdout := &cappedBuffer{max: maxOutput}
+	stderr := &cappedBuffer{max: maxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// On timeout or client disconnect the whole tree goes, not just the
+	// shell; WaitDelay stops escaped children holding the pipes open.
+	tree := newProcessTree(cmd)
+	var killed atomic.Int64
+	cmd.Cancel = func() error {
+		killed.Store(int64(tree.kill()))
+		return nil
+	}
+	cmd.WaitDelay = execWaitDelay
 
-	err := cmd.Run()
+	started := time.Now()
+	err = cmd.Start()
+	if err == nil {
+		tree.started()
+		err = cmd.Wait()
+	}
+	tree.close()
+	duration := time.Since(started)
 	code := 0
+	signal, signum := exitSignal(cmd.ProcessState)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			if stderr.Len() > 0 && !strings.HasSuffix(stderr.String(), "\n") {
@@ -288,26 +466,42 @@ func (s *APIServer) handleExec(w http.ResponseWriter, r *http.Request) {
 			}
 			stderr.WriteString(fmt.Sprintf("command timed out after %ds", timeout))
 			code = 124
+		} else if signal != "" {
+			// Match the shell convention for signal deaths.
+			code = 128 + signum
 		} else if exitErr, ok := err.(*exec.ExitError); ok {
 			code = exitErr.ExitCode()
 		} else {
 			code = -1
+			if stderr.Len() == 0 {
+				stderr.WriteString(err.Error())
+			}
 		}
 	} else {
 		code = 0
 	}
 
-	s.addLog("POST", "/exec", truncate(req.Cmd, 80))
+	summary := req.Cmd
+	if summary == "" {
+		summary = strings.Join(req.Args, " ")
+	}
+	s.addLog("POST", "/exec", truncate(summary, 80))
 	json.NewEncoder(w).Encode(ExecResp{
-		Stdout: stdout.String(),
-		Stderr: stderr.String(),
-		Code:   code,
+		Stdout:          stdout.String(),
+		Stderr:          stderr.String(),
+		Code:            code,
+		StdoutTruncated: stdout.truncated,
+		StderrTruncated: stderr.truncated,
+		DurationMs:      duration.Milliseconds(),
+		Signal:          signal,
+		KilledChildren:  int(killed.Load()),
+		RunAs:           id.name(),
 	})
 }
 
 func (s *APIServer) handleConnect(w http.ResponseWriter, r *http.Request) {
 	if s.connectFn == nil {
-		jsonErr(w, "connect is not supported", 500)
+		jsonErrWithCode(w, "connect is not supported", ErrorCodeUnsupported, 500)
 		return
 	}
 
@@ -349,41 +543,81 @@ func (s *APIServer) handleRead(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Keep transport success and report a business-level miss via payload.
-			jsonErr(w, err.Error(), 200)
+			apiErr(w, err, 200)
 			return
 		}
-		jsonErr(w, err.Error(), 500)
+		apiErr(w, err, 500)
 		return
 	}
 	defer f.Close()
 
-	var lines []string
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	info, err := f.Stat()
+	if err != nil {
+		apiErr(w, err, 500)
+		return
 	}
-	totalLines := len(lines)
-
-	offset := req.Offset
-	limit := req.Limit
-	if offset < 0 {
-		offset = 0
+	if info.IsDir() {
+		jsonErrWithCode(w, req.Path+" is a directory", ErrorCodeIsDirectory, 400)
+		return
 	}
-	if offset > totalLines {
-		offset = totalLines
+	if req.Offset < 0 || req.Limit < 0 || req.Tail < 0 || req.ByteLimit < 0 {
+		jsonErrWithCode(w, "offset, limit, tail and byte_limit must not be negative", ErrorCodeInvalidRange, 400)
+		return
 	}
-	if limit <= 0 {
-		limit = totalLines
+	maxBytes := normalizeReadMaxBytes(req.MaxBytes)
+
+	var win readWindow
+	switch {
+	case req.ByteOffset != nil || req.ByteLimit > 0:
+		var offset int64
+		if req.ByteOffset != nil {
+			offset = *req.ByteOffset
+		}
+		if offset < 0 || offset > info.Size() {
+			jsonErrWithCode(w, fmt.Sprintf("byte_offset %d out of range [0, %d]", offset, info.Size()), ErrorCodeInvalidRange, 400)
+			return
+		}
+		limit := req.ByteLimit
+		if limit <= 0 || limit > maxBytes {
+			limit = maxBytes
+		}
+		var data []byte
+		win, data, err = readByteRange(f, info.Size(), offset, limit)
+		if err == nil && looksBinary(data) {
+			jsonErrWithCode(w, req.Path+" looks like a binary file, use /download instead", ErrorCodeBinaryFile, 200)
+			return
+		}
+	default:
+		binary, sniffErr := sniffBinaryFile(f)
+		if sniffErr != nil {
+			apiErr(w, sniffErr, 500)
+			return
+		}
+		if binary {
+			jsonErrWithCode(w, req.Path+" looks like a binary file, use /download instead", ErrorCodeBinaryFile, 200)
+			return
+		}
+		if req.Tail > 0 {
+			win, err = readTailLines(f, info.Size(), req.Tail, maxBytes)
+		} else {
+			win, err = readLineRange(f, req.Offset, req.Limit, maxBytes)
+		}
 	}
-	end := offset + limit
-	if end > totalLines {
-		end = totalLines
+	if err != nil {
+		apiErr(w, err, 500)
+		return
 	}
 
-	content := strings.Join(lines[offset:end], "\n")
 	s.addLog("POST", "/read", truncate(req.Path, 80))
-	json.NewEncoder(w).Encode(ReadResp{Content: content, TotalLines: totalLines})
+	json.NewEncoder(w).Encode(ReadResp{
+		Content:    win.Content,
+		TotalLines: win.TotalLines,
+		ByteOffset: win.ByteOffset,
+		Bytes:      win.Bytes,
+		TotalBytes: info.Size(),
+		EOF:        win.EOF,
+		Truncated:  win.Truncated,
+	})
 }
 
 func (s *APIServer) handleWrite(w http.ResponseWriter, r *http.Request) {
@@ -396,14 +630,27 @@ func (s *APIServer) handleWrite(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "path is required", 400)
 		return
 	}
+	id, err := resolveRunAs(req.RunAs)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
 
-	dir := filepath.Dir(req.Path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		jsonErr(w, err.Error(), 500)
+	existed, err := id.prepareWrite(req.Path)
+	if err != nil {
+		apiErr(w, err, 403)
+		return
+	}
+	if err := id.mkdirAll(filepath.Dir(req.Path)); err != nil {
+		apiErr(w, err, 500)
 		return
 	}
 	if err := os.WriteFile(req.Path, []byte(req.Content), 0644); err != nil {
-		jsonErr(w, err.Error(), 500)
+		apiErr(w, err, 500)
+		return
+	}
+	if err := id.chownCreated(req.Path, existed); err != nil {
+		apiErr(w, err, 500)
 		return
 	}
 
@@ -421,20 +668,30 @@ func (s *APIServer) handleEdit(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "path is required", 400)
 		return
 	}
+	id, err := resolveRunAs(req.RunAs)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+	// The file must exist, so rewriting it keeps its owner.
+	if _, err := id.prepareWrite(req.Path); err != nil {
+		apiErr(w, err, 403)
+		return
+	}
 
 	data, err := os.ReadFile(req.Path)
 	if err != nil {
-		jsonErr(w, err.Error(), 400)
+		apiErr(w, err, 400)
 		return
 	}
 
 	lines := strings.Split(string(data), "\n")
 	if req.StartLine < 1 || req.StartLine > len(lines)+1 {
-		jsonErr(w, fmt.Sprintf("start_line %d out of range (1-%d)", req.StartLine, len(lines)+1), 400)
+		jsonErrWithCode(w, fmt.Sprintf("start_line %d out of range (1-%d)", req.StartLine, len(lines)+1), ErrorCodeInvalidRange, 400)
 		return
 	}
 	if req.EndLine < req.StartLine-1 || req.EndLine > len(lines) {
-		jsonErr(w, fmt.Sprintf("end_line %d out of range (%d-%d)", req.EndLine, req.StartLine-1, len(lines)), 400)
+		jsonErrWithCode(w, fmt.Sprintf("end_line %d out of range (%d-%d)", req.EndLine, req.StartLine-1, len(lines)), ErrorCodeInvalidRange, 400)
 		return
 	}
 
@@ -449,7 +706,7 @@ func (s *APIServer) handleEdit(w http.ResponseWriter, r *http.Request) {
 	result = append(result, lines[req.EndLine:]...)
 
 	if err := os.WriteFile(req.Path, []byte(strings.Join(result, "\n")), 0644); err != nil {
-		jsonErr(w, err.Error(), 500)
+		apiErr(w, err, 500)
 		return
 	}
 
@@ -467,17 +724,27 @@ func (s *APIServer) handlePatch(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "path and old are required", 400)
 		return
 	}
+	id, err := resolveRunAs(req.RunAs)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+	// The file must exist, so rewriting it keeps its owner.
+	if _, err := id.prepareWrite(req.Path); err != nil {
+		apiErr(w, err, 403)
+		return
+	}
 
 	data, err := os.ReadFile(req.Path)
 	if err != nil {
-		jsonErr(w, err.Error(), 400)
+		apiErr(w, err, 400)
 		return
 	}
 
 	content := string(data)
 	count := strings.Count(content, req.Old)
 	if count == 0 {
-		jsonErr(w, "old text not found", 400)
+		jsonErrWithCode(w, "old text not found", ErrorCodeNoMatch, 400)
 		return
 	}
 
@@ -494,7 +761,7 @@ func (s *APIServer) handlePatch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := os.WriteFile(req.Path, []byte(newContent), 0644); err != nil {
-		jsonErr(w, err.Error(), 500)
+		apiErr(w, err, 500)
 		return
 	}
 
@@ -523,10 +790,10 @@ func (s *APIServer) handleLs(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Keep transport success and report a business-level miss via payload.
-			jsonErr(w, err.Error(), 200)
+			apiErr(w, err, 200)
 			return
 		}
-		jsonErr(w, err.Error(), 500)
+		apiErr(w, err, 500)
 		return
 	}
 
@@ -564,30 +831,43 @@ func (s *APIServer) handleUpload(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "data must be base64", 400)
 		return
 	}
+	id, err := resolveRunAs(req.RunAs)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
 
-	dir := filepath.Dir(req.Path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		jsonErr(w, err.Error(), 500)
+	existed, err := id.prepareWrite(req.Path)
+	if err != nil {
+		apiErr(w, err, 403)
+		return
+	}
+	if err := id.mkdirAll(filepath.Dir(req.Path)); err != nil {
+		apiErr(w, err, 500)
 		return
 	}
 
 	if req.Append {
 		f, err := os.OpenFile(req.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 		if err != nil {
-			jsonErr(w, err.Error(), 500)
+			apiErr(w, err, 500)
 			return
 		}
 		defer f.Close()
 		if _, err := f.Write(data); err != nil {
-			jsonErr(w, err.Error(), 500)
+			apiErr(w, err, 500)
 			return
 		}
 	} else {
 		if err := os.WriteFile(req.Path, data, 0644); err != nil {
-			jsonErr(w, err.Error(), 500)
+			apiErr(w, err, 500)
 			return
 		}
 	}
+	if err := id.chownCreated(req.Path, existed); err != nil {
+		apiErr(w, err, 500)
+		return
+	}
 
 	s.addLog("POST", "/upload", truncate(req.Path, 80))
 	json.NewEncoder(w).Encode(UploadResp{OK: true, Bytes: len(data)})
@@ -607,17 +887,17 @@ func (s *APIServer) handleDownload(w http.ResponseWriter, r *http.Request) {
 	f, err := os.Open(req.Path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			jsonErr(w, err.Error(), 200)
+			apiErr(w, err, 200)
 			return
 		}
-		jsonErr(w, err.Error(), 500)
+		apiErr(w, err, 500)
 		return
 	}
 	defer f.Close()
 
 	info, err := f.Stat()
 	if err != nil {
-		jsonErr(w, err.Error(), 500)
+		apiErr(w, err, 500)
 		return
 	}
 	total := info.Size()
@@ -639,13 +919,13 @@ func (s *APIServer) handleDownload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if _, err := f.Seek(offset, io.SeekStart); err != nil {
-		jsonErr(w, err.Error(), 500)
+		apiErr(w, err, 500)
 		return
 	}
 	buf := make([]byte, limit)
 	n, err := f.Read(buf)
 	if err != nil && err != io.EOF {
-		jsonErr(w, err.Error(), 500)
+		apiErr(w, err, 500)
 		return
 	}
 
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// routePermissions is the pairing permission each route needs. Routes not
+// listed (/connect, /batch) need none of their own; batch items are
+// checked as they are dispatched through the mux.
+var routePermissions = map[string]string{
+	"/read":          PermissionRead,
+	"/ls":            PermissionRead,
+	"/download":      PermissionRead,
+	"/sync/manifest": PermissionRead,
+	"/archive":       PermissionRead,
+	"/watch":         PermissionRead,
+	"/ps":            PermissionRead,
+	"/proc/inspect":  PermissionRead,
+	"/sysinfo":       PermissionRead,
+	"/write":         PermissionWrite,
+	"/edit":          PermissionWrite,
+	"/patch":         PermissionWrite,
+	"/upload":        PermissionWrite,
+	"/sync/put":      PermissionWrite,
+	"/sync/delete":   PermissionWrite,
+	"/extract":       PermissionWrite,
+	"/exec":          PermissionExec,
+	"/proc/signal":   PermissionExec,
+	"/tunnel":        PermissionForward,
+}
+
+// SetAccess applies the API token and permission scopes from the pairing
+// code. An empty token or permission list leaves that check off.
+func (s *APIServer) SetAccess(token string, permissions []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiToken = strings.TrimSpace(token)
+	s.permissions = append([]string(nil), permissions...)
+}
+
+func (s *APIServer) access() (string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.apiToken, s.permissions
+}
+
+// authorized enforces the pairing code's API token and permissions on path.
+func (s *APIServer) authorized(path string, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, permissions := s.access()
+		if token != "" && !bearerTokenMatches(r, token) {
+			s.addLog(r.Method, path, "denied: missing or invalid API token")
+			jsonErrWithCode(w, "missing or invalid API token (send Authorization: Bearer <api_token>)", ErrorCodeUnauthorized, http.StatusUnauthorized)
+			return
+		}
+		if scope := routePermissions[path]; scope != "" && len(permissions) > 0 && !containsString(permissions, scope) {
+			s.addLog(r.Method, path, "denied: needs permission "+scope)
+			jsonErrWithCode(w, fmt.Sprintf("%s needs the %q permission, which the pairing code does not grant", path, scope), ErrorCodePermissionDenied, http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func bearerTokenMatches(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(token)) == 1
+}
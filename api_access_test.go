@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func startAccessTestServer(t *testing.T, token string, permissions []string) (string, *http.Client) {
+	t.Helper()
+	s := NewAPIServer("127.0.0.1", 21180, nil, nil, nil)
+	s.SetAccess(token, permissions)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	transport := &http.Transport{}
+	t.Cleanup(func() {
+		transport.CloseIdleConnections()
+		s.Stop()
+	})
+	return fmt.Sprintf("http://127.0.0.1:%d", s.Port()), &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
+
+func TestAPIAccessToken(t *testing.T) {
+	base, client := startAccessTestServer(t, "tok", nil)
+	dir := t.TempDir()
+	auth := map[string]string{"Authorization": "Bearer tok"}
+
+	status, _, out := callWithHeaders(t, client, http.MethodGet, base+"/health", nil, nil)
+	var health HealthResp
+	json.Unmarshal(out, &health)
+	if status != 200 || !health.TokenRequired {
+		t.Fatalf("health should stay open and advertise the token: %d %s", status, out)
+	}
+
+	for _, header := range []map[string]string{nil, {"Authorization": "Bearer nope"}} {
+		status, _, out := callWithHeaders(t, client, http.MethodPost, base+"/ls", LsReq{Path: dir}, header)
+		var body map[string]string
+		json.Unmarshal(out, &body)
+		if status != http.StatusUnauthorized || body["error_code"] != ErrorCodeUnauthorized {
+			t.Fatalf("expected 401 unauthorized, got %d %s", status, out)
+		}
+	}
+	if status, _, out := callWithHeaders(t, client, http.MethodPost, base+"/v2/ls", LsReq{Path: dir}, auth); status != 200 {
+		t.Fatalf("authorized ls: %d %s", status, out)
+	}
+
+	// Batch items inherit the caller's token.
+	status, _, out = callWithHeaders(t, client, http.MethodPost, base+"/batch", BatchReq{Requests: []BatchItem{{Path: "/sysinfo"}}}, auth)
+	var resp BatchResp
+	json.Unmarshal(out, &resp)
+	if status != 200 || resp.Failed != 0 {
+		t.Fatalf("authorized batch: %d %s", status, out)
+	}
+}
+
+func TestAPIAccessPermissions(t *testing.T) {
+	base, client := startAccessTestServer(t, "", []string{PermissionRead})
+	dir := t.TempDir()
+
+	if status, _, out := callWithHeaders(t, client, http.MethodPost, base+"/ls", LsReq{Path: dir}, nil); status != 200 {
+		t.Fatalf("read scope ls: %d %s", status, out)
+	}
+	for _, path := range []string{"/exec", "/v2/write", "/v1/tunnel"} {
+		status, _, out := callWithHeaders(t, client, http.MethodPost, base+path, map[string]string{}, nil)
+		var body map[string]string
+		json.Unmarshal(out, &body)
+		if status != http.StatusForbidden || body["error_code"] != ErrorCodePermissionDenied {
+			t.Fatalf("%s: expected 403 permission_denied, got %d %s", path, status, out)
+		}
+	}
+
+	status, _, out := callWithHeaders(t, client, http.MethodPost, base+"/batch", BatchReq{Requests: []BatchItem{
+		{Path: "/sysinfo"},
+		{Path: "/exec", Body: json.RawMessage(`{"cmd":"echo hi"}`)},
+	}}, nil)
+	var resp BatchResp
+	json.Unmarshal(out, &resp)
+	if status != 200 || resp.Failed != 1 || resp.Results[1].ErrorCode != ErrorCodePermissionDenied {
+		t.Fatalf("batch should deny the exec item only: %d %s", status, out)
+	}
+
+	_, _, out = callWithHeaders(t, client, http.MethodGet, base+"/health", nil, nil)
+	var health HealthResp
+	json.Unmarshal(out, &health)
+	if health.TokenRequired || len(health.Permissions) != 1 || health.Permissions[0] != PermissionRead {
+		t.Fatalf("unexpected health access info: %s", out)
+	}
+}
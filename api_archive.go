@@ -0,0 +1,477 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	ArchiveFormatTarGz = "tar.gz"
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTar   = "tar"
+)
+
+type ArchiveReq struct {
+	Paths   []string `json:"paths"`
+	Format  string   `json:"format,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+type ExtractReq struct {
+	Path    string `json:"path"`
+	Data    string `json:"data,omitempty"`
+	Archive string `json:"archive,omitempty"`
+	Format  string `json:"format,omitempty"`
+	RunAs   string `json:"run_as,omitempty"`
+}
+
+type ExtractResp struct {
+	OK      bool     `json:"ok"`
+	Format  string   `json:"format"`
+	Files   int      `json:"files"`
+	Dirs    int      `json:"dirs"`
+	Bytes   int64    `json:"bytes"`
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+type archiveStats struct {
+	Files int
+	Bytes int64
+}
+
+func normalizeArchiveFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "tar.gz", "tgz", "gz":
+		return ArchiveFormatTarGz, nil
+	case "zip":
+		return ArchiveFormatZip, nil
+	case "tar":
+		return ArchiveFormatTar, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+func (s *APIServer) handleArchive(w http.ResponseWriter, r *http.Request) {
+	var req ArchiveReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	if len(req.Paths) == 0 {
+		jsonErr(w, "paths is required", 400)
+		return
+	}
+	format, err := normalizeArchiveFormat(req.Format)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+	for _, p := range req.Paths {
+		if _, err := os.Lstat(p); err != nil {
+			if os.IsNotExist(err) {
+				apiErr(w, err, 200)
+				return
+			}
+			apiErr(w, err, 500)
+			return
+		}
+	}
+
+	switch format {
+	case ArchiveFormatZip:
+		w.Header().Set("Content-Type", "application/zip")
+	case ArchiveFormatTar:
+		w.Header().Set("Content-Type", "application/x-tar")
+	default:
+		w.Header().Set("Content-Type", "application/gzip")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archiveFileName(req.Paths, format)))
+	w.Header().Set("Trailer", archiveErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	bw := bufio.NewWriterSize(w, 64*1024)
+	stats, err := writeArchive(bw, format, req.Paths, req.Exclude)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		s.addLog("POST", "/archive", truncate(fmt.Sprintf("%s failed: %v", strings.Join(req.Paths, ","), err), 80))
+		abortStream(w, err)
+		return
+	}
+	s.addLog("POST", "/archive", fmt.Sprintf("%s (%s, %d files)", truncate(strings.Join(req.Paths, ","), 50), format, stats.Files))
+}
+
+// archiveErrorTrailer carries the error of an archive that failed mid-way.
+const archiveErrorTrailer = "X-Telehand-Error"
+
+// abortStream ends a response whose headers are already sent. On a real
+// connection it closes it mid-body, so the client sees a truncated transfer
+// rather than a silently incomplete archive; writers that cannot be
+// hijacked (batch, tests) get the error in the trailer instead.
+func abortStream(w http.ResponseWriter, err error) {
+	w.Header().Set(archiveErrorTrailer, err.Error())
+	if conn, _, herr := http.NewResponseController(w).Hijack(); herr == nil {
+		conn.Close()
+	}
+}
+
+func archiveFileName(paths []string, format string) string {
+	name := "archive"
+	if len(paths) == 1 {
+		if base := filepath.Base(filepath.Clean(paths[0])); base != "." && base != string(filepath.Separator) {
+			name = base
+		}
+	}
+	return name + "." + format
+}
+
+// writeArchive packs every path under its base name, mirroring
+// `tar -C parent base`. Symlinks and special files are skipped.
+func writeArchive(w io.Writer, format string, paths []string, excludes []string) (archiveStats, error) {
+	var stats archiveStats
+	var add func(name string, p string, info fs.FileInfo) error
+	var closeFn func() error
+
+	switch format {
+	case ArchiveFormatZip:
+		zw := zip.NewWriter(w)
+		closeFn = zw.Close
+		add = func(name string, p string, info fs.FileInfo) error {
+			hdr, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			hdr.Name = name
+			if info.IsDir() {
+				hdr.Name += "/"
+				hdr.Method = zip.Store
+			} else {
+				hdr.Method = zip.Deflate
+			}
+			fw, err := zw.CreateHeader(hdr)
+			if err != nil || info.IsDir() {
+				return err
+			}
+			return copyFileTo(fw, p)
+		}
+	default:
+		var tw *tar.Writer
+		if format == ArchiveFormatTar {
+			tw = tar.NewWriter(w)
+			closeFn = tw.Close
+		} else {
+			gw := gzip.NewWriter(w)
+			tw = tar.NewWriter(gw)
+			closeFn = func() error {
+				if err := tw.Close(); err != nil {
+					return err
+				}
+				return gw.Close()
+			}
+		}
+		add = func(name string, p string, info fs.FileInfo) error {
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = name
+			if info.IsDir() {
+				hdr.Name += "/"
+			}
+			// Owner names differ across machines and are not restored.
+			hdr.Uname, hdr.Gname = "", ""
+			if err := tw.WriteHeader(hdr); err != nil || info.IsDir() {
+				return err
+			}
+			return copyFileTo(tw, p)
+		}
+	}
+
+	for _, src := range paths {
+		src = filepath.Clean(src)
+		base := filepath.Base(src)
+		err := filepath.WalkDir(src, func(p string, d fs.DirEntry, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			rel, err := filepath.Rel(src, p)
+			if err != nil {
+				return err
+			}
+			name := base
+			if rel != "." {
+				name = path.Join(base, filepath.ToSlash(rel))
+				if matchSyncExclude(filepath.ToSlash(rel), d.IsDir(), excludes) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+			if !d.IsDir() && !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if err := add(name, p, info); err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				stats.Files++
+				stats.Bytes += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, closeFn()
+}
+
+func copyFileTo(w io.Writer, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (s *APIServer) handleExtract(w http.ResponseWriter, r *http.Request) {
+	var req ExtractReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	if req.Path == "" {
+		jsonErr(w, "path is required", 400)
+		return
+	}
+	if (req.Data == "") == (req.Archive == "") {
+		jsonErr(w, "exactly one of data or archive is required", 400)
+		return
+	}
+
+	var src io.ReaderAt
+	var size int64
+	if req.Data != "" {
+		data, err := base64.StdEncoding.DecodeString(req.Data)
+		if err != nil {
+			jsonErr(w, "data must be base64", 400)
+			return
+		}
+		src, size = bytes.NewReader(data), int64(len(data))
+	} else {
+		f, err := os.Open(req.Archive)
+		if err != nil {
+			if os.IsNotExist(err) {
+				apiErr(w, err, 200)
+				return
+			}
+			apiErr(w, err, 500)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			apiErr(w, err, 500)
+			return
+		}
+		src, size = f, info.Size()
+	}
+
+	format := strings.TrimSpace(req.Format)
+	if format == "" {
+		format = detectArchiveFormat(src)
+	}
+	format, err := normalizeArchiveFormat(format)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+	id, err := resolveRunAs(req.RunAs)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+	if _, err := id.prepareWrite(req.Path); err != nil {
+		apiErr(w, err, 403)
+		return
+	}
+	if err := id.mkdirAll(req.Path); err != nil {
+		apiErr(w, err, 500)
+		return
+	}
+
+	resp, err := extractArchive(src, size, format, req.Path, id)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+	s.addLog("POST", "/extract", fmt.Sprintf("%s (%s, %d files)", truncate(req.Path, 60), format, resp.Files))
+	json.NewEncoder(w).Encode(resp)
+}
+
+func detectArchiveFormat(src io.ReaderAt) string {
+	magic := make([]byte, 4)
+	n, _ := src.ReadAt(magic, 0)
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return ArchiveFormatTarGz
+	case bytes.HasPrefix(magic, []byte("PK")):
+		return ArchiveFormatZip
+	default:
+		return ArchiveFormatTar
+	}
+}
+
+// extractArchive unpacks src below dest. Entries that would land outside dest
+// (absolute names, "..") as well as links and special files are skipped and
+// reported instead of being written. New files and directories are owned
+// by id; replaced files keep their owner.
+func extractArchive(src io.ReaderAt, size int64, format string, dest string, id *runAsIdentity) (ExtractResp, error) {
+	resp := ExtractResp{OK: true, Format: format}
+
+	if format == ArchiveFormatZip {
+		zr, err := zip.NewReader(src, size)
+		if err != nil {
+			return resp, fmt.Errorf("invalid zip archive: %w", err)
+		}
+		for _, zf := range zr.File {
+			mode := zf.Mode()
+			if !mode.IsDir() && !mode.IsRegular() {
+				resp.Skipped = append(resp.Skipped, zf.Name)
+				continue
+			}
+			target, err := resolveUnderRoot(dest, zf.Name)
+			if err != nil {
+				resp.Skipped = append(resp.Skipped, zf.Name)
+				continue
+			}
+			if mode.IsDir() {
+				if err := id.mkdirAll(target); err != nil {
+					return resp, err
+				}
+				resp.Dirs++
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return resp, err
+			}
+			n, err := writeExtractedFile(target, rc, mode, zf.Modified, id)
+			rc.Close()
+			if err != nil {
+				return resp, err
+			}
+			resp.Files++
+			resp.Bytes += n
+		}
+		return resp, nil
+	}
+
+	var rd io.Reader = io.NewSectionReader(src, 0, size)
+	if format == ArchiveFormatTarGz {
+		gr, err := gzip.NewReader(rd)
+		if err != nil {
+			return resp, fmt.Errorf("invalid gzip archive: %w", err)
+		}
+		defer gr.Close()
+		rd = gr
+	}
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return resp, fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeDir && hdr.Typeflag != tar.TypeReg {
+			resp.Skipped = append(resp.Skipped, hdr.Name)
+			continue
+		}
+		target, err := resolveUnderRoot(dest, hdr.Name)
+		if err != nil {
+			resp.Skipped = append(resp.Skipped, hdr.Name)
+			continue
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			if err := id.mkdirAll(target); err != nil {
+				return resp, err
+			}
+			resp.Dirs++
+			continue
+		}
+		n, err := writeExtractedFile(target, tr, hdr.FileInfo().Mode(), hdr.ModTime, id)
+		if err != nil {
+			return resp, err
+		}
+		resp.Files++
+		resp.Bytes += n
+	}
+	return resp, nil
+}
+
+func writeExtractedFile(target string, r io.Reader, mode fs.FileMode, mtime time.Time, id *runAsIdentity) (int64, error) {
+	prev, statErr := os.Lstat(target)
+	if id != nil {
+		if err := id.checkWriteAccess(target); err != nil {
+			return 0, err
+		}
+	}
+	if err := id.mkdirAll(filepath.Dir(target)); err != nil {
+		return 0, err
+	}
+	// Replace rather than open in place so an existing symlink at target is
+	// never followed.
+	_ = os.Remove(target)
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if statErr == nil {
+			// A replaced file keeps its previous owner.
+			err = id.restoreOwner(target, prev)
+		} else {
+			err = id.chown(target)
+		}
+	}
+	if err != nil {
+		return n, err
+	}
+	var unix int64
+	if !mtime.IsZero() {
+		unix = mtime.Unix()
+	}
+	applySyncAttrs(target, uint32(mode.Perm()), unix)
+	return n, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIArchiveRoundTrip(t *testing.T) {
+	s := NewAPIServer("127.0.0.1", 19880, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	base := fmt.Sprintf("http://127.0.0.1:%d", s.Port())
+	client := &http.Client{Timeout: 8 * time.Second}
+
+	src := filepath.Join(t.TempDir(), "logs")
+	mustWriteFile(t, filepath.Join(src, "app.log"), "app")
+	mustWriteFile(t, filepath.Join(src, "nested", "worker.log"), "worker")
+	mustWriteFile(t, filepath.Join(src, "cache", "blob.bin"), "blob")
+
+	for _, format := range []string{"tar.gz", "zip"} {
+		status, out := callRaw(t, client, http.MethodPost, base+"/archive", ArchiveReq{
+			Paths:   []string{src},
+			Format:  format,
+			Exclude: []string{"cache/"},
+		})
+		if status != http.StatusOK {
+			t.Fatalf("archive %s status=%d body=%s", format, status, out)
+		}
+
+		dest := t.TempDir()
+		status, out = callRaw(t, client, http.MethodPost, base+"/extract", ExtractReq{
+			Path: dest,
+			Data: base64.StdEncoding.EncodeToString(out),
+		})
+		if status != http.StatusOK {
+			t.Fatalf("extract %s status=%d body=%s", format, status, out)
+		}
+		var resp ExtractResp
+		if err := json.Unmarshal(out, &resp); err != nil {
+			t.Fatalf("decode extract resp failed: %v", err)
+		}
+		if resp.Format != format || resp.Files != 2 {
+			t.Fatalf("extract resp mismatch: got=%+v", resp)
+		}
+		assertFileContent(t, filepath.Join(dest, "logs", "app.log"), "app")
+		assertFileContent(t, filepath.Join(dest, "logs", "nested", "worker.log"), "worker")
+		if _, err := os.Stat(filepath.Join(dest, "logs", "cache")); !os.IsNotExist(err) {
+			t.Fatalf("excluded dir should not be archived: err=%v", err)
+		}
+	}
+
+	status, out := callRaw(t, client, http.MethodPost, base+"/archive", ArchiveReq{Paths: []string{filepath.Join(src, "missing")}})
+	if status != http.StatusOK || !bytes.Contains(out, []byte(`"error"`)) {
+		t.Fatalf("missing path should return 200 + error: status=%d body=%s", status, out)
+	}
+}
+
+func TestExtractArchiveSkipsUnsafeEntries(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	writeEntry := func(hdr *tar.Header, body string) {
+		hdr.Size = int64(len(body))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("write header failed: %v", err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatalf("write body failed: %v", err)
+		}
+	}
+	writeEntry(&tar.Header{Name: "ok.txt", Mode: 0644, Typeflag: tar.TypeReg}, "ok")
+	writeEntry(&tar.Header{Name: "../evil.txt", Mode: 0644, Typeflag: tar.TypeReg}, "evil")
+	writeEntry(&tar.Header{Name: "/abs.txt", Mode: 0644, Typeflag: tar.TypeReg}, "abs")
+	writeEntry(&tar.Header{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}, "")
+	tw.Close()
+	gw.Close()
+
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	data := buf.Bytes()
+	resp, err := extractArchive(bytes.NewReader(data), int64(len(data)), detectArchiveFormat(bytes.NewReader(data)), dest, nil)
+	if err != nil {
+		t.Fatalf("extractArchive failed: %v", err)
+	}
+	sort.Strings(resp.Skipped)
+	want := []string{"../evil.txt", "/abs.txt", "link"}
+	if resp.Files != 1 || !reflect.DeepEqual(resp.Skipped, want) {
+		t.Fatalf("extract resp mismatch: got=%+v want skipped=%v", resp, want)
+	}
+	assertFileContent(t, filepath.Join(dest, "ok.txt"), "ok")
+	if _, err := os.Stat(filepath.Join(parent, "evil.txt")); !os.IsNotExist(err) {
+		t.Fatalf("traversal entry must not be written: err=%v", err)
+	}
+}
+
+func TestAPIArchiveAbortsOnReadError(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs /proc/self/mem, which stats fine but fails to read")
+	}
+	body := `{"paths":["/proc/self/mem"],"format":"tar"}`
+
+	// In process the handler must return normally and report the error in
+	// the trailer.
+	s := NewAPIServer("127.0.0.1", 21380, nil, nil, nil)
+	rec := httptest.NewRecorder()
+	s.handleArchive(rec, httptest.NewRequest(http.MethodPost, "/archive", strings.NewReader(body)))
+	if got := rec.Result().Trailer.Get(archiveErrorTrailer); !strings.Contains(got, "input/output error") {
+		t.Fatalf("trailer = %q, want the read error", got)
+	}
+	if logs := s.cmdLogs; len(logs) != 1 || !strings.Contains(logs[0].Summary, "failed") {
+		t.Fatalf("log = %+v, want a failure entry", logs)
+	}
+
+	// Over HTTP the body is cut off.
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	client := &http.Client{Timeout: 8 * time.Second, Transport: &http.Transport{}}
+	resp, err := client.Post(fmt.Sprintf("http://127.0.0.1:%d/archive", s.Port()), "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Fatal("expected a truncated body")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	batchMaxItems    = 64
+	batchParallelism = 8
+)
+
+// batchExcluded lists routes that cannot run inside /batch: tunnels
+// hijack the connection, /watch streams, /archive streams binary that has
+// no place in a JSON result, and nesting batches buys nothing.
+var batchExcluded = map[string]bool{
+	"/batch":   true,
+	"/tunnel":  true,
+	"/watch":   true,
+	"/archive": true,
+	"/health":  true,
+}
+
+type BatchReq struct {
+	Requests    []BatchItem `json:"requests"`
+	Parallel    bool        `json:"parallel,omitempty"`
+	StopOnError bool        `json:"stop_on_error,omitempty"`
+}
+
+type BatchItem struct {
+	Path string          `json:"path"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+type BatchResult struct {
+	Path       string          `json:"path"`
+	Status     int             `json:"status"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	ErrorCode  string          `json:"error_code,omitempty"`
+	Skipped    bool            `json:"skipped,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+}
+
+type BatchResp struct {
+	Results []BatchResult `json:"results"`
+	Failed  int           `json:"failed"`
+	Skipped int           `json:"skipped"`
+}
+
+func (s *APIServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	if len(req.Requests) == 0 {
+		jsonErr(w, "requests is required", 400)
+		return
+	}
+	if len(req.Requests) > batchMaxItems {
+		jsonErrWithCode(w, fmt.Sprintf("too many requests: %d (max %d)", len(req.Requests), batchMaxItems), ErrorCodeTooLarge, 400)
+		return
+	}
+
+	results := make([]BatchResult, len(req.Requests))
+	if req.Parallel {
+		s.runBatchParallel(r, req, results)
+	} else {
+		for i, item := range req.Requests {
+			if req.StopOnError && i > 0 && results[i-1].failed() {
+				for j := i; j < len(results); j++ {
+					results[j] = BatchResult{Path: req.Requests[j].Path, Skipped: true}
+				}
+				break
+			}
+			results[i] = s.runBatchItem(r, item)
+		}
+	}
+	for _, res := range results {
+		// Handlers log successful calls themselves; most bail out before
+		// that on bad input, so failures are recorded here.
+		if res.failed() {
+			s.addLog("POST", res.Path, "batch error: "+truncate(res.Error, 70))
+		}
+	}
+
+	resp := BatchResp{Results: results}
+	for _, res := range results {
+		switch {
+		case res.Skipped:
+			resp.Skipped++
+		case res.failed():
+			resp.Failed++
+		}
+	}
+	mode := "sequential"
+	if req.Parallel {
+		mode = "parallel"
+	}
+	s.addLog("POST", "/batch", fmt.Sprintf("%d requests (%s) failed=%d skipped=%d", len(results), mode, resp.Failed, resp.Skipped))
+	json.NewEncoder(w).Encode(resp)
+}
+
+// runBatchParallel runs up to batchParallelism items at once. With
+// stop_on_error, items that have not started when one fails are skipped.
+func (s *APIServer) runBatchParallel(r *http.Request, req BatchReq, results []BatchResult) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped bool
+	)
+	sem := make(chan struct{}, batchParallelism)
+	for i, item := range req.Requests {
+		sem <- struct{}{}
+		mu.Lock()
+		skip := stopped
+		mu.Unlock()
+		if skip {
+			<-sem
+			results[i] = BatchResult{Path: item.Path, Skipped: true}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res := s.runBatchItem(r, item)
+			results[i] = res
+			if req.StopOnError && res.failed() {
+				mu.Lock()
+				stopped = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runBatchItem sends one sub-request through the normal mux so it gets the
+// same method check, handler and log entry as a direct call.
+func (s *APIServer) runBatchItem(r *http.Request, item BatchItem) BatchResult {
+	res := BatchResult{Path: item.Path}
+	path := strings.TrimSpace(item.Path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	res.Path = path
+	bare := strings.TrimPrefix(path, apiVersionPrefix(path))
+	if batchExcluded[bare] {
+		res.Status = http.StatusBadRequest
+		res.Error = fmt.Sprintf("%s cannot be used inside /batch", bare)
+		res.ErrorCode = ErrorCodeBatchUnsupported
+		return res
+	}
+	body := item.Body
+	if len(body) == 0 {
+		body = json.RawMessage("{}")
+	}
+	// Unversioned items follow the batch's own version, so a /v2/batch
+	// reports /v2 statuses throughout.
+	if bare == path {
+		path = apiVersionPrefix(r.URL.Path) + path
+	}
+	sub, err := http.NewRequestWithContext(r.Context(), http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		res.Status = http.StatusBadRequest
+		res.Error = err.Error()
+		res.ErrorCode = ErrorCodeInvalidRequest
+		return res
+	}
+	sub.Header.Set("Content-Type", "application/json")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sub.Header.Set("Authorization", auth)
+	}
+	sub.RemoteAddr = r.RemoteAddr
+	if _, pattern := s.mux.Handler(sub); pattern != path {
+		res.Status = http.StatusNotFound
+		res.Error = fmt.Sprintf("unknown path %s", res.Path)
+		res.ErrorCode = ErrorCodeBatchUnsupported
+		return res
+	}
+
+	rec := &batchRecorder{header: http.Header{}}
+	start := time.Now()
+	recovered := serveBatchItem(s.mux, rec, sub)
+	res.DurationMs = time.Since(start).Milliseconds()
+	if recovered != nil {
+		res.Status = http.StatusInternalServerError
+		res.Error = fmt.Sprintf("%s panicked: %v", res.Path, recovered)
+		res.ErrorCode = ErrorCodeInternal
+		return res
+	}
+	res.Status = rec.statusCode()
+
+	raw := bytes.TrimSpace(rec.body.Bytes())
+	var errBody struct {
+		Error     string `json:"error"`
+		ErrorCode string `json:"error_code"`
+	}
+	if json.Valid(raw) {
+		res.Body = json.RawMessage(raw)
+		if json.Unmarshal(raw, &errBody) == nil && errBody.Error != "" {
+			res.Error, res.ErrorCode = errBody.Error, errBody.ErrorCode
+		}
+	} else if len(raw) > 0 {
+		// http.Error replies (e.g. method checks) are plain text.
+		res.Error = string(raw)
+	}
+	if res.Error == "" && res.Status >= 400 {
+		res.Error = http.StatusText(res.Status)
+	}
+	return res
+}
+
+// serveBatchItem runs one sub-request and returns what it panicked with.
+// Parallel items run on their own goroutines, outside net/http's recover,
+// so a panicking handler would otherwise take the whole process down.
+func serveBatchItem(h http.Handler, w http.ResponseWriter, r *http.Request) (recovered any) {
+	defer func() { recovered = recover() }()
+	h.ServeHTTP(w, r)
+	return nil
+}
+
+// failed treats HTTP errors and 200-with-error business misses alike,
+// matching how remoteClient.call reads responses.
+func (b BatchResult) failed() bool {
+	return !b.Skipped && (b.Status >= 400 || b.Error != "")
+}
+
+// batchRecorder captures a sub-request's response in memory.
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *batchRecorder) Header() http.Header { return b.header }
+
+func (b *batchRecorder) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *batchRecorder) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+func (b *batchRecorder) statusCode() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startBatchTestServer(t *testing.T) (*APIServer, string, *http.Client) {
+	t.Helper()
+	s := NewAPIServer("127.0.0.1", 20880, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	t.Cleanup(s.Stop)
+	return s, fmt.Sprintf("http://127.0.0.1:%d", s.Port()), &http.Client{Timeout: 10 * time.Second}
+}
+
+func batchItem(t *testing.T, path string, body any) BatchItem {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal %s body: %v", path, err)
+	}
+	return BatchItem{Path: path, Body: raw}
+}
+
+func callBatch(t *testing.T, client *http.Client, base string, req BatchReq) BatchResp {
+	t.Helper()
+	status, out := callRaw(t, client, http.MethodPost, base+"/batch", req)
+	if status != http.StatusOK {
+		t.Fatalf("POST /batch status=%d body=%s", status, string(out))
+	}
+	var resp BatchResp
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("POST /batch unmarshal failed: %v body=%s", err, string(out))
+	}
+	return resp
+}
+
+func TestBatchRunsSubRequestsInOrder(t *testing.T) {
+	s, base, client := startBatchTestServer(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	mustWriteFile(t, file, "hello\n")
+
+	resp := callBatch(t, client, base, BatchReq{Requests: []BatchItem{
+		batchItem(t, "/ls", LsReq{Path: dir}),
+		batchItem(t, "/read", ReadReq{Path: file}),
+		batchItem(t, "read", ReadReq{Path: filepath.Join(dir, "missing")}),
+		batchItem(t, "/tunnel", TunnelReq{Mode: TunnelModeLocal}),
+		{Path: "/nope"},
+	}})
+	if len(resp.Results) != 5 || resp.Failed != 3 || resp.Skipped != 0 {
+		t.Fatalf("unexpected summary: %+v", resp)
+	}
+	if r := resp.Results[0]; r.Path != "/ls" || r.Status != 200 || r.Error != "" || !strings.Contains(string(r.Body), "a.txt") {
+		t.Fatalf("ls result: %+v", r)
+	}
+	var read ReadResp
+	if err := json.Unmarshal(resp.Results[1].Body, &read); err != nil || !strings.Contains(read.Content, "hello") {
+		t.Fatalf("read result: %s (%v)", string(resp.Results[1].Body), err)
+	}
+	if r := resp.Results[2]; r.Path != "/read" || r.Status != 200 || r.Error == "" {
+		t.Fatalf("missing read should be a 200 business miss: %+v", r)
+	}
+	if r := resp.Results[3]; r.ErrorCode != ErrorCodeBatchUnsupported {
+		t.Fatalf("tunnel must be rejected inside batch: %+v", r)
+	}
+	if r := resp.Results[4]; r.Status != http.StatusNotFound || r.ErrorCode != ErrorCodeBatchUnsupported {
+		t.Fatalf("unknown path: %+v", r)
+	}
+
+	// Each sub-request is logged on its own, followed by the batch summary.
+	var paths []string
+	for _, l := range s.GetLogs() {
+		paths = append(paths, l.Path)
+	}
+	if got := strings.Join(paths, ","); got != "/ls,/read,/read,/tunnel,/nope,/batch" {
+		t.Fatalf("unexpected logs: %s", got)
+	}
+}
+
+func TestBatchStopOnError(t *testing.T) {
+	_, base, client := startBatchTestServer(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	mustWriteFile(t, file, "x")
+
+	resp := callBatch(t, client, base, BatchReq{StopOnError: true, Requests: []BatchItem{
+		batchItem(t, "/read", ReadReq{Path: file}),
+		batchItem(t, "/read", ReadReq{Path: filepath.Join(dir, "missing")}),
+		batchItem(t, "/read", ReadReq{Path: file}),
+		batchItem(t, "/ls", LsReq{Path: dir}),
+	}})
+	if resp.Failed != 1 || resp.Skipped != 2 {
+		t.Fatalf("unexpected summary: %+v", resp)
+	}
+	for _, r := range resp.Results[2:] {
+		if !r.Skipped || r.Status != 0 {
+			t.Fatalf("expected skipped result, got %+v", r)
+		}
+	}
+}
+
+func TestBatchParallel(t *testing.T) {
+	_, base, client := startBatchTestServer(t)
+	dir := t.TempDir()
+	var items []BatchItem
+	for i := 0; i < 12; i++ {
+		file := filepath.Join(dir, fmt.Sprintf("f%d.txt", i))
+		mustWriteFile(t, file, fmt.Sprintf("content-%d", i))
+		items = append(items, batchItem(t, "/read", ReadReq{Path: file}))
+	}
+
+	resp := callBatch(t, client, base, BatchReq{Parallel: true, Requests: items})
+	if resp.Failed != 0 || len(resp.Results) != len(items) {
+		t.Fatalf("unexpected summary: %+v", resp)
+	}
+	for i, r := range resp.Results {
+		var read ReadResp
+		if err := json.Unmarshal(r.Body, &read); err != nil || !strings.Contains(read.Content, fmt.Sprintf("content-%d", i)) {
+			t.Fatalf("result %d out of order or wrong: %s", i, string(r.Body))
+		}
+	}
+}
+
+func TestBatchRejectsEmptyAndOversized(t *testing.T) {
+	_, base, client := startBatchTestServer(t)
+	if status, out := callRaw(t, client, http.MethodPost, base+"/batch", BatchReq{}); status != http.StatusBadRequest {
+		t.Fatalf("empty batch status=%d body=%s", status, string(out))
+	}
+	items := make([]BatchItem, batchMaxItems+1)
+	for i := range items {
+		items[i] = BatchItem{Path: "/sysinfo"}
+	}
+	if status, out := callRaw(t, client, http.MethodPost, base+"/batch", BatchReq{Requests: items}); status != http.StatusBadRequest {
+		t.Fatalf("oversized batch status=%d body=%s", status, string(out))
+	}
+}
+
+func TestBatchIsolatesArchiveAndPanics(t *testing.T) {
+	// A port of its own: earlier tests leave keep-alive connections to the
+	// shared batch port that would reach their servers, not this one.
+	s := NewAPIServer("127.0.0.1", 21480, nil, nil, nil)
+	s.mux.HandleFunc("/boom", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	t.Cleanup(s.Stop)
+	base, client := fmt.Sprintf("http://127.0.0.1:%d", s.Port()), &http.Client{Timeout: 10 * time.Second}
+
+	resp := callBatch(t, client, base, BatchReq{Parallel: true, Requests: []BatchItem{
+		batchItem(t, "/archive", ArchiveReq{Paths: []string{t.TempDir()}}),
+		{Path: "/boom"},
+		{Path: "/sysinfo"},
+	}})
+	if r := resp.Results[0]; r.Status != http.StatusBadRequest || r.ErrorCode != ErrorCodeBatchUnsupported {
+		t.Fatalf("/archive should be refused: %+v", r)
+	}
+	if r := resp.Results[1]; r.Status != http.StatusInternalServerError || r.ErrorCode != ErrorCodeInternal || !strings.Contains(r.Error, "boom") {
+		t.Fatalf("panic should become a 500 for its item: %+v", r)
+	}
+	if r := resp.Results[2]; r.Status != http.StatusOK {
+		t.Fatalf("other items should still run: %+v", r)
+	}
+}
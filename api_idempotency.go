@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	requestIDHeader           = "X-Request-Id"
+	serverTimingHeader        = "Server-Timing"
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	idempotencyMaxEntries     = 512
+	idempotencyMaxKeyLen      = 255
+)
+
+// idempotentRoutes are the mutating endpoints that honour Idempotency-Key.
+var idempotentRoutes = map[string]bool{
+	"/connect":     true,
+	"/exec":        true,
+	"/write":       true,
+	"/edit":        true,
+	"/patch":       true,
+	"/upload":      true,
+	"/sync/put":    true,
+	"/sync/delete": true,
+	"/extract":     true,
+	"/proc/signal": true,
+	"/batch":       true,
+}
+
+// idempotencyEntry is one remembered response. done is closed once the
+// first request finished; until then retries wait instead of re-applying.
+type idempotencyEntry struct {
+	bodyHash  [32]byte
+	done      chan struct{}
+	cached    bool
+	requestID string
+	status    int
+	header    http.Header
+	body      []byte
+}
+
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	order   []string
+}
+
+// newRequestID keeps a caller-supplied X-Request-Id when it is sane so
+// logs on both sides line up.
+func newRequestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" && len(id) <= 128 && printableASCII(id) {
+		return id
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func printableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotent replays the stored response for a repeated Idempotency-Key
+// on path. Responses with 5xx are not kept so a retry can try again.
+func (s *APIServer) idempotent(path string, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			handler(w, r)
+			return
+		}
+		if len(key) > idempotencyMaxKeyLen || !printableASCII(key) {
+			jsonErrWithCode(w, "invalid Idempotency-Key", ErrorCodeInvalidRequest, 400)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			jsonErr(w, "invalid request body", 400)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+
+		entry, first := s.idempotency.claim(path+"\x00"+key, hash)
+		if !first {
+			if entry.bodyHash != hash {
+				jsonErrWithCode(w, "Idempotency-Key was already used with a different request", ErrorCodeConflict, 409)
+				return
+			}
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+			if entry.cached {
+				replayIdempotent(w, entry)
+				return
+			}
+			// The first attempt failed server-side; run this one instead.
+			entry, first = s.idempotency.claim(path+"\x00"+key, hash)
+			if !first {
+				jsonErrWithCode(w, "request with this Idempotency-Key is already in progress", ErrorCodeConflict, 409)
+				return
+			}
+		}
+
+		// Buffer the response so it can be stored; the recorder starts
+		// with the version and request ID headers already set on w.
+		rec := &batchRecorder{header: w.Header().Clone()}
+		handler(rec, r)
+		status := rec.statusCode()
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+		w.Write(rec.body.Bytes())
+		s.idempotency.finish(path+"\x00"+key, entry, w.Header().Get(requestIDHeader), status, rec.header, rec.body.Bytes())
+	}
+}
+
+func replayIdempotent(w http.ResponseWriter, entry *idempotencyEntry) {
+	for k, v := range entry.header {
+		w.Header()[k] = v
+	}
+	if entry.requestID != "" {
+		w.Header().Set(requestIDHeader, entry.requestID)
+	}
+	w.Header().Set(idempotencyReplayedHeader, "true")
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
+
+// claim returns the entry for key and whether the caller is the first
+// request for it and must run the handler.
+func (c *idempotencyCache) claim(key string, hash [32]byte) (*idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]*idempotencyEntry{}
+	}
+	if e, ok := c.entries[key]; ok {
+		return e, false
+	}
+	e := &idempotencyEntry{bodyHash: hash, done: make(chan struct{})}
+	c.entries[key] = e
+	c.order = append(c.order, key)
+	for len(c.order) > idempotencyMaxEntries {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		if old := c.entries[oldest]; old != nil && isClosed(old.done) {
+			delete(c.entries, oldest)
+		} else {
+			// Still running; keep it and look at it again later.
+			c.order = append(c.order, oldest)
+			break
+		}
+	}
+	return e, true
+}
+
+func (c *idempotencyCache) finish(key string, e *idempotencyEntry, requestID string, status int, header http.Header, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if status < 500 {
+		e.cached = true
+		e.requestID = requestID
+		e.status = status
+		e.header = header.Clone()
+		e.body = append([]byte(nil), body...)
+	} else if c.entries[key] == e {
+		delete(c.entries, key)
+	}
+	close(e.done)
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// timingWriter stamps Server-Timing with the handler's time to first
+// byte. It forwards Flush and Hijack so /watch and /tunnel keep working.
+type timingWriter struct {
+	http.ResponseWriter
+	start   time.Time
+	stamped bool
+}
+
+func (t *timingWriter) stamp() {
+	if t.stamped {
+		return
+	}
+	t.stamped = true
+	dur := float64(time.Since(t.start).Microseconds()) / 1000
+	t.Header().Set(serverTimingHeader, fmt.Sprintf("app;dur=%.1f", dur))
+}
+
+func (t *timingWriter) WriteHeader(code int) {
+	t.stamp()
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *timingWriter) Write(p []byte) (int, error) {
+	t.stamp()
+	return t.ResponseWriter.Write(p)
+}
+
+func (t *timingWriter) Flush() {
+	t.stamp()
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := t.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack not supported")
+}
+
+func (t *timingWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
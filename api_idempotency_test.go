@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func callWithHeaders(t *testing.T, client *http.Client, method, url string, body any, header map[string]string) (int, http.Header, []byte) {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body failed: %v", err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		t.Fatalf("new request failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	out, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header, out
+}
+
+func startIdempotencyTestServer(t *testing.T) (string, *http.Client) {
+	t.Helper()
+	s := NewAPIServer("127.0.0.1", 21080, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	// A private transport keeps keep-alive connections from reaching a
+	// server left over from an earlier test on the same port.
+	transport := &http.Transport{}
+	t.Cleanup(func() {
+		transport.CloseIdleConnections()
+		s.Stop()
+	})
+	return fmt.Sprintf("http://127.0.0.1:%d", s.Port()), &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
+
+func TestEveryResponseCarriesRequestIDAndTiming(t *testing.T) {
+	base, client := startIdempotencyTestServer(t)
+	dir := t.TempDir()
+
+	cases := []struct {
+		method string
+		path   string
+		body   any
+	}{
+		{http.MethodGet, "/health", nil},
+		{http.MethodPost, "/ls", LsReq{Path: dir}},
+		{http.MethodPost, "/read", ReadReq{Path: filepath.Join(dir, "missing")}},
+		{http.MethodPost, "/v2/nope", map[string]string{}},
+		{http.MethodGet, "/ls", nil},
+	}
+	seen := map[string]bool{}
+	for _, tc := range cases {
+		_, header, out := callWithHeaders(t, client, tc.method, base+tc.path, tc.body, nil)
+		id := header.Get(requestIDHeader)
+		if id == "" || seen[id] {
+			t.Fatalf("%s %s: missing or repeated request id %q body=%s", tc.method, tc.path, id, string(out))
+		}
+		seen[id] = true
+		if !strings.HasPrefix(header.Get(serverTimingHeader), "app;dur=") {
+			t.Fatalf("%s %s: missing Server-Timing, got %q", tc.method, tc.path, header.Get(serverTimingHeader))
+		}
+	}
+
+	_, header, _ := callWithHeaders(t, client, http.MethodPost, base+"/ls", LsReq{Path: dir}, map[string]string{requestIDHeader: "agent-42"})
+	if header.Get(requestIDHeader) != "agent-42" {
+		t.Fatalf("caller request id not echoed: %q", header.Get(requestIDHeader))
+	}
+}
+
+func TestIdempotencyKeyReplaysUploadAppend(t *testing.T) {
+	base, client := startIdempotencyTestServer(t)
+	target := filepath.Join(t.TempDir(), "log.txt")
+	req := UploadReq{Path: target, Data: base64.StdEncoding.EncodeToString([]byte("chunk\n")), Append: true}
+	key := map[string]string{idempotencyKeyHeader: "upload-1"}
+
+	status1, h1, out1 := callWithHeaders(t, client, http.MethodPost, base+"/upload", req, key)
+	status2, h2, out2 := callWithHeaders(t, client, http.MethodPost, base+"/upload", req, key)
+	if status1 != 200 || status2 != 200 || !bytes.Equal(out1, out2) {
+		t.Fatalf("replay mismatch: %d %s / %d %s", status1, out1, status2, out2)
+	}
+	if h1.Get(idempotencyReplayedHeader) != "" || h2.Get(idempotencyReplayedHeader) != "true" {
+		t.Fatalf("replay header: first=%q second=%q", h1.Get(idempotencyReplayedHeader), h2.Get(idempotencyReplayedHeader))
+	}
+	if h1.Get(requestIDHeader) != h2.Get(requestIDHeader) {
+		t.Fatalf("replay should carry the original request id: %q vs %q", h1.Get(requestIDHeader), h2.Get(requestIDHeader))
+	}
+	assertFileContent(t, target, "chunk\n")
+
+	// The same key on another endpoint is independent.
+	if status, _, out := callWithHeaders(t, client, http.MethodPost, base+"/write", WriteReq{Path: target, Content: "new"}, key); status != 200 {
+		t.Fatalf("write with reused key on other path: %d %s", status, out)
+	}
+	assertFileContent(t, target, "new")
+
+	// Without a key every call applies.
+	callWithHeaders(t, client, http.MethodPost, base+"/upload", req, nil)
+	callWithHeaders(t, client, http.MethodPost, base+"/upload", req, nil)
+	assertFileContent(t, target, "newchunk\nchunk\n")
+}
+
+func TestIdempotencyKeyRejectsDifferentBody(t *testing.T) {
+	base, client := startIdempotencyTestServer(t)
+	target := filepath.Join(t.TempDir(), "f.txt")
+	key := map[string]string{idempotencyKeyHeader: "write-1"}
+
+	if status, _, out := callWithHeaders(t, client, http.MethodPost, base+"/write", WriteReq{Path: target, Content: "a"}, key); status != 200 {
+		t.Fatalf("first write: %d %s", status, out)
+	}
+	status, _, out := callWithHeaders(t, client, http.MethodPost, base+"/write", WriteReq{Path: target, Content: "b"}, key)
+	var body map[string]string
+	json.Unmarshal(out, &body)
+	if status != 409 || body["error_code"] != ErrorCodeConflict {
+		t.Fatalf("expected 409 conflict, got %d %s", status, out)
+	}
+	assertFileContent(t, target, "a")
+}
+
+func TestIdempotencyKeyConcurrentRetryRunsOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	base, client := startIdempotencyTestServer(t)
+	marker := filepath.Join(t.TempDir(), "hits")
+	req := ExecReq{Cmd: fmt.Sprintf("sleep 0.3; echo hit >> %s", marker)}
+	key := map[string]string{idempotencyKeyHeader: "exec-1"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status, _, out := callWithHeaders(t, client, http.MethodPost, base+"/exec", req, key); status != 200 {
+				t.Errorf("exec: %d %s", status, out)
+			}
+		}()
+	}
+	wg.Wait()
+	data, err := os.ReadFile(marker)
+	if err != nil {
+		t.Fatalf("read marker: %v", err)
+	}
+	if got := strings.Count(string(data), "hit"); got != 1 {
+		t.Fatalf("command ran %d times", got)
+	}
+}
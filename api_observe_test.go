@@ -371,3 +371,63 @@ func TestUploadAndDownload(t *testing.T) {
 		t.Fatalf("expected eof=true got=%v", dl.EOF)
 	}
 }
+
+func TestAPIVersionedErrorStatuses(t *testing.T) {
+	s := NewAPIServer("127.0.0.1", 20980, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+
+	base := fmt.Sprintf("http://127.0.0.1:%d", s.Port())
+	client := &http.Client{Timeout: 8 * time.Second}
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.txt")
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     any
+		status   int
+		wantCode string
+	}{
+		{name: "legacy read miss", method: http.MethodPost, path: "/read", body: ReadReq{Path: missing}, status: 200, wantCode: ErrorCodeNotFound},
+		{name: "v1 read miss", method: http.MethodPost, path: "/v1/read", body: ReadReq{Path: missing}, status: 200, wantCode: ErrorCodeNotFound},
+		{name: "v2 read miss", method: http.MethodPost, path: "/v2/read", body: ReadReq{Path: missing}, status: 404, wantCode: ErrorCodeNotFound},
+		{name: "v1 edit miss", method: http.MethodPost, path: "/v1/edit", body: EditReq{Path: missing, StartLine: 1}, status: 400, wantCode: ErrorCodeNotFound},
+		{name: "v2 edit miss", method: http.MethodPost, path: "/v2/edit", body: EditReq{Path: missing, StartLine: 1}, status: 404, wantCode: ErrorCodeNotFound},
+		{name: "v1 read dir", method: http.MethodPost, path: "/v1/read", body: ReadReq{Path: dir}, status: 400, wantCode: ErrorCodeIsDirectory},
+		{name: "v2 missing field", method: http.MethodPost, path: "/v2/ls", body: LsReq{}, status: 400, wantCode: ErrorCodeInvalidRequest},
+		{name: "v2 wrong method", method: http.MethodGet, path: "/v2/ls", status: 405, wantCode: ErrorCodeMethodNotAllowed},
+		{name: "v2 unknown path", method: http.MethodPost, path: "/v2/nope", body: map[string]string{}, status: 404, wantCode: ErrorCodeNotFound},
+	}
+	for _, tc := range tests {
+		status, out := callRaw(t, client, tc.method, base+tc.path, tc.body)
+		if status != tc.status {
+			t.Fatalf("%s: status=%d want %d body=%s", tc.name, status, tc.status, string(out))
+		}
+		var body map[string]string
+		if err := json.Unmarshal(out, &body); err != nil {
+			t.Fatalf("%s: unmarshal failed: %v body=%s", tc.name, err, string(out))
+		}
+		if body["error"] == "" || body["error_code"] != tc.wantCode {
+			t.Fatalf("%s: expected error_code=%q, got body=%s", tc.name, tc.wantCode, string(out))
+		}
+	}
+
+	// Legacy routes keep the plain-text method error.
+	status, out := callRaw(t, client, http.MethodGet, base+"/ls", nil)
+	if status != 405 || strings.Contains(string(out), "error_code") {
+		t.Fatalf("legacy method error changed: status=%d body=%s", status, string(out))
+	}
+
+	// A /v2 batch runs its items with /v2 statuses.
+	status, out = callRaw(t, client, http.MethodPost, base+"/v2/batch", BatchReq{Requests: []BatchItem{
+		{Path: "/read", Body: json.RawMessage(fmt.Sprintf(`{"path":%q}`, missing))},
+	}})
+	var batch BatchResp
+	if status != 200 || json.Unmarshal(out, &batch) != nil || batch.Results[0].Status != 404 || batch.Results[0].ErrorCode != ErrorCodeNotFound {
+		t.Fatalf("v2 batch: status=%d body=%s", status, string(out))
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ReadDefaultMaxBytes = 4 * 1024 * 1024
+	ReadMaxBytesLimit   = 32 * 1024 * 1024
+
+	readSniffBytes = 8 * 1024
+	readTailBlock  = 64 * 1024
+)
+
+// readWindow is the result of one /read call independent of the mode used.
+// TotalLines is -1 when the mode does not scan the whole file.
+type readWindow struct {
+	Content    string
+	TotalLines int
+	ByteOffset int64
+	Bytes      int64
+	EOF        bool
+	Truncated  bool
+}
+
+func normalizeReadMaxBytes(n int) int {
+	if n <= 0 {
+		return ReadDefaultMaxBytes
+	}
+	if n > ReadMaxBytesLimit {
+		return ReadMaxBytesLimit
+	}
+	return n
+}
+
+// looksBinary applies the same heuristic as git: NUL bytes mean binary. A high
+// share of other control characters also counts, so that legacy-encoded text
+// (GBK, Latin-1) is still readable while executables and images are not.
+func looksBinary(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	if bytes.IndexByte(b, 0) >= 0 {
+		return true
+	}
+	ctrl := 0
+	for _, c := range b {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' && c != '\f' && c != '\b' && c != 0x1b {
+			ctrl++
+		}
+	}
+	return ctrl*10 > len(b)
+}
+
+func sniffBinaryFile(f *os.File) (bool, error) {
+	buf := make([]byte, readSniffBytes)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return looksBinary(buf[:n]), nil
+}
+
+func trimLineEnding(b []byte) string {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	b = bytes.TrimSuffix(b, []byte("\r"))
+	return string(b)
+}
+
+// readLineRange streams f and returns lines [offset, offset+limit) while
+// counting all lines, so memory stays bounded by maxBytes regardless of file
+// or line length. limit <= 0 reads to the end of the file.
+func readLineRange(f *os.File, offset, limit, maxBytes int) (readWindow, error) {
+	res := readWindow{ByteOffset: -1}
+	rd := bufio.NewReaderSize(f, 64*1024)
+
+	var lines []string
+	var cur []byte
+	used := 0
+	var pos, windowEnd int64
+	lineOpen := false
+	for {
+		chunk, err := rd.ReadSlice('\n')
+		if len(chunk) > 0 {
+			lineOpen = true
+			inWindow := res.TotalLines >= offset && (limit <= 0 || res.TotalLines < offset+limit)
+			if inWindow && !res.Truncated {
+				if res.ByteOffset < 0 {
+					res.ByteOffset = pos
+				}
+				if used+len(cur)+len(chunk) > maxBytes {
+					res.Truncated = true
+					cur = nil
+				} else {
+					cur = append(cur, chunk...)
+				}
+			}
+			pos += int64(len(chunk))
+			if chunk[len(chunk)-1] == '\n' {
+				if inWindow && !res.Truncated {
+					lines = append(lines, trimLineEnding(cur))
+					used += len(cur)
+					windowEnd = pos
+				}
+				cur = cur[:0]
+				lineOpen = false
+				res.TotalLines++
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	if lineOpen {
+		if res.TotalLines >= offset && (limit <= 0 || res.TotalLines < offset+limit) && !res.Truncated {
+			lines = append(lines, trimLineEnding(cur))
+			windowEnd = pos
+		}
+		res.TotalLines++
+	}
+
+	if res.ByteOffset < 0 {
+		res.ByteOffset = pos
+		windowEnd = pos
+	}
+	res.Content = strings.Join(lines, "\n")
+	res.Bytes = windowEnd - res.ByteOffset
+	res.EOF = windowEnd == pos
+	return res, nil
+}
+
+// readTailLines returns the last n lines of f by reading backwards from the
+// end, so only about maxBytes of a multi-GB log is touched.
+func readTailLines(f *os.File, size int64, n, maxBytes int) (readWindow, error) {
+	res := readWindow{TotalLines: -1, EOF: true, ByteOffset: size}
+	if size == 0 || n <= 0 {
+		return res, nil
+	}
+
+	var buf []byte
+	pos := size
+	trail := 0
+	for pos > 0 {
+		step := int64(readTailBlock)
+		if int64(len(buf)) > step {
+			step = int64(len(buf))
+		}
+		if step > pos {
+			step = pos
+		}
+		pos -= step
+		block := make([]byte, step, int64(len(buf))+step)
+		if _, err := f.ReadAt(block, pos); err != nil && err != io.EOF {
+			return res, err
+		}
+		buf = append(block, buf...)
+		if pos+int64(len(buf)) == size && trail == 0 && buf[len(buf)-1] == '\n' {
+			trail = 1
+		}
+		if bytes.Count(buf[:len(buf)-trail], []byte("\n")) >= n || len(buf) > maxBytes {
+			break
+		}
+	}
+
+	body := buf[:len(buf)-trail]
+	start := 0
+	idx := len(body)
+	for i := 0; i < n; i++ {
+		j := bytes.LastIndexByte(body[:idx], '\n')
+		if j < 0 {
+			idx = -1
+			break
+		}
+		idx = j
+	}
+	if idx >= 0 {
+		start = idx + 1
+	} else if pos > 0 {
+		// Fewer than n lines fit in what was read: drop the leading partial line.
+		if j := bytes.IndexByte(body, '\n'); j >= 0 {
+			start = j + 1
+		} else {
+			start = len(buf)
+		}
+		res.Truncated = true
+	}
+	if len(buf)-start > maxBytes {
+		res.Truncated = true
+		cut := len(buf) - maxBytes
+		if buf[cut-1] == '\n' {
+			start = cut
+		} else if j := bytes.IndexByte(buf[cut:], '\n'); j >= 0 {
+			start = cut + j + 1
+		} else {
+			start = len(buf)
+		}
+	}
+
+	res.ByteOffset = pos + int64(start)
+	res.Bytes = size - res.ByteOffset
+	if start < len(body) {
+		parts := bytes.Split(body[start:], []byte("\n"))
+		lines := make([]string, len(parts))
+		for i, p := range parts {
+			lines[i] = trimLineEnding(p)
+		}
+		res.Content = strings.Join(lines, "\n")
+	}
+	return res, nil
+}
+
+// readByteRange returns raw bytes [offset, offset+limit). When the range
+// splits a UTF-8 sequence the partial runes at either end are dropped and
+// ByteOffset/Bytes describe what was actually returned.
+func readByteRange(f *os.File, size, offset int64, limit int) (readWindow, []byte, error) {
+	res := readWindow{TotalLines: -1}
+	if offset < 0 || offset > size {
+		return res, nil, fmt.Errorf("byte_offset %d out of range [0, %d]", offset, size)
+	}
+	if int64(limit) > size-offset {
+		limit = int(size - offset)
+	}
+	data := make([]byte, limit)
+	n, err := f.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return res, nil, err
+	}
+	data = data[:n]
+
+	if !utf8.Valid(data) {
+		lead := 0
+		for lead < len(data) && lead < utf8.UTFMax-1 && !utf8.RuneStart(data[lead]) {
+			lead++
+		}
+		end := len(data)
+		for i := len(data) - 1; i >= lead && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					end = i
+				}
+				break
+			}
+		}
+		if adjusted := data[lead:end]; utf8.Valid(adjusted) {
+			offset += int64(lead)
+			data = adjusted
+		}
+	}
+
+	res.Content = string(data)
+	res.ByteOffset = offset
+	res.Bytes = int64(len(data))
+	res.EOF = offset+res.Bytes >= size
+	return res, data, nil
+}
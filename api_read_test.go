@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestFile(t *testing.T, content string) (*os.File, int64) {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "f.txt")
+	mustWriteFile(t, p, content)
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f, int64(len(content))
+}
+
+func TestReadLineRangeHandlesLongLinesAndBudget(t *testing.T) {
+	long := strings.Repeat("x", 2*1024*1024)
+	f, _ := openTestFile(t, "a\r\n"+long+"\nc\nd")
+
+	win, err := readLineRange(f, 2, 0, ReadDefaultMaxBytes)
+	if err != nil {
+		t.Fatalf("readLineRange failed: %v", err)
+	}
+	if win.Content != "c\nd" || win.TotalLines != 4 || !win.EOF || win.ByteOffset != int64(3+len(long)+1) {
+		t.Fatalf("window mismatch: got=%+v", win)
+	}
+
+	f.Seek(0, 0)
+	win, err = readLineRange(f, 0, 3, 1024)
+	if err != nil {
+		t.Fatalf("readLineRange failed: %v", err)
+	}
+	if win.Content != "a" || !win.Truncated || win.EOF || win.TotalLines != 4 || win.Bytes != 3 {
+		t.Fatalf("truncated window mismatch: got=%+v", win)
+	}
+}
+
+func TestReadTailLines(t *testing.T) {
+	cases := []struct {
+		content  string
+		n        int
+		maxBytes int
+		want     string
+		offset   int64
+	}{
+		{"1\n2\n3\n", 2, 1024, "2\n3", 2},
+		{"1\n2\n3", 2, 1024, "2\n3", 2},
+		{"1\n2\n3\n", 10, 1024, "1\n2\n3", 0},
+		{"aaaa\nbb\ncc\n", 3, 6, "bb\ncc", 5},
+	}
+	for _, tc := range cases {
+		f, size := openTestFile(t, tc.content)
+		win, err := readTailLines(f, size, tc.n, tc.maxBytes)
+		if err != nil {
+			t.Fatalf("readTailLines failed: %v", err)
+		}
+		if win.Content != tc.want || win.ByteOffset != tc.offset {
+			t.Fatalf("tail(%q, %d) mismatch: got=%+v want content=%q offset=%d", tc.content, tc.n, win, tc.want, tc.offset)
+		}
+	}
+}
+
+func TestReadByteRangeKeepsRunesWhole(t *testing.T) {
+	f, size := openTestFile(t, "ab中文cd")
+	// Offset 3 lands inside 中; the range then ends cleanly after "文c".
+	win, _, err := readByteRange(f, size, 3, 6)
+	if err != nil {
+		t.Fatalf("readByteRange failed: %v", err)
+	}
+	if win.Content != "文c" || win.ByteOffset != 5 || win.Bytes != 4 || win.EOF {
+		t.Fatalf("byte range mismatch: got=%+v", win)
+	}
+
+	// A range ending inside 文 drops the partial rune.
+	win, _, err = readByteRange(f, size, 0, 6)
+	if err != nil {
+		t.Fatalf("readByteRange failed: %v", err)
+	}
+	if win.Content != "ab中" || win.Bytes != 5 {
+		t.Fatalf("byte range mismatch: got=%+v", win)
+	}
+}
+
+func TestAPIReadBinaryAndRangeErrors(t *testing.T) {
+	s := NewAPIServer("127.0.0.1", 20080, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	base := fmt.Sprintf("http://127.0.0.1:%d", s.Port())
+	client := &http.Client{Timeout: 8 * time.Second}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "app.bin")
+	if err := os.WriteFile(bin, []byte{0x7f, 'E', 'L', 'F', 0, 0, 1}, 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	text := filepath.Join(dir, "a.txt")
+	mustWriteFile(t, text, "hello\n")
+
+	status, out := callRaw(t, client, http.MethodPost, base+"/read", ReadReq{Path: bin})
+	var errResp map[string]string
+	json.Unmarshal(out, &errResp)
+	if status != http.StatusOK || errResp["error_code"] != ErrorCodeBinaryFile {
+		t.Fatalf("binary read mismatch: status=%d body=%s", status, out)
+	}
+
+	offset := int64(100)
+	status, out = callRaw(t, client, http.MethodPost, base+"/read", ReadReq{Path: text, ByteOffset: &offset})
+	errResp = nil
+	json.Unmarshal(out, &errResp)
+	if status != http.StatusBadRequest || errResp["error_code"] != ErrorCodeInvalidRange {
+		t.Fatalf("range read mismatch: status=%d body=%s", status, out)
+	}
+
+	status, out = callRaw(t, client, http.MethodPost, base+"/read", ReadReq{Path: text, Tail: 1})
+	var resp ReadResp
+	json.Unmarshal(out, &resp)
+	if status != http.StatusOK || resp.Content != "hello" || resp.TotalLines != -1 || resp.TotalBytes != 6 {
+		t.Fatalf("tail read mismatch: status=%d body=%s", status, out)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+)
+
+type SyncManifestReq struct {
+	Path      string   `json:"path"`
+	Exclude   []string `json:"exclude,omitempty"`
+	BlockSize int      `json:"block_size,omitempty"`
+}
+
+type SyncPutReq struct {
+	Root   string `json:"root"`
+	Path   string `json:"path"`
+	IsDir  bool   `json:"is_dir,omitempty"`
+	Data   string `json:"data,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Final  bool   `json:"final,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Mtime  int64  `json:"mtime,omitempty"`
+	Mode   uint32 `json:"mode,omitempty"`
+	RunAs  string `json:"run_as,omitempty"`
+}
+
+type SyncDeleteReq struct {
+	Root  string   `json:"root"`
+	Paths []string `json:"paths"`
+	RunAs string   `json:"run_as,omitempty"`
+}
+
+type SyncDeleteResp struct {
+	Deleted int `json:"deleted"`
+}
+
+func (s *APIServer) handleSyncManifest(w http.ResponseWriter, r *http.Request) {
+	var req SyncManifestReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	if req.Path == "" {
+		jsonErr(w, "path is required", 400)
+		return
+	}
+
+	manifest, err := buildSyncManifest(req.Path, req.Exclude, req.BlockSize)
+	if err != nil {
+		apiErr(w, err, 500)
+		return
+	}
+
+	s.addLog("POST", "/sync/manifest", fmt.Sprintf("%s (%d entries)", truncate(req.Path, 60), len(manifest.Entries)))
+	json.NewEncoder(w).Encode(manifest)
+}
+
+func (s *APIServer) handleSyncPut(w http.ResponseWriter, r *http.Request) {
+	var req SyncPutReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	if req.Root == "" || req.Path == "" {
+		jsonErr(w, "root and path are required", 400)
+		return
+	}
+	target, err := resolveUnderRoot(req.Root, req.Path)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+	id, err := resolveRunAs(req.RunAs)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+
+	if req.IsDir {
+		if err := id.mkdirAll(target); err != nil {
+			apiErr(w, err, 500)
+			return
+		}
+		applySyncAttrs(target, req.Mode, req.Mtime)
+		s.addLog("POST", "/sync/put", truncate(target, 80)+"/")
+		json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(req.Data)
+	if err != nil {
+		jsonErr(w, "data must be base64", 400)
+		return
+	}
+	if req.Offset < 0 {
+		jsonErr(w, "offset must not be negative", 400)
+		return
+	}
+	existed, err := id.prepareWrite(target)
+	if err != nil {
+		apiErr(w, err, 403)
+		return
+	}
+	if err := id.mkdirAll(filepath.Dir(target)); err != nil {
+		apiErr(w, err, 500)
+		return
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		apiErr(w, err, 500)
+		return
+	}
+	if len(data) > 0 {
+		if _, err := f.WriteAt(data, req.Offset); err != nil {
+			f.Close()
+			apiErr(w, err, 500)
+			return
+		}
+	}
+	if req.Final {
+		if err := f.Truncate(req.Size); err != nil {
+			f.Close()
+			apiErr(w, err, 500)
+			return
+		}
+	}
+	if err := f.Close(); err != nil {
+		apiErr(w, err, 500)
+		return
+	}
+	if err := id.chownCreated(target, existed); err != nil {
+		apiErr(w, err, 500)
+		return
+	}
+	if req.Final {
+		applySyncAttrs(target, req.Mode, req.Mtime)
+		// Only the final chunk is logged to keep the command log readable.
+		s.addLog("POST", "/sync/put", fmt.Sprintf("%s (%d bytes)", truncate(target, 60), req.Size))
+	}
+	json.NewEncoder(w).Encode(UploadResp{OK: true, Bytes: len(data)})
+}
+
+func (s *APIServer) handleSyncDelete(w http.ResponseWriter, r *http.Request) {
+	var req SyncDeleteReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	if req.Root == "" {
+		jsonErr(w, "root is required", 400)
+		return
+	}
+	id, err := resolveRunAs(req.RunAs)
+	if err != nil {
+		apiErr(w, err, 400)
+		return
+	}
+
+	targets := make([]string, 0, len(req.Paths))
+	for _, rel := range req.Paths {
+		target, err := resolveUnderRoot(req.Root, rel)
+		if err != nil {
+			apiErr(w, err, 400)
+			return
+		}
+		if err := id.prepareRemove(target); err != nil {
+			apiErr(w, err, 403)
+			return
+		}
+		targets = append(targets, target)
+	}
+	// Remove deepest paths first so directories are empty when reached.
+	sort.Slice(targets, func(i, j int) bool { return len(targets[i]) > len(targets[j]) })
+
+	deleted := 0
+	for _, target := range targets {
+		if err := os.RemoveAll(target); err != nil {
+			apiErr(w, err, 500)
+			return
+		}
+		deleted++
+	}
+
+	s.addLog("POST", "/sync/delete", fmt.Sprintf("%s (%d paths)", truncate(req.Root, 60), deleted))
+	json.NewEncoder(w).Encode(SyncDeleteResp{Deleted: deleted})
+}
+
+func applySyncAttrs(target string, mode uint32, mtime int64) {
+	if mode != 0 && runtime.GOOS != "windows" {
+		_ = os.Chmod(target, os.FileMode(mode).Perm())
+	}
+	if mtime > 0 {
+		ts := time.Unix(mtime, 0)
+		_ = os.Chtimes(target, ts, ts)
+	}
+}
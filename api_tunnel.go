@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tunnel streams ride on the API port: a POST /tunnel with
+// "Upgrade: telehand-tunnel" is answered with 101 and the connection then
+// carries raw bytes. Every forward holds one control stream open for its
+// lifetime; closing it tears the forward and its connections down.
+const (
+	tunnelUpgradeToken = "telehand-tunnel"
+	tunnelIDHeader     = "X-Tunnel-Id"
+	tunnelAddrHeader   = "X-Tunnel-Addr"
+
+	TunnelModeLocal   = "local"   // control: receiver dials host:port per connection
+	TunnelModeRemote  = "remote"  // control: receiver listens on bind:port
+	TunnelModeConnect = "connect" // data: one connection of a local forward
+	TunnelModeAccept  = "accept"  // data: claims a pending connection of a remote forward
+
+	tunnelDialTimeout     = 10 * time.Second
+	tunnelPendingTimeout  = 30 * time.Second
+	tunnelControlInterval = 30 * time.Second
+)
+
+type TunnelReq struct {
+	Mode string `json:"mode"`
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port,omitempty"`
+	Bind string `json:"bind,omitempty"`
+	ID   int    `json:"id,omitempty"`
+	Conn int    `json:"conn,omitempty"`
+}
+
+// TunnelInfo describes an active forward for the GUI.
+type TunnelInfo struct {
+	ID          int    `json:"id"`
+	Kind        string `json:"kind"`
+	Addr        string `json:"addr"`
+	Client      string `json:"client"`
+	ActiveConns int    `json:"active_conns"`
+	TotalConns  int    `json:"total_conns"`
+	BytesIn     int64  `json:"bytes_in"`
+	BytesOut    int64  `json:"bytes_out"`
+	Since       string `json:"since"`
+}
+
+type tunnelForward struct {
+	id       int
+	kind     string
+	addr     string
+	client   string
+	since    time.Time
+	listener net.Listener
+	control  net.Conn
+
+	mu       sync.Mutex
+	closed   bool
+	nextConn int
+	pending  map[int]net.Conn
+	conns    map[net.Conn]struct{}
+	total    int
+	bytesIn  atomic.Int64 // initiator -> receiver service
+	bytesOut atomic.Int64
+}
+
+func (f *tunnelForward) info() TunnelInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return TunnelInfo{
+		ID:          f.id,
+		Kind:        f.kind,
+		Addr:        f.addr,
+		Client:      f.client,
+		ActiveConns: len(f.conns),
+		TotalConns:  f.total,
+		BytesIn:     f.bytesIn.Load(),
+		BytesOut:    f.bytesOut.Load(),
+		Since:       f.since.Format("15:04:05"),
+	}
+}
+
+// track registers conns as one active tunnelled connection; it reports false
+// once the forward is closing.
+func (f *tunnelForward) track(conns ...net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false
+	}
+	for _, c := range conns {
+		f.conns[c] = struct{}{}
+	}
+	f.total++
+	return true
+}
+
+func (f *tunnelForward) untrack(conns ...net.Conn) {
+	f.mu.Lock()
+	for _, c := range conns {
+		delete(f.conns, c)
+	}
+	f.mu.Unlock()
+}
+
+func (f *tunnelForward) close() {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.closed = true
+	conns := make([]net.Conn, 0, len(f.conns)+len(f.pending))
+	for c := range f.conns {
+		conns = append(conns, c)
+	}
+	for _, c := range f.pending {
+		conns = append(conns, c)
+	}
+	f.mu.Unlock()
+	if f.listener != nil {
+		f.listener.Close()
+	}
+	if f.control != nil {
+		f.control.Close()
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// Tunnels lists active forwards ordered by id.
+func (s *APIServer) Tunnels() []TunnelInfo {
+	s.mu.Lock()
+	forwards := make([]*tunnelForward, 0, len(s.tunnels))
+	for _, f := range s.tunnels {
+		forwards = append(forwards, f)
+	}
+	s.mu.Unlock()
+	out := make([]TunnelInfo, 0, len(forwards))
+	for _, f := range forwards {
+		out = append(out, f.info())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (s *APIServer) lookupTunnel(id int, kind string) *tunnelForward {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.tunnels[id]
+	if f == nil || f.kind != kind {
+		return nil
+	}
+	return f
+}
+
+func (s *APIServer) handleTunnel(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), tunnelUpgradeToken) {
+		jsonErr(w, "tunnel requires Upgrade: "+tunnelUpgradeToken, 400)
+		return
+	}
+	var req TunnelReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+
+	switch req.Mode {
+	case TunnelModeLocal, TunnelModeRemote:
+		// A remote forward may ask for port 0 and read the chosen port back.
+		if req.Port < 0 || req.Port > 65535 || (req.Port == 0 && req.Mode == TunnelModeLocal) {
+			jsonErr(w, "port must be between 1 and 65535", 400)
+			return
+		}
+		s.serveTunnelControl(w, r, req)
+	case TunnelModeConnect:
+		f := s.lookupTunnel(req.ID, TunnelModeLocal)
+		if f == nil {
+			jsonErrWithCode(w, fmt.Sprintf("forward %d not found", req.ID), ErrorCodeNotFound, 200)
+			return
+		}
+		target, err := net.DialTimeout("tcp", f.addr, tunnelDialTimeout)
+		if err != nil {
+			apiErr(w, err, 502)
+			return
+		}
+		conn, err := hijackTunnel(w, nil)
+		if err != nil {
+			target.Close()
+			return
+		}
+		pipeTunnel(f, conn, target)
+	case TunnelModeAccept:
+		f := s.lookupTunnel(req.ID, TunnelModeRemote)
+		if f == nil {
+			jsonErrWithCode(w, fmt.Sprintf("forward %d not found", req.ID), ErrorCodeNotFound, 200)
+			return
+		}
+		f.mu.Lock()
+		target := f.pending[req.Conn]
+		delete(f.pending, req.Conn)
+		f.mu.Unlock()
+		if target == nil {
+			jsonErrWithCode(w, fmt.Sprintf("connection %d not found", req.Conn), ErrorCodeNotFound, 200)
+			return
+		}
+		conn, err := hijackTunnel(w, nil)
+		if err != nil {
+			target.Close()
+			return
+		}
+		pipeTunnel(f, conn, target)
+	default:
+		jsonErr(w, "mode must be local, remote, connect or accept", 400)
+	}
+}
+
+func (s *APIServer) serveTunnelControl(w http.ResponseWriter, r *http.Request, req TunnelReq) {
+	host := strings.TrimSpace(req.Host)
+	if req.Mode == TunnelModeRemote {
+		host = strings.TrimSpace(req.Bind)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	f := &tunnelForward{
+		kind:    req.Mode,
+		addr:    net.JoinHostPort(host, strconv.Itoa(req.Port)),
+		client:  r.RemoteAddr,
+		since:   time.Now(),
+		pending: make(map[int]net.Conn),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	if req.Mode == TunnelModeRemote {
+		ln, err := net.Listen("tcp", f.addr)
+		if err != nil {
+			apiErr(w, err, 500)
+			return
+		}
+		f.listener = ln
+		// Report the real address when port 0 asked the OS to choose.
+		f.addr = ln.Addr().String()
+	}
+
+	s.mu.Lock()
+	s.nextTunnel++
+	f.id = s.nextTunnel
+	if s.tunnels == nil {
+		s.tunnels = make(map[int]*tunnelForward)
+	}
+	s.tunnels[f.id] = f
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.tunnels, f.id)
+		s.mu.Unlock()
+		f.close()
+		s.addLog("POST", "/tunnel", fmt.Sprintf("closed %s %s", f.kind, f.addr))
+	}()
+
+	conn, err := hijackTunnel(w, http.Header{
+		tunnelIDHeader:   {strconv.Itoa(f.id)},
+		tunnelAddrHeader: {f.addr},
+	})
+	if err != nil {
+		return
+	}
+	f.control = conn
+	s.addLog("POST", "/tunnel", fmt.Sprintf("%s %s from %s", f.kind, f.addr, f.client))
+
+	var writeMu sync.Mutex
+	send := func(line string) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(tunnelDialTimeout))
+		_, err := io.WriteString(conn, line+"\n")
+		return err
+	}
+	if f.listener != nil {
+		go f.acceptLoop(send)
+	}
+
+	// The initiator never writes on the control stream; a read returning
+	// means it went away. Pings catch peers that vanished without a FIN.
+	done := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(done)
+	}()
+	ticker := time.NewTicker(tunnelControlInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if send("ping") != nil {
+				return
+			}
+		}
+	}
+}
+
+// acceptLoop parks each connection to a remote forward and asks the
+// initiator to claim it with an accept stream.
+func (f *tunnelForward) acceptLoop(send func(string) error) {
+	for {
+		c, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			c.Close()
+			return
+		}
+		f.nextConn++
+		id := f.nextConn
+		f.pending[id] = c
+		f.mu.Unlock()
+
+		if send(fmt.Sprintf("conn %d", id)) != nil {
+			f.close()
+			return
+		}
+		time.AfterFunc(tunnelPendingTimeout, func() {
+			f.mu.Lock()
+			stale := f.pending[id]
+			delete(f.pending, id)
+			f.mu.Unlock()
+			if stale != nil {
+				stale.Close()
+			}
+		})
+	}
+}
+
+// tunnelConn is a hijacked connection that drains bytes the HTTP server had
+// already buffered before reading from the socket.
+type tunnelConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *tunnelConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c *tunnelConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func hijackTunnel(w http.ResponseWriter, header http.Header) (net.Conn, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		jsonErrWithCode(w, "tunnel is not supported by this connection", ErrorCodeUnsupported, 500)
+		return nil, fmt.Errorf("hijack not supported")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + tunnelUpgradeToken + "\r\n")
+	for k, vs := range header {
+		for _, v := range vs {
+			b.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return &tunnelConn{Conn: conn, r: rw.Reader}, nil
+}
+
+// pipeTunnel pipes a tunnel stream to its target while counting it against
+// the forward.
+func pipeTunnel(f *tunnelForward, tunnel, target net.Conn) {
+	if !f.track(tunnel, target) {
+		tunnel.Close()
+		target.Close()
+		return
+	}
+	defer f.untrack(tunnel, target)
+	in, out := pipeConns(tunnel, target)
+	f.bytesIn.Add(in)
+	f.bytesOut.Add(out)
+}
+
+// pipeConns copies both directions until each side finishes, propagating
+// half-closes so request/response protocols see EOF, then closes both.
+func pipeConns(a, b net.Conn) (aToB, bToA int64) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		aToB, _ = io.Copy(b, a)
+		closeWrite(b)
+	}()
+	go func() {
+		defer wg.Done()
+		bToA, _ = io.Copy(a, b)
+		closeWrite(a)
+	}()
+	wg.Wait()
+	a.Close()
+	b.Close()
+	return aToB, bToA
+}
+
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	c.Close()
+}
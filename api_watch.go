@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	watchDefaultInterval = 500 * time.Millisecond
+	watchMinInterval     = 100 * time.Millisecond
+	watchKeepalive       = 15 * time.Second
+	watchMaxLineBytes    = 64 * 1024
+)
+
+type WatchReq struct {
+	Paths      []string `json:"paths"`
+	Recursive  bool     `json:"recursive,omitempty"`
+	Exclude    []string `json:"exclude,omitempty"`
+	IntervalMs int      `json:"interval_ms,omitempty"`
+	TimeoutSec int      `json:"timeout_sec,omitempty"`
+	Tail       bool     `json:"tail,omitempty"`
+	Offset     *int64   `json:"offset,omitempty"`
+}
+
+type WatchEvent struct {
+	Type  string `json:"type"`
+	Path  string `json:"path"`
+	IsDir bool   `json:"is_dir"`
+	Size  int64  `json:"size"`
+	Mtime int64  `json:"mtime"`
+}
+
+type WatchLine struct {
+	Offset int64  `json:"offset"`
+	Line   string `json:"line"`
+}
+
+type watchStat struct {
+	IsDir bool
+	Size  int64
+	Mtime time.Time
+}
+
+func (s *APIServer) handleWatch(w http.ResponseWriter, r *http.Request) {
+	var req WatchReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	if len(req.Paths) == 0 {
+		jsonErr(w, "paths is required", 400)
+		return
+	}
+	if req.Tail && len(req.Paths) != 1 {
+		jsonErr(w, "tail mode requires exactly one path", 400)
+		return
+	}
+	if req.Tail {
+		info, err := os.Stat(req.Paths[0])
+		if err != nil {
+			if os.IsNotExist(err) {
+				apiErr(w, err, 200)
+				return
+			}
+			apiErr(w, err, 500)
+			return
+		}
+		if info.IsDir() {
+			jsonErrWithCode(w, "tail mode requires a file", ErrorCodeIsDirectory, 400)
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonErrWithCode(w, "streaming not supported", ErrorCodeUnsupported, 500)
+		return
+	}
+
+	interval := watchDefaultInterval
+	if req.IntervalMs > 0 {
+		interval = time.Duration(req.IntervalMs) * time.Millisecond
+		if interval < watchMinInterval {
+			interval = watchMinInterval
+		}
+	}
+	var deadline <-chan time.Time
+	if req.TimeoutSec > 0 {
+		timer := time.NewTimer(time.Duration(req.TimeoutSec) * time.Second)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	mode := "watch"
+	if req.Tail {
+		mode = "tail"
+	}
+	s.addLog("POST", "/watch", fmt.Sprintf("%s %s", mode, truncate(strings.Join(req.Paths, ","), 70)))
+
+	var step func() []sseMessage
+	if req.Tail {
+		t := newWatchTail(req.Paths[0], req.Offset)
+		step = t.poll
+	} else {
+		prev := watchSnapshot(req.Paths, req.Recursive, req.Exclude)
+		step = func() []sseMessage {
+			cur := watchSnapshot(req.Paths, req.Recursive, req.Exclude)
+			events := diffWatchSnapshots(prev, cur)
+			prev = cur
+			out := make([]sseMessage, 0, len(events))
+			for _, ev := range events {
+				out = append(out, sseMessage{Event: "change", Data: ev})
+			}
+			return out
+		}
+	}
+
+	if err := writeSSE(w, "ready", map[string]any{"mode": mode, "paths": req.Paths}); err != nil {
+		return
+	}
+	// Tail mode may already have lines to send when starting from an offset.
+	if req.Tail {
+		for _, msg := range step() {
+			if err := writeSSE(w, msg.Event, msg.Data); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline:
+			writeSSE(w, "timeout", map[string]int{"timeout_sec": req.TimeoutSec})
+			flusher.Flush()
+			return
+		case <-ticker.C:
+		}
+		msgs := step()
+		for _, msg := range msgs {
+			if err := writeSSE(w, msg.Event, msg.Data); err != nil {
+				return
+			}
+		}
+		if len(msgs) == 0 && time.Since(lastWrite) >= watchKeepalive {
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		} else if len(msgs) == 0 {
+			continue
+		}
+		lastWrite = time.Now()
+		flusher.Flush()
+	}
+}
+
+type sseMessage struct {
+	Event string
+	Data  any
+}
+
+func writeSSE(w io.Writer, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+// watchSnapshot stats every watched path. Directories contribute their
+// children (all descendants when recursive); missing paths are simply absent
+// so that their later creation shows up as a create event.
+func watchSnapshot(paths []string, recursive bool, excludes []string) map[string]watchStat {
+	out := make(map[string]watchStat)
+	for _, root := range paths {
+		root = filepath.Clean(root)
+		info, err := os.Stat(root)
+		if err != nil {
+			continue
+		}
+		out[root] = watchStat{IsDir: info.IsDir(), Size: info.Size(), Mtime: info.ModTime()}
+		if !info.IsDir() {
+			continue
+		}
+		_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, walkErr error) error {
+			if walkErr != nil || p == root {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return nil
+			}
+			if matchSyncExclude(filepath.ToSlash(rel), d.IsDir(), excludes) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			out[p] = watchStat{IsDir: d.IsDir(), Size: fi.Size(), Mtime: fi.ModTime()}
+			if d.IsDir() && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+	return out
+}
+
+// diffWatchSnapshots reports creates, deletes and modifications between two
+// snapshots, sorted by path. Directory mtime changes are not reported since
+// the entries inside them already produce events.
+func diffWatchSnapshots(prev, cur map[string]watchStat) []WatchEvent {
+	var events []WatchEvent
+	for p, st := range cur {
+		old, ok := prev[p]
+		switch {
+		case !ok || old.IsDir != st.IsDir:
+			events = append(events, newWatchEvent("create", p, st))
+		case !st.IsDir && (old.Size != st.Size || !old.Mtime.Equal(st.Mtime)):
+			events = append(events, newWatchEvent("modify", p, st))
+		}
+	}
+	for p, st := range prev {
+		if _, ok := cur[p]; !ok {
+			events = append(events, newWatchEvent("delete", p, st))
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Path != events[j].Path {
+			return events[i].Path < events[j].Path
+		}
+		return events[i].Type < events[j].Type
+	})
+	return events
+}
+
+func newWatchEvent(typ, p string, st watchStat) WatchEvent {
+	return WatchEvent{Type: typ, Path: p, IsDir: st.IsDir, Size: st.Size, Mtime: st.Mtime.Unix()}
+}
+
+// watchTail follows appended lines of one file like `tail -f`, handling
+// truncation and replacement (log rotation) by restarting from offset 0.
+type watchTail struct {
+	path    string
+	offset  int64
+	pending []byte
+	missing bool
+	ident   os.FileInfo
+}
+
+func newWatchTail(p string, offset *int64) *watchTail {
+	t := &watchTail{path: p}
+	info, err := os.Stat(p)
+	if err != nil {
+		t.missing = true
+		return t
+	}
+	t.ident = info
+	t.offset = info.Size()
+	if offset != nil && *offset >= 0 && *offset < info.Size() {
+		t.offset = *offset
+	}
+	return t
+}
+
+func (t *watchTail) poll() []sseMessage {
+	var out []sseMessage
+	info, err := os.Stat(t.path)
+	if err != nil {
+		if !t.missing {
+			t.missing = true
+			out = append(out, sseMessage{Event: "change", Data: WatchEvent{Type: "delete", Path: t.path}})
+		}
+		return out
+	}
+	switch {
+	case t.missing:
+		t.missing = false
+		t.offset, t.pending = 0, nil
+		out = append(out, sseMessage{Event: "change", Data: newWatchEvent("create", t.path, watchStat{Size: info.Size(), Mtime: info.ModTime()})})
+	case t.ident != nil && !os.SameFile(t.ident, info):
+		t.offset, t.pending = 0, nil
+		out = append(out, sseMessage{Event: "change", Data: newWatchEvent("create", t.path, watchStat{Size: info.Size(), Mtime: info.ModTime()})})
+	case info.Size() < t.offset:
+		t.offset, t.pending = 0, nil
+		out = append(out, sseMessage{Event: "truncate", Data: map[string]int64{"size": info.Size()}})
+	}
+	t.ident = info
+	if info.Size() == t.offset {
+		return out
+	}
+
+	f, err := os.Open(t.path)
+	if err != nil {
+		return out
+	}
+	defer f.Close()
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return out
+	}
+	start := t.offset - int64(len(t.pending))
+	rd := bufio.NewReader(io.LimitReader(f, info.Size()-t.offset))
+	for {
+		chunk, err := rd.ReadSlice('\n')
+		t.offset += int64(len(chunk))
+		t.pending = append(t.pending, chunk...)
+		if err == bufio.ErrBufferFull && len(t.pending) < watchMaxLineBytes {
+			continue
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			// Incomplete last line: keep it until the newline arrives.
+			break
+		}
+		line := strings.TrimRight(string(t.pending), "\r\n")
+		out = append(out, sseMessage{Event: "line", Data: WatchLine{Offset: start, Line: line}})
+		start += int64(len(t.pending))
+		t.pending = nil
+	}
+	return out
+}
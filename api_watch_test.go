@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffWatchSnapshots(t *testing.T) {
+	t0 := time.Unix(100, 0)
+	prev := map[string]watchStat{
+		"/a":   {Size: 1, Mtime: t0},
+		"/b":   {Size: 1, Mtime: t0},
+		"/dir": {IsDir: true, Mtime: t0},
+	}
+	cur := map[string]watchStat{
+		"/a":   {Size: 2, Mtime: t0},
+		"/c":   {Size: 1, Mtime: t0},
+		"/dir": {IsDir: true, Mtime: t0.Add(time.Second)},
+	}
+	var got []string
+	for _, ev := range diffWatchSnapshots(prev, cur) {
+		got = append(got, ev.Type+" "+ev.Path)
+	}
+	want := "modify /a,delete /b,create /c"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("diffWatchSnapshots mismatch: got=%v want=%s", got, want)
+	}
+}
+
+func TestWatchTailFollowsAppendsAndTruncation(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "app.log")
+	mustWriteFile(t, p, "old\n")
+	tail := newWatchTail(p, nil)
+	if msgs := tail.poll(); len(msgs) != 0 {
+		t.Fatalf("tail should start at end of file: got=%v", msgs)
+	}
+
+	appendFile(t, p, "one\ntw")
+	assertTailLines(t, tail.poll(), "4:one")
+	appendFile(t, p, "o\n")
+	assertTailLines(t, tail.poll(), "8:two")
+
+	mustWriteFile(t, p, "new\n")
+	msgs := tail.poll()
+	if len(msgs) != 2 || msgs[0].Event != "truncate" {
+		t.Fatalf("truncate not reported: got=%v", msgs)
+	}
+	assertTailLines(t, msgs[1:], "0:new")
+}
+
+func TestAPIWatchStreamsChanges(t *testing.T) {
+	s := NewAPIServer("127.0.0.1", 19980, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+
+	dir := t.TempDir()
+	body, _ := json.Marshal(WatchReq{Paths: []string{dir}, IntervalMs: 100, TimeoutSec: 5})
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/watch", s.Port()), "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /watch failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type mismatch: got=%s", ct)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	event := ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "ready":
+			mustWriteFile(t, filepath.Join(dir, "new.txt"), "x")
+		case strings.HasPrefix(line, "data: ") && event == "change":
+			var ev WatchEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+				t.Fatalf("decode event failed: %v", err)
+			}
+			if ev.Type != "create" || ev.Path != filepath.Join(dir, "new.txt") {
+				t.Fatalf("event mismatch: got=%+v", ev)
+			}
+			return
+		case event == "timeout":
+			t.Fatalf("watch timed out without change event")
+		}
+	}
+	t.Fatalf("stream ended without change event: %v", sc.Err())
+}
+
+func appendFile(t *testing.T, p, content string) {
+	t.Helper()
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+}
+
+func assertTailLines(t *testing.T, msgs []sseMessage, want ...string) {
+	t.Helper()
+	var got []string
+	for _, msg := range msgs {
+		line, ok := msg.Data.(WatchLine)
+		if msg.Event != "line" || !ok {
+			t.Fatalf("unexpected tail message: %+v", msg)
+		}
+		got = append(got, fmt.Sprintf("%d:%s", line.Offset, line.Line))
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("tail lines mismatch: got=%v want=%v", got, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"math/big"
 	"os"
@@ -62,9 +63,43 @@ func buildEncodedConfigFromInputs(networkName, networkSecret, peers string) (str
 	return encoded, cfg, nil
 }
 
-func buildEncodedConfigWithDefaults(networkName, networkSecret, peers string) (string, *Config, error) {
-	name, secret, peerList := withDefaultNetworkInputs(networkName, networkSecret, peers)
-	return buildEncodedConfigFromInputs(name, secret, peerList)
+// buildEncodedConfigWithDefaults mints a pairing code: defaults fill the
+// network settings and opts the envelope (expiry, permissions, token).
+func buildEncodedConfigWithDefaults(networkName, networkSecret, peers string, profile *Profile, opts pairingOptions) (string, *Config, error) {
+	name, secret, peerList := withDefaultNetworkInputs(networkName, networkSecret, peers, profile)
+	cfg, err := buildConfigFromInputs(name, secret, peerList)
+	if err != nil {
+		return "", nil, err
+	}
+	applyPairingOptions(cfg, opts, time.Now())
+	if opts.Short {
+		encoded, err := mintShortCode(cfg)
+		if err != nil {
+			return "", nil, err
+		}
+		return encoded, cfg, nil
+	}
+	if opts.SigningKey != nil {
+		if err := signConfig(cfg, opts.SigningKey); err != nil {
+			return "", nil, err
+		}
+	}
+	encoded, err := encodeConfigOrErr(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	return encoded, cfg, nil
+}
+
+// flagsSet reports whether any of names was given on the command line.
+func flagsSet(fs *flag.FlagSet, names ...string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if containsString(names, f.Name) {
+			set = true
+		}
+	})
+	return set
 }
 
 func submitEncodedConfig(encoded string, submitFn func(string) error) error {
@@ -78,11 +113,18 @@ func submitEncodedConfig(encoded string, submitFn func(string) error) error {
 	return submitFn(code)
 }
 
-func withDefaultNetworkInputs(networkName, networkSecret, peers string) (string, string, string) {
+// withDefaultNetworkInputs fills each network setting from, in order, the
+// flag value, its TELEHAND_* environment variable, the profile and finally
+// the built-in default. Peers from any layer are merged with the default pool.
+func withDefaultNetworkInputs(networkName, networkSecret, peers string, profile *Profile) (string, string, string) {
+	var fromProfile Profile
+	if profile != nil {
+		fromProfile = *profile
+	}
 	host := detectHostIdentity()
-	name := strings.TrimSpace(networkName)
-	secret := strings.TrimSpace(networkSecret)
-	peerList := strings.TrimSpace(peers)
+	name := strings.TrimSpace(firstNonEmpty(networkName, os.Getenv(envNetworkName), fromProfile.NetworkName))
+	secret := strings.TrimSpace(firstNonEmpty(networkSecret, os.Getenv(envNetworkSecret), fromProfile.NetworkSecret))
+	peerList := strings.TrimSpace(firstNonEmpty(peers, os.Getenv(envPeers), fromProfile.Peers))
 
 	if name == "" {
 		name = "telehand:" + host
@@ -164,13 +206,33 @@ func decodeConfigWithValidation(encoded string) (*Config, error) {
 		return nil, errors.New("config code is required")
 	}
 
+	if isShortCode(code) {
+		cfg, err := decodeShortCode(code)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.ExpiresAt > 0 && time.Now().After(time.Unix(cfg.ExpiresAt, 0)) {
+			return nil, newCodedError(ErrorCodeConfigExpired, "config code has expired")
+		}
+		return cfg, nil
+	}
+
 	raw, err := base64.StdEncoding.DecodeString(code)
 	if err != nil {
 		return nil, fmt.Errorf("invalid config string: %w", err)
 	}
 
-	// Optional expiration fields allow forward compatibility while keeping
-	// legacy config format unchanged.
+	// DecodeConfig goes first so an unknown major version is reported as
+	// such rather than as whatever its fields happen to look like.
+	cfg, err := DecodeConfig(code)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyPairingSignature(raw); err != nil {
+		return nil, err
+	}
+	// expire_at and exp predate the versioned envelope and are still
+	// honoured alongside expires_at.
 	var envelope map[string]any
 	if err := json.Unmarshal(raw, &envelope); err != nil {
 		return nil, fmt.Errorf("invalid config format: %w", err)
@@ -178,9 +240,7 @@ func decodeConfigWithValidation(encoded string) (*Config, error) {
 	if err := validateConfigExpiry(envelope); err != nil {
 		return nil, err
 	}
-
-	cfg, err := DecodeConfig(code)
-	if err != nil {
+	if err := checkMinClientVersion(cfg); err != nil {
 		return nil, err
 	}
 	return cfg, nil
@@ -59,7 +59,7 @@ func TestWithDefaultNetworkInputs(t *testing.T) {
 	hostnameReader = func() (string, error) { return "my-host", nil }
 	t.Cleanup(func() { hostnameReader = orig })
 
-	name, secret, peers := withDefaultNetworkInputs("", "", "")
+	name, secret, peers := withDefaultNetworkInputs("", "", "", nil)
 	if name != "telehand:my-host" {
 		t.Fatalf("unexpected default name: %q", name)
 	}
@@ -115,14 +115,13 @@ func TestDecodeConfigWithValidationExpiry(t *testing.T) {
 }
 
 func TestDecodeConfigWithValidationKeepsLegacyConfig(t *testing.T) {
-	code, err := EncodeConfig(&Config{
-		NetworkName:   "n",
-		NetworkSecret: "s",
-		Peers:         []string{"tcp://1.1.1.1:11010"},
+	// Legacy codes carry neither a version nor a signature.
+	raw, _ := json.Marshal(map[string]any{
+		"network_name":   "n",
+		"network_secret": "s",
+		"peers":          []string{"tcp://1.1.1.1:11010"},
 	})
-	if err != nil {
-		t.Fatalf("EncodeConfig failed: %v", err)
-	}
+	code := base64.StdEncoding.EncodeToString(raw)
 	cfg, err := decodeConfigWithValidation(code)
 	if err != nil {
 		t.Fatalf("decodeConfigWithValidation failed: %v", err)
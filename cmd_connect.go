@@ -14,11 +14,21 @@ func runConnect(args []string) int {
 	networkSecret := fs.String("network-secret", "", "default network secret when pairing code is not provided")
 	peers := fs.String("peers", "", "comma-separated peer pool when pairing code is not provided (latency-first fallback)")
 	noBrowser := fs.Bool("no-browser", false, "do not auto-open browser")
+	socksListen := fs.String("socks", "", "local SOCKS5 listen address (e.g. 127.0.0.1:1080) that exits through the receiver's --socks server")
+	var acceptSubnets stringListFlag
+	fs.Var(&acceptSubnets, "accept-subnet", "route receiver --expose-subnet networks inside this private CIDR; repeatable")
+	ttl := fs.Duration("ttl", 0, "pairing code lifetime (e.g. 30m, 24h); 0 means it never expires")
+	permissions := fs.String("permissions", "", "comma-separated API scopes the receiver grants: read,write,exec,forward (default all)")
+	apiToken := fs.String("api-token", "", "require this bearer token on the receiver's API; \"auto\" generates one")
+	once := fs.Bool("once", false, "make the pairing code single-use: it burns after the first receiver reaches running")
+	short := fs.Bool("short", false, "print a short TH-XXXX pairing code for reading aloud (derived secret, default peers omitted, unsigned)")
+	qr := fs.String("qr", "", "also print a QR code in the terminal: code (the pairing code) or command (the first install command)")
+	profileName := fs.String("profile", "", "use defaults from this profile in config.toml (also TELEHAND_PROFILE)")
 	if err := fs.Parse(args); err != nil {
 		return ExitCodeParam
 	}
 	if len(fs.Args()) > 1 {
-		fmt.Fprintln(os.Stderr, "Usage: telehand connect [pairing-code] [--network-name ... --network-secret ... --peers ...]")
+		fmt.Fprintln(os.Stderr, "Usage: telehand connect [pairing-code] [--profile name] [--network-name ... --network-secret ... --peers ...] [--ttl 24h] [--permissions read,write] [--api-token auto] [--once] [--short] [--qr code|command]")
 		return ExitCodeParam
 	}
 
@@ -26,15 +36,61 @@ func runConnect(args []string) int {
 	if len(fs.Args()) == 1 {
 		pairingCode = strings.TrimSpace(fs.Args()[0])
 	}
+	// Judged before the profile fills in flags: only what the user typed
+	// is worth a warning.
+	mintFlags := []string{"network-name", "network-secret", "peers", "ttl", "permissions", "api-token", "once", "short"}
+	mintFlagsIgnored := pairingCode != "" && flagsSet(fs, mintFlags...)
 
-	var (
-		cfg *Config
-		err error
-	)
+	profile, err := selectProfile(*profileName)
+	// A pairing code leaves the profile's network and minting defaults
+	// unused; only name the profile when something of it takes effect.
+	profileApplied := profile != nil && (pairingCode == "" || profile.appliesBesides(fs, mintFlags...))
+	if err == nil {
+		err = profile.applyFlagDefaults(fs)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid profile: %v\n", err)
+		return ExitCodeParam
+	}
+	if profileApplied {
+		fmt.Printf("Profile: %s\n", profile.Name)
+	}
+	refreshPeerListIfStale(func(line string) { fmt.Fprintln(os.Stderr, line) })
+	qrMode := strings.ToLower(strings.TrimSpace(*qr))
+	if qrMode != "" && qrMode != "code" && qrMode != "command" {
+		fmt.Fprintln(os.Stderr, "Invalid --qr: want code or command")
+		return ExitCodeParam
+	}
+	if *ttl < 0 {
+		fmt.Fprintln(os.Stderr, "Invalid --ttl: must not be negative")
+		return ExitCodeParam
+	}
+	accepted, err := parseExposedSubnets(acceptSubnets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --accept-subnet: %v\n", err)
+		return ExitCodeParam
+	}
+	granted, err := parsePermissions(*permissions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --permissions: %v\n", err)
+		return ExitCodeParam
+	}
+	token := strings.TrimSpace(*apiToken)
+	if *short {
+		// The short code derives both the secret and the token itself.
+		if strings.TrimSpace(*networkSecret) != "" || (token != "" && token != "auto") {
+			fmt.Fprintln(os.Stderr, "--short derives the secret and API token; drop --network-secret and use --api-token auto")
+			return ExitCodeParam
+		}
+	}
+	if token == "auto" {
+		token = randomToken()
+	}
 
+	var cfg *Config
 	if pairingCode != "" {
-		if strings.TrimSpace(*networkName) != "" || strings.TrimSpace(*networkSecret) != "" || strings.TrimSpace(*peers) != "" {
-			fmt.Println("Pairing code provided; --network-name/--network-secret/--peers are ignored.")
+		if mintFlagsIgnored {
+			fmt.Println("Pairing code provided; --network-name/--network-secret/--peers/--ttl/--permissions/--api-token/--once/--short are ignored.")
 		}
 		cfg, err = decodeConfigWithValidation(pairingCode)
 		if err != nil {
@@ -42,7 +98,23 @@ func runConnect(args []string) int {
 			return ExitCodeParam
 		}
 	} else {
-		pairingCode, cfg, err = buildEncodedConfigWithDefaults(*networkName, *networkSecret, *peers)
+		opts := pairingOptions{
+			TTL:         *ttl,
+			Permissions: granted,
+			APIToken:    token,
+			Short:       *short,
+			Once:        *once,
+		}
+		if !*short {
+			// Receivers refuse unsigned full codes.
+			key, keyErr := loadOrCreatePairingKey()
+			if keyErr != nil {
+				fmt.Fprintf(os.Stderr, "Pairing key unavailable: %v\n", keyErr)
+				return ExitCodeService
+			}
+			opts.SigningKey = key
+		}
+		pairingCode, cfg, err = buildEncodedConfigWithDefaults(*networkName, *networkSecret, *peers, profile, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Invalid connect params: %v\n", err)
 			return ExitCodeParam
@@ -51,13 +123,27 @@ func runConnect(args []string) int {
 
 	fmt.Printf("Connect network: name=%s secret=%s peers=%s\n", cfg.NetworkName, maskSecret(cfg.NetworkSecret), strings.Join(cfg.Peers, ","))
 	fmt.Println("Peer strategy: latency-first ordering + fallback (details in debug logs).")
+	fmt.Printf("Pairing: %s\n", describePairing(cfg))
+	if len(accepted) > 0 {
+		fmt.Printf("Accepted subnets: %s\n", strings.Join(accepted, ","))
+	}
+	if isShortCode(pairingCode) {
+		fmt.Printf("Short pairing code: %s\n", pairingCode)
+	}
+	if cfg.APIToken != "" {
+		fmt.Printf("Receiver API needs: Authorization: Bearer %s (telehand remote reads TELEHAND_API_TOKEN)\n", cfg.APIToken)
+	}
 
-	commands := buildRemoteInstallCommands(pairingCode)
+	commands := buildRemoteInstallCommands(pairingCode, profile)
 	fmt.Println("Run one of the following commands on the remote machine:")
 	for _, c := range commands {
 		fmt.Printf("  [%s] %s\n", c.Platform, c.Command)
 	}
 
+	if qrMode != "" {
+		printPairingQR(qrMode, pairingCode, commands)
+	}
+
 	clipboard := ""
 	if len(commands) > 0 {
 		clipboard = commands[0].Command
@@ -74,27 +160,22 @@ func runConnect(args []string) int {
 		EncodedConfig:    pairingCode,
 		Commands:         commands,
 		ClipboardCommand: clipboard,
+		SocksListen:      strings.TrimSpace(*socksListen),
+		AcceptSubnets:    accepted,
 	})
 }
 
-func buildRemoteInstallCommands(pairingCode string) []InstallCommand {
-	code := strings.TrimSpace(pairingCode)
-	return []InstallCommand{
-		{
-			Platform: "Windows (PowerShell，下载并运行)",
-			Command:  fmt.Sprintf("iwr -useb https://ghfast.top/https://raw.githubusercontent.com/sfpprxy/telehand/main/install.ps1 | iex; .\\telehand.exe serve '%s'", code),
-		},
-		{
-			Platform: "macOS / Linux（下载并运行）",
-			Command:  fmt.Sprintf("curl -fsSL https://raw.githubusercontent.com/sfpprxy/telehand/main/install.sh | bash && sudo ./telehand serve '%s'", code),
-		},
-		{
-			Platform: "Windows (PowerShell，仅运行)",
-			Command:  fmt.Sprintf(".\\telehand.exe serve '%s'", code),
-		},
-		{
-			Platform: "macOS / Linux（仅运行）",
-			Command:  fmt.Sprintf("sudo ./telehand serve '%s'", code),
-		},
+// printPairingQR prints the pairing code or the first install command as a
+// terminal QR code. Failing to render is not fatal; the text is above.
+func printPairingQR(mode, pairingCode string, commands []InstallCommand) {
+	text, what := pairingCode, "pairing code"
+	if mode == "command" && len(commands) > 0 {
+		text, what = commands[0].Command, commands[0].Platform
+	}
+	code, err := encodeQR(text, qrLevelL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "QR code unavailable: %v\n", err)
+		return
 	}
+	fmt.Printf("QR code (%s):\n%s", what, code.TerminalString())
 }
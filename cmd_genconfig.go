@@ -20,11 +20,26 @@ func runGenConfig(args []string) int {
 		return ExitCodeParam
 	}
 
-	encoded, _, err := buildEncodedConfigFromInputs(*networkName, *networkSecret, *peers)
+	cfg, err := buildConfigFromInputs(*networkName, *networkSecret, *peers)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Usage: telehand gen-config --network-name NAME --network-secret SECRET --peers PEERS\nError: %v\n", err)
 		return ExitCodeParam
 	}
+	// Receivers refuse unsigned full codes.
+	key, err := loadOrCreatePairingKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Pairing key unavailable: %v\n", err)
+		return ExitCodeService
+	}
+	if err := signConfig(cfg, key); err != nil {
+		fmt.Fprintf(os.Stderr, "Sign pairing code failed: %v\n", err)
+		return ExitCodeService
+	}
+	encoded, err := encodeConfigOrErr(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Encode pairing code failed: %v\n", err)
+		return ExitCodeService
+	}
 	fmt.Println(encoded)
 	return ExitCodeOK
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const peersUsage = "Usage:\n" +
+	"  telehand peers [show]\n" +
+	"  telehand peers refresh [--url URL]\n" +
+	"  telehand peers sign [--out FILE] PEER...\n"
+
+func runPeers(args []string) int {
+	if len(args) == 0 {
+		return runPeersShow(nil)
+	}
+	switch args[0] {
+	case "show":
+		return runPeersShow(args[1:])
+	case "refresh":
+		return runPeersRefresh(args[1:])
+	case "sign":
+		return runPeersSign(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, peersUsage)
+		return ExitCodeParam
+	}
+}
+
+func runPeersShow(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprint(os.Stderr, peersUsage)
+		return ExitCodeParam
+	}
+	src, err := loadPeerListSource()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return ExitCodeParam
+	}
+	path, _ := peerListPath()
+	fmt.Printf("Peer list URL: %s\n", firstNonEmpty(src.URL, "(none)"))
+	fmt.Printf("Trusted keys: %d\n", len(src.Keys))
+	for _, k := range src.Keys {
+		fmt.Printf("  %s\n", keyFingerprint(k))
+	}
+	if len(src.Keys) > 0 {
+		list, err := loadCachedPeerList(src.Keys)
+		switch {
+		case err != nil:
+			fmt.Printf("Cached list %s: ignored (%v)\n", path, err)
+		case list == nil:
+			fmt.Printf("Cached list %s: none\n", path)
+		default:
+			fmt.Printf("Cached list %s: %d peers, updated %s\n", path, len(list.Peers), time.Unix(list.UpdatedAt, 0).Format(time.RFC3339))
+		}
+	}
+	fmt.Println("Default peer pool:")
+	for _, p := range defaultPeerPool() {
+		fmt.Printf("  %s\n", p)
+	}
+	return ExitCodeOK
+}
+
+func runPeersRefresh(args []string) int {
+	fs := flag.NewFlagSet("peers refresh", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	url := fs.String("url", "", "Fetch from this URL instead of peer_list_url")
+	if err := fs.Parse(args); err != nil {
+		return ExitCodeParam
+	}
+	src, err := loadPeerListSource()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return ExitCodeParam
+	}
+	if u := strings.TrimSpace(*url); u != "" {
+		src.URL = u
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), peerListFetchTimeout)
+	defer cancel()
+	list, err := refreshPeerList(ctx, src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Refresh failed: %v\n", err)
+		return ExitCodeNetwork
+	}
+	fmt.Printf("Peer list updated (%d peers, updated %s):\n", len(list.Peers), time.Unix(list.UpdatedAt, 0).Format(time.RFC3339))
+	for _, p := range list.Peers {
+		fmt.Printf("  %s\n", p)
+	}
+	return ExitCodeOK
+}
+
+// runPeersSign signs a list with this machine's pairing key, for whoever
+// publishes peer_list_url. Receivers trust it through peer_list_keys.
+func runPeersSign(args []string) int {
+	fs := flag.NewFlagSet("peers sign", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	out := fs.String("out", "", "Write the list to FILE instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return ExitCodeParam
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprint(os.Stderr, peersUsage)
+		return ExitCodeParam
+	}
+	key, err := loadOrCreatePairingKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Pairing key: %v\n", err)
+		return ExitCodeService
+	}
+	doc, err := signPeerList(parsePeers(strings.Join(fs.Args(), ",")), time.Now(), key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Sign failed: %v\n", err)
+		return ExitCodeParam
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	fmt.Fprintf(os.Stderr, "Signed with key %s (fingerprint %s); add it to peer_list_keys.\n",
+		base64.StdEncoding.EncodeToString(pub), keyFingerprint(pub))
+	if *out == "" {
+		fmt.Println(string(doc))
+		return ExitCodeOK
+	}
+	if err := os.WriteFile(*out, append(doc, '\n'), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Write failed: %v\n", err)
+		return ExitCodeService
+	}
+	return ExitCodeOK
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func runRelay(args []string) int {
+	fs := flag.NewFlagSet("relay", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	var listeners, peers stringListFlag
+	fs.Var(&listeners, "listen", "Listener URL, repeatable (default tcp://0.0.0.0:11010,udp://0.0.0.0:11010)")
+	publicHost := fs.String("public-host", "", "Host or IP clients use to reach this relay (default: detected outbound IP)")
+	networkName := fs.String("network-name", "", "The relay's own network name; relays sharing name and secret peer with each other")
+	networkSecret := fs.String("network-secret", "", "The relay's own network secret (default: random)")
+	whitelist := fs.String("relay-networks", "*", "Networks to relay, space-separated wildcards (e.g. \"telehand:*\")")
+	fs.Var(&peers, "peers", "Other relays to join, comma-separated")
+	httpAddr := fs.String("http", defaultRelayHTTP, "Local address for the /health endpoint (\"off\" to disable)")
+	printSystemd := fs.Bool("print-systemd", false, "Print a systemd unit running this relay and exit")
+	if err := fs.Parse(args); err != nil {
+		return ExitCodeParam
+	}
+	if len(fs.Args()) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: telehand relay [--listen URL]... [--public-host HOST] [--relay-networks PATTERNS] [--http ADDR]")
+		return ExitCodeParam
+	}
+
+	// A random secret differs on every start and from every other relay,
+	// so joining peers (or a systemd unit that restarts) needs a fixed one.
+	if len(peers) > 0 && strings.TrimSpace(*networkSecret) == "" {
+		fmt.Fprintln(os.Stderr, "Error: --peers needs --network-secret, the same on every relay of the network")
+		return ExitCodeParam
+	}
+
+	if *printSystemd {
+		exe, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitCodeService
+		}
+		fmt.Print(systemdUnit(exe, withoutFlag(args, "print-systemd")))
+		return ExitCodeOK
+	}
+
+	if len(listeners) == 0 {
+		listeners = defaultRelayListeners
+	}
+	opts := relayOptions{
+		PublicHost:    strings.TrimSpace(*publicHost),
+		NetworkName:   strings.TrimSpace(*networkName),
+		NetworkSecret: strings.TrimSpace(*networkSecret),
+		Whitelist:     *whitelist,
+	}
+	for _, l := range listeners {
+		normalized, err := normalizeRelayListener(l)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitCodeParam
+		}
+		opts.Listeners = append(opts.Listeners, normalized)
+	}
+	for _, p := range peers {
+		normalized, ok := normalizePeerAddress(p)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: invalid --peers address %q\n", p)
+			return ExitCodeParam
+		}
+		opts.Peers = append(opts.Peers, normalized)
+	}
+	if opts.NetworkName == "" {
+		host, _ := hostnameReader()
+		opts.NetworkName = "telehand-relay:" + firstNonEmpty(strings.TrimSpace(host), "node")
+	}
+	if opts.NetworkSecret == "" {
+		opts.NetworkSecret = randomToken()
+	}
+	if opts.PublicHost == "" {
+		opts.PublicHost = detectOutboundIPv4()
+		if opts.PublicHost == "" {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", errRelayNoPublicHost)
+			return ExitCodeNetwork
+		}
+		if ip := net.ParseIP(opts.PublicHost); ip != nil && ip.IsPrivate() {
+			fmt.Fprintf(os.Stderr, "Warning: detected address %s is private; behind NAT, pass --public-host with the public address or domain.\n", opts.PublicHost)
+		}
+	}
+
+	relay := newRelayServer(opts, func(line string) { fmt.Println(line) })
+	fmt.Printf("Relay network: %s\n", opts.NetworkName)
+	fmt.Printf("Relaying networks: %s\n", firstNonEmpty(opts.Whitelist, "*"))
+	fmt.Println("Peer URLs (use with --peers):")
+	for _, u := range relay.peerURLs {
+		fmt.Printf("  %s\n", u)
+	}
+	fmt.Printf("  --peers %s\n", strings.Join(relay.peerURLs, ","))
+
+	if addr := strings.TrimSpace(*httpAddr); addr != "" && addr != "off" {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: health endpoint: %v\n", err)
+			return ExitCodeService
+		}
+		srv := &http.Server{Handler: relay.mux()}
+		go srv.Serve(ln)
+		defer srv.Close()
+		fmt.Printf("Health: http://%s/health\n", ln.Addr())
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	stop := make(chan struct{})
+	go func() { <-sig; close(stop) }()
+
+	if err := relay.run(stop); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: start easytier-core: %v\n", err)
+		return ExitCodeService
+	}
+	fmt.Println("Relay stopped.")
+	return ExitCodeOK
+}
+
+// withoutFlag drops every form of a boolean flag from args.
+func withoutFlag(args []string, name string) []string {
+	var out []string
+	for _, a := range args {
+		bare := strings.TrimLeft(a, "-")
+		if strings.HasPrefix(a, "-") && (bare == name || strings.HasPrefix(bare, name+"=")) {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const remoteUsage = "Usage:\n" +
+	"  telehand remote sync [--addr HOST:PORT] [--pull] [--delete] [--exclude PATTERN]... <local> <remote>\n" +
+	"  telehand remote forward [--addr HOST:PORT] L|R:[bind:]port:host:port...\n"
+
+type remoteClient struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+type remoteError struct {
+	Status  int
+	Message string
+	Code    string
+}
+
+func (e *remoteError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s (status=%d error_code=%s)", e.Message, e.Status, e.Code)
+	}
+	return fmt.Sprintf("%s (status=%d)", e.Message, e.Status)
+}
+
+func runRemote(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, remoteUsage)
+		return ExitCodeParam
+	}
+	switch args[0] {
+	case "sync":
+		return runRemoteSync(args[1:])
+	case "forward":
+		return runRemoteForward(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, remoteUsage)
+		return ExitCodeParam
+	}
+}
+
+// resolveRemoteAddr accepts host:port or a full URL, falling back to the
+// TELEHAND_REMOTE environment variable when the flag is empty.
+func resolveRemoteAddr(flagValue string) (string, error) {
+	addr := strings.TrimSpace(flagValue)
+	if addr == "" {
+		addr = strings.TrimSpace(os.Getenv("TELEHAND_REMOTE"))
+	}
+	if addr == "" {
+		return "", errors.New("remote address is required (--addr or TELEHAND_REMOTE)")
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimRight(addr, "/"), nil
+}
+
+func newRemoteClient(base string) *remoteClient {
+	return &remoteClient{
+		base:  strings.TrimRight(base, "/"),
+		token: strings.TrimSpace(os.Getenv("TELEHAND_API_TOKEN")),
+		http:  &http.Client{Timeout: 120 * time.Second},
+	}
+}
+
+// authorize adds the pairing code's API token, if any, from
+// TELEHAND_API_TOKEN.
+func (c *remoteClient) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+func (c *remoteClient) call(path string, req any, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	c.authorize(httpReq)
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	raw, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	var errBody struct {
+		Error     string `json:"error"`
+		ErrorCode string `json:"error_code"`
+	}
+	// Some endpoints report business-level misses with HTTP 200, so the
+	// error field is checked regardless of status.
+	if json.Unmarshal(raw, &errBody) == nil && errBody.Error != "" {
+		return &remoteError{Status: httpResp.StatusCode, Message: errBody.Error, Code: errBody.ErrorCode}
+	}
+	if httpResp.StatusCode >= 400 {
+		return &remoteError{Status: httpResp.StatusCode, Message: strings.TrimSpace(string(raw))}
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, resp); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return nil
+}
+
+type stringListFlag []string
+
+func (f *stringListFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringListFlag) Set(v string) error {
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*f = append(*f, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// forwardSpec is one ssh-style forward:
+//
+//	L:[bind:]localport:remotehost:remoteport  local port -> service on the receiver
+//	R:[bind:]remoteport:localhost:localport   receiver port -> service on this machine
+type forwardSpec struct {
+	Reverse    bool
+	ListenHost string
+	ListenPort int
+	TargetHost string
+	TargetPort int
+}
+
+func parseForwardSpec(raw string) (forwardSpec, error) {
+	parts := strings.Split(strings.TrimSpace(raw), ":")
+	var spec forwardSpec
+	switch strings.ToUpper(parts[0]) {
+	case "L":
+	case "R":
+		spec.Reverse = true
+	default:
+		return spec, fmt.Errorf("invalid forward %q: must start with L: or R:", raw)
+	}
+	parts = parts[1:]
+	switch len(parts) {
+	case 3:
+	case 4:
+		spec.ListenHost, parts = parts[0], parts[1:]
+	default:
+		return spec, fmt.Errorf("invalid forward %q: want L|R:[bind:]port:host:port", raw)
+	}
+	listenPort, err1 := strconv.Atoi(parts[0])
+	targetPort, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || listenPort < 0 || listenPort > 65535 || targetPort <= 0 || targetPort > 65535 {
+		return spec, fmt.Errorf("invalid forward %q: bad port", raw)
+	}
+	if parts[1] == "" {
+		return spec, fmt.Errorf("invalid forward %q: host is required", raw)
+	}
+	spec.ListenPort, spec.TargetHost, spec.TargetPort = listenPort, parts[1], targetPort
+	if spec.ListenHost == "" {
+		spec.ListenHost = "127.0.0.1"
+	}
+	return spec, nil
+}
+
+func (f forwardSpec) String() string {
+	kind := "L"
+	if f.Reverse {
+		kind = "R"
+	}
+	return fmt.Sprintf("%s:%s:%d:%s:%d", kind, f.ListenHost, f.ListenPort, f.TargetHost, f.TargetPort)
+}
+
+func runRemoteForward(args []string) int {
+	fs := flag.NewFlagSet("remote forward", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	addr := fs.String("addr", "", "remote API address host:port (default $TELEHAND_REMOTE)")
+	if err := fs.Parse(args); err != nil {
+		return ExitCodeParam
+	}
+	if len(fs.Args()) == 0 {
+		fmt.Fprint(os.Stderr, remoteUsage)
+		return ExitCodeParam
+	}
+	base, err := resolveRemoteAddr(*addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid remote params: %v\n", err)
+		return ExitCodeParam
+	}
+	var specs []forwardSpec
+	for _, raw := range fs.Args() {
+		spec, err := parseForwardSpec(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid remote params: %v\n", err)
+			return ExitCodeParam
+		}
+		specs = append(specs, spec)
+	}
+
+	client := newRemoteClient(base)
+	logf := func(format string, args ...any) { fmt.Printf(format+"\n", args...) }
+	done := make(chan error, len(specs))
+	for _, spec := range specs {
+		fwd, err := startForward(client, spec, logf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Forward %s failed: %v\n", spec, err)
+			var remoteErr *remoteError
+			if errors.As(err, &remoteErr) {
+				return ExitCodeService
+			}
+			return ExitCodeNetwork
+		}
+		if spec.Reverse {
+			logf("Forward %s:%s -> %s", base, fwd.Addr(), net.JoinHostPort(spec.TargetHost, strconv.Itoa(spec.TargetPort)))
+		} else {
+			logf("Forward %s -> %s:%s", fwd.Addr(), base, net.JoinHostPort(spec.TargetHost, strconv.Itoa(spec.TargetPort)))
+		}
+		go func() { done <- fwd.Wait() }()
+	}
+	logf("Press Ctrl+C to stop forwarding.")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	select {
+	case <-sig:
+		return ExitCodeOK
+	case err := <-done:
+		fmt.Fprintf(os.Stderr, "Forward closed: %v\n", err)
+		return ExitCodeNetwork
+	}
+}
+
+// tunnelForwarder runs one forward until its control stream or listener
+// ends.
+type tunnelForwarder struct {
+	client  *remoteClient
+	spec    forwardSpec
+	logf    func(format string, args ...any)
+	id      int
+	addr    string
+	control net.Conn
+	ln      net.Listener
+	done    chan struct{}
+	once    sync.Once
+	err     error
+}
+
+func startForward(client *remoteClient, spec forwardSpec, logf func(format string, args ...any)) (*tunnelForwarder, error) {
+	f := &tunnelForwarder{client: client, spec: spec, logf: logf, done: make(chan struct{})}
+	req := TunnelReq{Mode: TunnelModeLocal, Host: spec.TargetHost, Port: spec.TargetPort}
+	if spec.Reverse {
+		req = TunnelReq{Mode: TunnelModeRemote, Bind: spec.ListenHost, Port: spec.ListenPort}
+	}
+	control, header, err := client.openTunnel(req)
+	if err != nil {
+		return nil, err
+	}
+	f.control = control
+	f.id, _ = strconv.Atoi(header.Get(tunnelIDHeader))
+	f.addr = header.Get(tunnelAddrHeader)
+
+	if !spec.Reverse {
+		ln, err := net.Listen("tcp", net.JoinHostPort(spec.ListenHost, strconv.Itoa(spec.ListenPort)))
+		if err != nil {
+			control.Close()
+			return nil, err
+		}
+		f.ln = ln
+		f.addr = ln.Addr().String()
+		go f.acceptLocal()
+	}
+	go f.readControl()
+	return f, nil
+}
+
+func (f *tunnelForwarder) Addr() string { return f.addr }
+
+// Wait blocks until the forward stops and returns why.
+func (f *tunnelForwarder) Wait() error {
+	<-f.done
+	return f.err
+}
+
+func (f *tunnelForwarder) Close() { f.stop(errors.New("closed")) }
+
+func (f *tunnelForwarder) stop(err error) {
+	f.once.Do(func() {
+		f.err = err
+		f.control.Close()
+		if f.ln != nil {
+			f.ln.Close()
+		}
+		close(f.done)
+	})
+}
+
+func (f *tunnelForwarder) readControl() {
+	sc := bufio.NewScanner(f.control)
+	for sc.Scan() {
+		cmd, arg, _ := strings.Cut(sc.Text(), " ")
+		if cmd == "conn" && f.spec.Reverse {
+			if n, err := strconv.Atoi(arg); err == nil {
+				go f.acceptRemote(n)
+			}
+		}
+	}
+	err := sc.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	f.stop(fmt.Errorf("control stream closed: %w", err))
+}
+
+func (f *tunnelForwarder) acceptLocal() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			f.stop(err)
+			return
+		}
+		go func() {
+			tunnel, _, err := f.client.openTunnel(TunnelReq{Mode: TunnelModeConnect, ID: f.id})
+			if err != nil {
+				f.logf("Forward %s: %v", f.spec, err)
+				conn.Close()
+				return
+			}
+			pipeConns(conn, tunnel)
+		}()
+	}
+}
+
+func (f *tunnelForwarder) acceptRemote(n int) {
+	tunnel, _, err := f.client.openTunnel(TunnelReq{Mode: TunnelModeAccept, ID: f.id, Conn: n})
+	if err != nil {
+		f.logf("Forward %s: %v", f.spec, err)
+		return
+	}
+	target, err := net.DialTimeout("tcp", net.JoinHostPort(f.spec.TargetHost, strconv.Itoa(f.spec.TargetPort)), tunnelDialTimeout)
+	if err != nil {
+		f.logf("Forward %s: %v", f.spec, err)
+		tunnel.Close()
+		return
+	}
+	pipeConns(tunnel, target)
+}
+
+// openTunnel upgrades a fresh connection to the API into a raw tunnel
+// stream. Errors before the upgrade are reported like call().
+func (c *remoteClient) openTunnel(req TunnelReq) (net.Conn, http.Header, error) {
+	u, err := url.Parse(c.base)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Scheme != "http" {
+		return nil, nil, fmt.Errorf("tunnel needs an http:// address, got %s", c.base)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.base+"/tunnel", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Connection", "Upgrade")
+	httpReq.Header.Set("Upgrade", tunnelUpgradeToken)
+	c.authorize(httpReq)
+
+	conn, err := net.DialTimeout("tcp", u.Host, tunnelDialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(tunnelDialTimeout + 5*time.Second))
+	if err := httpReq.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, httpReq)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer conn.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		var errBody struct {
+			Error     string `json:"error"`
+			ErrorCode string `json:"error_code"`
+		}
+		if json.Unmarshal(raw, &errBody) == nil && errBody.Error != "" {
+			return nil, nil, &remoteError{Status: resp.StatusCode, Message: errBody.Error, Code: errBody.ErrorCode}
+		}
+		return nil, nil, &remoteError{Status: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+	}
+	conn.SetDeadline(time.Time{})
+	return &tunnelConn{Conn: conn, r: br}, resp.Header, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	cases := map[string]string{
+		"L:15432:localhost:5432":        "L:127.0.0.1:15432:localhost:5432",
+		"r:0.0.0.0:8000:127.0.0.1:3000": "R:0.0.0.0:8000:127.0.0.1:3000",
+		"L:0:db:5432":                   "L:127.0.0.1:0:db:5432",
+	}
+	for raw, want := range cases {
+		spec, err := parseForwardSpec(raw)
+		if err != nil || spec.String() != want {
+			t.Fatalf("parseForwardSpec(%q) = %v, %v; want %s", raw, spec, err, want)
+		}
+	}
+	for _, raw := range []string{"X:1:a:2", "L:1:a", "L:1::2", "L:a:b:2", "L:1:a:0", "R:1:a:70000"} {
+		if _, err := parseForwardSpec(raw); err == nil {
+			t.Fatalf("parseForwardSpec(%q) should fail", raw)
+		}
+	}
+}
+
+// startEchoServer answers each line with "<prefix>:<line>".
+func startEchoServer(t *testing.T, prefix string) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				raw, _ := io.ReadAll(c)
+				fmt.Fprintf(c, "%s:%s", prefix, raw)
+			}()
+		}
+	}()
+	return ln
+}
+
+func roundTrip(t *testing.T, addr, msg string) string {
+	t.Helper()
+	c, err := net.DialTimeout("tcp", addr, 3*time.Second)
+	if err != nil {
+		t.Fatalf("dial %s failed: %v", addr, err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(c, msg)
+	// The echo server answers after EOF, which exercises half-close.
+	c.(*net.TCPConn).CloseWrite()
+	out, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("read from %s failed: %v", addr, err)
+	}
+	return string(out)
+}
+
+func TestRemoteForwardLocalAndReverse(t *testing.T) {
+	s := NewAPIServer("127.0.0.1", 20680, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	client := newRemoteClient(fmt.Sprintf("http://127.0.0.1:%d", s.Port()))
+	logf := func(format string, args ...any) { t.Logf(format, args...) }
+
+	remoteSvc := startEchoServer(t, "remote")
+	_, port, _ := net.SplitHostPort(remoteSvc.Addr().String())
+	local, err := startForward(client, mustForwardSpec(t, "L:0:127.0.0.1:"+port), logf)
+	if err != nil {
+		t.Fatalf("start local forward failed: %v", err)
+	}
+	defer local.Close()
+	for i := 0; i < 2; i++ {
+		if got := roundTrip(t, local.Addr(), "ping"); got != "remote:ping" {
+			t.Fatalf("local forward mismatch: got=%q", got)
+		}
+	}
+
+	localSvc := startEchoServer(t, "local")
+	_, port, _ = net.SplitHostPort(localSvc.Addr().String())
+	reverse, err := startForward(client, mustForwardSpec(t, "R:0:127.0.0.1:"+port), logf)
+	if err != nil {
+		t.Fatalf("start reverse forward failed: %v", err)
+	}
+	if got := roundTrip(t, reverse.Addr(), "pong"); got != "local:pong" {
+		t.Fatalf("reverse forward mismatch: got=%q", got)
+	}
+
+	// Counters land when the receiver's pipe finishes, just after the client
+	// sees EOF.
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		tunnels := s.Tunnels()
+		if len(tunnels) != 2 || tunnels[0].Kind != TunnelModeLocal || tunnels[1].Kind != TunnelModeRemote {
+			t.Fatalf("tunnel list mismatch: %+v", tunnels)
+		}
+		if tunnels[0].TotalConns == 2 && tunnels[0].BytesIn == 8 && tunnels[0].BytesOut == int64(2*len("remote:ping")) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tunnel counters mismatch: %+v", tunnels[0])
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	reverse.Close()
+	deadline = time.Now().Add(3 * time.Second)
+	for len(s.Tunnels()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("closed forward still listed: %+v", s.Tunnels())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := net.DialTimeout("tcp", reverse.Addr(), time.Second); err == nil {
+		t.Fatalf("reverse listener should be closed with its forward")
+	}
+
+	_, _, err = client.openTunnel(TunnelReq{Mode: TunnelModeConnect, ID: 999})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("unknown forward should be rejected: %v", err)
+	}
+}
+
+func mustForwardSpec(t *testing.T, raw string) forwardSpec {
+	t.Helper()
+	spec, err := parseForwardSpec(raw)
+	if err != nil {
+		t.Fatalf("parseForwardSpec(%q) failed: %v", raw, err)
+	}
+	return spec
+}
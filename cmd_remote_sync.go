@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const syncChunkSize = 1024 * 1024
+
+type syncOptions struct {
+	Exclude   []string
+	Delete    bool
+	BlockSize int
+	Logf      func(format string, args ...any)
+}
+
+type syncStats struct {
+	Files   int
+	Deleted int
+	Bytes   int64
+}
+
+func runRemoteSync(args []string) int {
+	fs := flag.NewFlagSet("remote sync", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	addr := fs.String("addr", "", "remote API address host:port (default $TELEHAND_REMOTE)")
+	pull := fs.Bool("pull", false, "copy remote directory to local instead of pushing")
+	del := fs.Bool("delete", false, "delete files on the destination that do not exist on the source")
+	blockSize := fs.Int("block-size", SyncDefaultBlockSize, "block size in bytes for delta transfer (0 transfers whole files)")
+	var exclude stringListFlag
+	fs.Var(&exclude, "exclude", "glob pattern to exclude (repeatable; trailing / matches directories only)")
+	if err := fs.Parse(args); err != nil {
+		return ExitCodeParam
+	}
+	if len(fs.Args()) != 2 {
+		fmt.Fprint(os.Stderr, remoteUsage)
+		return ExitCodeParam
+	}
+	base, err := resolveRemoteAddr(*addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid remote params: %v\n", err)
+		return ExitCodeParam
+	}
+
+	local := strings.TrimSpace(fs.Args()[0])
+	remote := strings.TrimSpace(fs.Args()[1])
+	opts := syncOptions{
+		Exclude:   exclude,
+		Delete:    *del,
+		BlockSize: *blockSize,
+		Logf: func(format string, args ...any) {
+			fmt.Printf(format+"\n", args...)
+		},
+	}
+	client := newRemoteClient(base)
+
+	var stats syncStats
+	if *pull {
+		fmt.Printf("Sync pull: %s:%s -> %s\n", base, remote, local)
+		stats, err = syncPull(client, local, remote, opts)
+	} else {
+		fmt.Printf("Sync push: %s -> %s:%s\n", local, base, remote)
+		stats, err = syncPush(client, local, remote, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Sync failed: %v\n", err)
+		var remoteErr *remoteError
+		if errors.As(err, &remoteErr) {
+			return ExitCodeService
+		}
+		return ExitCodeNetwork
+	}
+	fmt.Printf("Sync done: %d files transferred, %d deleted, %d bytes\n", stats.Files, stats.Deleted, stats.Bytes)
+	return ExitCodeOK
+}
+
+func (o syncOptions) logf(format string, args ...any) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+func syncPush(c *remoteClient, local, remote string, opts syncOptions) (syncStats, error) {
+	var stats syncStats
+	src, err := buildSyncManifest(local, opts.Exclude, opts.BlockSize)
+	if err != nil {
+		return stats, err
+	}
+	if !src.Exists {
+		return stats, fmt.Errorf("local directory %s not found", local)
+	}
+	var dst SyncManifest
+	if err := c.call("/sync/manifest", SyncManifestReq{Path: remote, Exclude: opts.Exclude, BlockSize: opts.BlockSize}, &dst); err != nil {
+		return stats, err
+	}
+	dstByPath := syncEntriesByPath(dst.Entries)
+
+	for _, e := range src.Entries {
+		prev, ok := dstByPath[e.Path]
+		if ok && prev.IsDir != e.IsDir {
+			if err := c.call("/sync/delete", SyncDeleteReq{Root: remote, Paths: []string{e.Path}}, nil); err != nil {
+				return stats, err
+			}
+			ok = false
+		}
+		if e.IsDir {
+			if !ok {
+				if err := c.call("/sync/put", SyncPutReq{Root: remote, Path: e.Path, IsDir: true, Mode: e.Mode}, nil); err != nil {
+					return stats, err
+				}
+			}
+			continue
+		}
+		if !syncEntryChanged(e, prev, ok) {
+			continue
+		}
+
+		ranges := [][2]int64{{0, e.Size}}
+		if ok && dst.BlockSize == src.BlockSize {
+			ranges = changedSyncRanges(e, prev, src.BlockSize)
+		}
+		sent, err := pushSyncRanges(c, filepath.Join(local, filepath.FromSlash(e.Path)), remote, e, ranges)
+		if err != nil {
+			return stats, err
+		}
+		stats.Files++
+		stats.Bytes += sent
+		opts.logf("  + %s (%d bytes)", e.Path, sent)
+	}
+
+	if opts.Delete {
+		srcByPath := syncEntriesByPath(src.Entries)
+		var extra []string
+		for _, e := range dst.Entries {
+			if _, ok := srcByPath[e.Path]; !ok {
+				extra = append(extra, e.Path)
+			}
+		}
+		extra = pruneNestedSyncPaths(extra)
+		if len(extra) > 0 {
+			var resp SyncDeleteResp
+			if err := c.call("/sync/delete", SyncDeleteReq{Root: remote, Paths: extra}, &resp); err != nil {
+				return stats, err
+			}
+			for _, p := range extra {
+				opts.logf("  - %s", p)
+			}
+			stats.Deleted += resp.Deleted
+		}
+	}
+	return stats, nil
+}
+
+func pushSyncRanges(c *remoteClient, localPath, remoteRoot string, e SyncEntry, ranges [][2]int64) (int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var sent int64
+	buf := make([]byte, syncChunkSize)
+	for _, rg := range ranges {
+		for off := rg[0]; off < rg[1]; {
+			n := int64(len(buf))
+			if rg[1]-off < n {
+				n = rg[1] - off
+			}
+			read, err := f.ReadAt(buf[:n], off)
+			if err != nil && err != io.EOF {
+				return sent, err
+			}
+			if read == 0 {
+				break
+			}
+			req := SyncPutReq{
+				Root:   remoteRoot,
+				Path:   e.Path,
+				Data:   base64.StdEncoding.EncodeToString(buf[:read]),
+				Offset: off,
+			}
+			if err := c.call("/sync/put", req, nil); err != nil {
+				return sent, err
+			}
+			sent += int64(read)
+			off += int64(read)
+		}
+	}
+	final := SyncPutReq{Root: remoteRoot, Path: e.Path, Final: true, Size: e.Size, Mtime: e.Mtime, Mode: e.Mode}
+	if err := c.call("/sync/put", final, nil); err != nil {
+		return sent, err
+	}
+	return sent, nil
+}
+
+func syncPull(c *remoteClient, local, remote string, opts syncOptions) (syncStats, error) {
+	var stats syncStats
+	var src SyncManifest
+	if err := c.call("/sync/manifest", SyncManifestReq{Path: remote, Exclude: opts.Exclude, BlockSize: opts.BlockSize}, &src); err != nil {
+		return stats, err
+	}
+	if !src.Exists {
+		return stats, fmt.Errorf("remote directory %s not found", remote)
+	}
+	if err := os.MkdirAll(local, 0755); err != nil {
+		return stats, err
+	}
+	dst, err := buildSyncManifest(local, opts.Exclude, src.BlockSize)
+	if err != nil {
+		return stats, err
+	}
+	dstByPath := syncEntriesByPath(dst.Entries)
+
+	for _, e := range src.Entries {
+		target, err := resolveUnderRoot(local, e.Path)
+		if err != nil {
+			return stats, err
+		}
+		prev, ok := dstByPath[e.Path]
+		if ok && prev.IsDir != e.IsDir {
+			if err := os.RemoveAll(target); err != nil {
+				return stats, err
+			}
+			ok = false
+		}
+		if e.IsDir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return stats, err
+			}
+			continue
+		}
+		if !syncEntryChanged(e, prev, ok) {
+			continue
+		}
+
+		ranges := [][2]int64{{0, e.Size}}
+		if ok {
+			ranges = changedSyncRanges(e, prev, src.BlockSize)
+		}
+		received, err := pullSyncRanges(c, path2remote(remote, e.Path), target, ranges)
+		if err != nil {
+			return stats, err
+		}
+		if err := os.Truncate(target, e.Size); err != nil {
+			return stats, err
+		}
+		applySyncAttrs(target, e.Mode, e.Mtime)
+		stats.Files++
+		stats.Bytes += received
+		opts.logf("  + %s (%d bytes)", e.Path, received)
+	}
+
+	if opts.Delete {
+		srcByPath := syncEntriesByPath(src.Entries)
+		var extra []string
+		for _, e := range dst.Entries {
+			if _, ok := srcByPath[e.Path]; !ok {
+				extra = append(extra, e.Path)
+			}
+		}
+		for _, p := range pruneNestedSyncPaths(extra) {
+			target, err := resolveUnderRoot(local, p)
+			if err != nil {
+				return stats, err
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return stats, err
+			}
+			opts.logf("  - %s", p)
+			stats.Deleted++
+		}
+	}
+	return stats, nil
+}
+
+func pullSyncRanges(c *remoteClient, remotePath, localPath string, ranges [][2]int64) (received int64, err error) {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	// A failed close may lose written data, so it is reported too.
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for _, rg := range ranges {
+		for off := rg[0]; off < rg[1]; {
+			limit := int64(8 * syncChunkSize)
+			if rg[1]-off < limit {
+				limit = rg[1] - off
+			}
+			var resp DownloadResp
+			if err := c.call("/download", DownloadReq{Path: remotePath, Offset: off, Limit: int(limit)}, &resp); err != nil {
+				return received, err
+			}
+			data, err := base64.StdEncoding.DecodeString(resp.Data)
+			if err != nil {
+				return received, fmt.Errorf("invalid download data: %w", err)
+			}
+			if len(data) == 0 {
+				return received, fmt.Errorf("remote file %s changed during sync", remotePath)
+			}
+			if _, err := f.WriteAt(data, off); err != nil {
+				return received, err
+			}
+			received += int64(len(data))
+			off += int64(len(data))
+		}
+	}
+	return received, nil
+}
+
+// path2remote joins a manifest path onto a remote root without assuming the
+// remote OS: the separator already used by the root is kept.
+func path2remote(root, rel string) string {
+	sep := "/"
+	if strings.Contains(root, "\\") && !strings.Contains(root, "/") {
+		sep = "\\"
+	}
+	return strings.TrimRight(root, "/\\") + sep + strings.ReplaceAll(rel, "/", sep)
+}
+
+// pruneNestedSyncPaths drops paths whose parent directory is also listed, so
+// a removed directory is reported (and deleted) once.
+func pruneNestedSyncPaths(paths []string) []string {
+	sort.Strings(paths)
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if n := len(out); n > 0 && strings.HasPrefix(p, out[n-1]+"/") {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRemoteSyncPushAndPull(t *testing.T) {
+	s := NewAPIServer("127.0.0.1", 19780, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	client := newRemoteClient(fmt.Sprintf("http://127.0.0.1:%d", s.Port()))
+
+	local := t.TempDir()
+	remote := filepath.Join(t.TempDir(), "dst")
+	big := strings.Repeat("0123456789", 1000)
+	mustWriteFile(t, filepath.Join(local, "big.txt"), big)
+	mustWriteFile(t, filepath.Join(local, "sub", "b.txt"), "hello")
+	mustWriteFile(t, filepath.Join(local, "skip.tmp"), "tmp")
+	mustWriteFile(t, filepath.Join(remote, "stale", "old.txt"), "old")
+
+	opts := syncOptions{Exclude: []string{"*.tmp"}, Delete: true, BlockSize: 1024}
+	stats, err := syncPush(client, local, remote, opts)
+	if err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if stats.Files != 2 || stats.Deleted != 1 {
+		t.Fatalf("push stats mismatch: got=%+v", stats)
+	}
+	assertFileContent(t, filepath.Join(remote, "big.txt"), big)
+	assertFileContent(t, filepath.Join(remote, "sub", "b.txt"), "hello")
+	if _, err := os.Stat(filepath.Join(remote, "skip.tmp")); !os.IsNotExist(err) {
+		t.Fatalf("excluded file should not be pushed: err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(remote, "stale")); !os.IsNotExist(err) {
+		t.Fatalf("stale dir should be deleted: err=%v", err)
+	}
+
+	// A one-byte change only transfers the affected block.
+	changed := big[:5000] + "X" + big[5001:]
+	mustWriteFile(t, filepath.Join(local, "big.txt"), changed)
+	stats, err = syncPush(client, local, remote, opts)
+	if err != nil {
+		t.Fatalf("second push failed: %v", err)
+	}
+	if stats.Files != 1 || stats.Bytes != 1024 {
+		t.Fatalf("delta push stats mismatch: got=%+v", stats)
+	}
+	assertFileContent(t, filepath.Join(remote, "big.txt"), changed)
+
+	// Pull back into a fresh directory with an extra file to delete.
+	back := t.TempDir()
+	mustWriteFile(t, filepath.Join(back, "extra.txt"), "extra")
+	stats, err = syncPull(client, back, remote, opts)
+	if err != nil {
+		t.Fatalf("pull failed: %v", err)
+	}
+	if stats.Files != 2 || stats.Deleted != 1 {
+		t.Fatalf("pull stats mismatch: got=%+v", stats)
+	}
+	assertFileContent(t, filepath.Join(back, "big.txt"), changed)
+	assertFileContent(t, filepath.Join(back, "sub", "b.txt"), "hello")
+	if _, err := os.Stat(filepath.Join(back, "extra.txt")); !os.IsNotExist(err) {
+		t.Fatalf("extra file should be deleted: err=%v", err)
+	}
+
+	stats, err = syncPull(client, back, remote, opts)
+	if err != nil {
+		t.Fatalf("second pull failed: %v", err)
+	}
+	if stats.Files != 0 || stats.Deleted != 0 {
+		t.Fatalf("up-to-date pull should be a no-op: got=%+v", stats)
+	}
+}
+
+func TestPruneNestedSyncPaths(t *testing.T) {
+	got := pruneNestedSyncPaths([]string{"a/b", "a", "ab", "c/d"})
+	want := []string{"a", "ab", "c/d"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("pruneNestedSyncPaths mismatch: got=%v want=%v", got, want)
+	}
+}
+
+func assertFileContent(t *testing.T, p, want string) {
+	t.Helper()
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("read %s failed: %v", p, err)
+	}
+	if string(got) != want {
+		t.Fatalf("content mismatch for %s: got %d bytes want %d bytes", p, len(got), len(want))
+	}
+}
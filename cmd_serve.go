@@ -15,12 +15,17 @@ func runServe(args []string) int {
 	networkName := fs.String("network-name", "", "network name (used when no pairing code provided)")
 	networkSecret := fs.String("network-secret", "", "network secret (used when no pairing code provided)")
 	peers := fs.String("peers", "", "comma-separated peer pool (used when no pairing code provided, latency-first fallback)")
+	socks := fs.Bool("socks", false, "run a SOCKS5 server on the virtual IP so the initiator can browse through this machine")
+	socksPort := fs.Int("socks-port", socksDefaultPort, "SOCKS5 port used with --socks")
+	var exposeSubnets stringListFlag
+	fs.Var(&exposeSubnets, "expose-subnet", "LAN subnet (CIDR) behind this machine to make reachable from the initiator; repeatable")
+	profileName := fs.String("profile", "", "use defaults from this profile in config.toml (also TELEHAND_PROFILE)")
 	if err := fs.Parse(args); err != nil {
 		return ExitCodeParam
 	}
 
 	if len(fs.Args()) > 1 {
-		fmt.Fprintln(os.Stderr, "Usage: telehand serve [pairing-code] [--config <code>] [--network-name ... --network-secret ... --peers ...]")
+		fmt.Fprintln(os.Stderr, "Usage: telehand serve [pairing-code] [--config <code>] [--profile name] [--network-name ... --network-secret ... --peers ...]")
 		return ExitCodeParam
 	}
 
@@ -40,13 +45,30 @@ func runServe(args []string) int {
 		encoded = positionalCode
 	}
 
-	var (
-		cfg *Config
-		err error
-	)
+	profile, err := selectProfile(*profileName)
+	// A pairing code leaves the profile's network defaults unused; only
+	// name the profile when something of it takes effect.
+	profileApplied := profile != nil && (encoded == "" || profile.appliesBesides(fs, "network-name", "network-secret", "peers"))
+	if err == nil {
+		err = profile.applyFlagDefaults(fs)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid profile: %v\n", err)
+		return ExitCodeParam
+	}
+	if profileApplied {
+		fmt.Printf("Profile: %s\n", profile.Name)
+	}
+	refreshPeerListIfStale(func(line string) { fmt.Fprintln(os.Stderr, line) })
 
+	var cfg *Config
 	if encoded == "" {
-		encoded, cfg, err = buildEncodedConfigWithDefaults(*networkName, *networkSecret, *peers)
+		key, keyErr := loadOrCreatePairingKey()
+		if keyErr != nil {
+			fmt.Fprintf(os.Stderr, "Pairing key unavailable: %v\n", keyErr)
+			return ExitCodeService
+		}
+		encoded, cfg, err = buildEncodedConfigWithDefaults(*networkName, *networkSecret, *peers, profile, pairingOptions{SigningKey: key})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Invalid defaults: %v\n", err)
 			return ExitCodeParam
@@ -59,13 +81,36 @@ func runServe(args []string) int {
 			return ExitCodeParam
 		}
 		fmt.Println("Pairing code accepted, auto-connect enabled.")
+		fmt.Printf("Pairing: %s\n", describePairing(cfg))
+		if cfg.Signer == "" {
+			fmt.Println("WARNING: UNSIGNED pairing code (legacy or TH- short code); its origin and peers cannot be verified.")
+		}
+	}
+
+	if *socks && (*socksPort <= 0 || *socksPort > 65535) {
+		fmt.Fprintln(os.Stderr, "Invalid --socks-port: must be between 1 and 65535")
+		return ExitCodeParam
+	}
+	enabledSocksPort := 0
+	if *socks {
+		enabledSocksPort = *socksPort
+	}
+	exposed, err := parseExposedSubnets(exposeSubnets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --expose-subnet: %v\n", err)
+		return ExitCodeParam
 	}
 
 	fmt.Printf("Serve network: name=%s secret=%s peers=%s\n", cfg.NetworkName, maskSecret(cfg.NetworkSecret), strings.Join(cfg.Peers, ","))
 	fmt.Println("Peer strategy: latency-first ordering + fallback (details in debug logs).")
+	if len(exposed) > 0 {
+		fmt.Printf("Exposed subnets: %s\n", strings.Join(exposed, ","))
+	}
 	return runSession(sessionOptions{
 		Role:          "server",
 		NoBrowser:     *noBrowser,
 		EncodedConfig: encoded,
+		SocksPort:     enabledSocksPort,
+		ExposeSubnets: exposed,
 	})
 }
@@ -4,16 +4,45 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
+// pairingFormatVersion is the major version of the pairing envelope. Codes
+// without "v" are the original bare config and read as version 0. Fields
+// added later without breaking older readers do not bump it.
+const pairingFormatVersion = 1
+
 type Config struct {
+	Version       int      `json:"v,omitempty"`
 	NetworkName   string   `json:"network_name"`
 	NetworkSecret string   `json:"network_secret"`
 	Peers         []string `json:"peers"`
+	// ExpiresAt is a unix timestamp after which the code is refused.
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+	// Permissions limits which API scopes the receiver serves; empty
+	// means everything, as before pairing envelopes existed.
+	Permissions []string `json:"permissions,omitempty"`
+	// APIToken, when set, must accompany every API call to the receiver.
+	APIToken         string `json:"api_token,omitempty"`
+	MinClientVersion string `json:"min_client_version,omitempty"`
+	// Signer is the initiator's Ed25519 public key and Signature its
+	// signature over every other field (see signConfig).
+	Signer    string `json:"signer,omitempty"`
+	Signature string `json:"sig,omitempty"`
+	// Nonce marks a one-time code (connect --once).
+	Nonce string `json:"nonce,omitempty"`
+	// ProxyNetworks is local-only (serve --expose-subnet) and never
+	// travels in a pairing code.
+	ProxyNetworks []string `json:"-"`
 }
 
 func EncodeConfig(c *Config) (string, error) {
-	b, err := json.Marshal(c)
+	out := *c
+	if out.Version == 0 {
+		out.Version = pairingFormatVersion
+	}
+	b, err := json.Marshal(&out)
 	if err != nil {
 		return "", err
 	}
@@ -21,6 +50,9 @@ func EncodeConfig(c *Config) (string, error) {
 }
 
 func DecodeConfig(s string) (*Config, error) {
+	if isShortCode(strings.TrimSpace(s)) {
+		return decodeShortCode(s)
+	}
 	b, err := base64.StdEncoding.DecodeString(s)
 	if err != nil {
 		return nil, fmt.Errorf("invalid config string: %w", err)
@@ -29,6 +61,10 @@ func DecodeConfig(s string) (*Config, error) {
 	if err := json.Unmarshal(b, &c); err != nil {
 		return nil, fmt.Errorf("invalid config format: %w", err)
 	}
+	if c.Version > pairingFormatVersion {
+		return nil, newCodedError(ErrorCodeConfigVersionUnsupported,
+			fmt.Sprintf("pairing code format v%d is newer than this telehand supports (v%d); please upgrade telehand", c.Version, pairingFormatVersion))
+	}
 	if c.NetworkName == "" || c.NetworkSecret == "" || len(c.Peers) == 0 {
 		return nil, fmt.Errorf("config missing required fields: network_name, network_secret, peers")
 	}
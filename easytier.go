@@ -24,13 +24,19 @@ type EasyTier struct {
 	mu      sync.Mutex
 	logs    []string
 	onLog   func(string)
+	// outputDone closes once launch's reader has drained the core output.
+	outputDone chan struct{}
 }
 
 type EasyTierStartOptions struct {
-	IPv4CIDR string
-	DevName  string
+	IPv4CIDR      string
+	DevName       string
+	ProxyNetworks []string // subnets behind this node reachable by peers
 }
 
+// maxEasyTierLogLines bounds the kept core output; a relay runs for weeks.
+const maxEasyTierLogLines = 5000
+
 func NewEasyTier(onLog func(string)) *EasyTier {
 	return &EasyTier{onLog: onLog, rpcPort: allocateRPCPort()}
 }
@@ -74,32 +80,10 @@ func ensureWindowsRuntimeDLLs(dir string) error {
 }
 
 func (et *EasyTier) Start(cfg *Config, opts EasyTierStartOptions) error {
-	dir, err := os.MkdirTemp("", "telehand-et-")
+	corePath, err := et.prepareBinaries()
 	if err != nil {
 		return err
 	}
-	et.tmpDir = dir
-
-	coreName := "easytier-core"
-	cliName := "easytier-cli"
-	if runtime.GOOS == "windows" {
-		coreName = "easytier-core.exe"
-		cliName = "easytier-cli.exe"
-	}
-
-	corePath := filepath.Join(dir, coreName)
-	if err := os.WriteFile(corePath, embeddedEasyTier, 0755); err != nil {
-		return err
-	}
-
-	et.cliBin = filepath.Join(dir, cliName)
-	if err := os.WriteFile(et.cliBin, embeddedEasyTierCli, 0755); err != nil {
-		return err
-	}
-
-	if err := ensureWindowsRuntimeDLLs(dir); err != nil {
-		return err
-	}
 
 	args := []string{
 		"--network-name", cfg.NetworkName,
@@ -119,9 +103,47 @@ func (et *EasyTier) Start(cfg *Config, opts EasyTierStartOptions) error {
 	for _, p := range cfg.Peers {
 		args = append(args, "--peers", p)
 	}
+	for _, cidr := range opts.ProxyNetworks {
+		args = append(args, "--proxy-networks", cidr)
+	}
+	return et.launch(corePath, args)
+}
+
+// prepareBinaries writes the embedded easytier-core and easytier-cli to a
+// fresh temp dir and returns the core's path.
+func (et *EasyTier) prepareBinaries() (string, error) {
+	dir, err := os.MkdirTemp("", "telehand-et-")
+	if err != nil {
+		return "", err
+	}
+	et.tmpDir = dir
+
+	coreName := "easytier-core"
+	cliName := "easytier-cli"
+	if runtime.GOOS == "windows" {
+		coreName = "easytier-core.exe"
+		cliName = "easytier-cli.exe"
+	}
+
+	corePath := filepath.Join(dir, coreName)
+	if err := os.WriteFile(corePath, embeddedEasyTier, 0755); err != nil {
+		return "", err
+	}
 
+	et.cliBin = filepath.Join(dir, cliName)
+	if err := os.WriteFile(et.cliBin, embeddedEasyTierCli, 0755); err != nil {
+		return "", err
+	}
+
+	if err := ensureWindowsRuntimeDLLs(dir); err != nil {
+		return "", err
+	}
+	return corePath, nil
+}
+
+func (et *EasyTier) launch(corePath string, args []string) error {
 	et.cmd = exec.Command(corePath, args...)
-	et.cmd.Dir = dir
+	et.cmd.Dir = et.tmpDir
 
 	stdout, err := et.cmd.StdoutPipe()
 	if err != nil {
@@ -136,12 +158,17 @@ func (et *EasyTier) Start(cfg *Config, opts EasyTierStartOptions) error {
 		et.onLog(fmt.Sprintf("[telehand] easytier rpc=%s", et.rpcPort))
 	}
 
+	et.outputDone = make(chan struct{})
 	go func() {
+		defer close(et.outputDone)
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
 			line := scanner.Text()
 			et.mu.Lock()
 			et.logs = append(et.logs, line)
+			if len(et.logs) > maxEasyTierLogLines {
+				et.logs = et.logs[len(et.logs)-maxEasyTierLogLines:]
+			}
 			et.mu.Unlock()
 			if et.onLog != nil {
 				et.onLog(line)
@@ -185,6 +212,8 @@ type PeerInfo struct {
 	Role        string `json:"role"`
 	IsSelf      bool   `json:"is_self"`
 	PeerID      string `json:"peer_id,omitempty"`
+	// Rejected explains why a one-time session refuses this peer.
+	Rejected string `json:"rejected,omitempty"`
 }
 
 type PeerInfoSnapshot struct {
@@ -192,6 +221,8 @@ type PeerInfoSnapshot struct {
 	NetworkOwner string     `json:"network_owner,omitempty"`
 	NetworkHash  string     `json:"network_hash,omitempty"`
 	Peers        []PeerInfo `json:"peers"`
+	// ExposedSubnets are LAN subnets proxied by the receiver.
+	ExposedSubnets []string `json:"exposed_subnets,omitempty"`
 }
 
 type PeerReadiness struct {
@@ -521,10 +552,20 @@ func (et *EasyTier) Logs() []string {
 	return cp
 }
 
+// wait reaps easytier-core. exec.Cmd.Wait closes the StdoutPipe and must
+// not run before all reads from it are done, so it waits for launch's
+// reader first.
+func (et *EasyTier) wait() error {
+	if et.outputDone != nil {
+		<-et.outputDone
+	}
+	return et.cmd.Wait()
+}
+
 func (et *EasyTier) Stop() {
 	if et.cmd != nil && et.cmd.Process != nil {
 		et.cmd.Process.Kill()
-		et.cmd.Wait()
+		et.wait()
 	}
 	if et.tmpDir != "" {
 		os.RemoveAll(et.tmpDir)
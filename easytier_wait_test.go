@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os/exec"
 	"testing"
 	"time"
 )
@@ -23,3 +24,22 @@ func TestWaitForIPReturnsTUNPermissionDeniedEarly(t *testing.T) {
 		t.Fatalf("expected early fail, took too long: %v", time.Since(start))
 	}
 }
+
+func TestEasyTierWaitDrainsOutputFirst(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	et := NewEasyTier(nil)
+	et.tmpDir = t.TempDir()
+	if err := et.launch(sh, []string{"-c", "i=0; while [ $i -lt 2000 ]; do echo line $i; i=$((i+1)); done"}); err != nil {
+		t.Fatalf("launch: %v", err)
+	}
+	if err := et.wait(); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	logs := et.Logs()
+	if len(logs) != 2000 || logs[len(logs)-1] != "line 1999" {
+		t.Fatalf("output cut short: %d lines, last %q", len(logs), logs[len(logs)-1])
+	}
+}
@@ -1,25 +1,77 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
 	"runtime"
 	"strings"
+	"syscall"
 )
 
 const (
-	ErrorCodeWindowsNotAdmin        = "windows_not_admin"
-	ErrorCodeWindowsAdminCheckFail  = "windows_admin_check_failed"
-	ErrorCodeWindowsTUNInitFailed   = "windows_tun_init_failed"
-	ErrorCodeWindowsFirewallBlocked = "windows_firewall_blocked"
-	ErrorCodeEasyTierStartFailed    = "easytier_start_failed"
-	ErrorCodeEasyTierIPTimeout      = "easytier_ip_timeout"
-	ErrorCodeTUNPermissionDenied    = "tun_permission_denied"
-	ErrorCodeConfigExpired          = "config_expired"
-	ErrorCodeAuthFailed             = "auth_failed"
-	ErrorCodePeerUnreachable        = "peer_unreachable"
-	ErrorCodeRouteConflictDetected  = "route_conflict_detected"
+	ErrorCodeWindowsNotAdmin          = "windows_not_admin"
+	ErrorCodeWindowsAdminCheckFail    = "windows_admin_check_failed"
+	ErrorCodeWindowsTUNInitFailed     = "windows_tun_init_failed"
+	ErrorCodeWindowsFirewallBlocked   = "windows_firewall_blocked"
+	ErrorCodeEasyTierStartFailed      = "easytier_start_failed"
+	ErrorCodeEasyTierIPTimeout        = "easytier_ip_timeout"
+	ErrorCodeTUNPermissionDenied      = "tun_permission_denied"
+	ErrorCodeConfigExpired            = "config_expired"
+	ErrorCodeConfigVersionUnsupported = "config_version_unsupported"
+	ErrorCodeConfigSignatureInvalid   = "config_signature_invalid"
+	ErrorCodeConfigAlreadyUsed        = "config_already_used"
+	ErrorCodeAuthFailed               = "auth_failed"
+	ErrorCodePeerUnreachable          = "peer_unreachable"
+	ErrorCodeRouteConflictDetected    = "route_conflict_detected"
+	ErrorCodeBinaryFile               = "binary_file"
+	ErrorCodeInvalidRange             = "invalid_range"
+	ErrorCodeBatchUnsupported         = "batch_unsupported"
+
+	// API taxonomy shared by every endpoint.
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodePermissionDenied = "permission_denied"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeIsDirectory      = "is_directory"
+	ErrorCodeNotDirectory     = "not_directory"
+	ErrorCodeAlreadyExists    = "already_exists"
+	ErrorCodeNoMatch          = "no_match"
+	ErrorCodeTooLarge         = "too_large"
+	ErrorCodeTimeout          = "timeout"
+	ErrorCodeConflict         = "conflict"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeUnsupported      = "unsupported"
+	ErrorCodeUpstreamFailed   = "upstream_failed"
+	ErrorCodeInternal         = "internal"
 )
 
+// apiV2Status is the HTTP status /v2 routes answer with for each code.
+// Codes not listed keep whatever status the handler chose.
+var apiV2Status = map[string]int{
+	ErrorCodeInvalidRequest:   http.StatusBadRequest,
+	ErrorCodeBatchUnsupported: http.StatusBadRequest,
+	ErrorCodeIsDirectory:      http.StatusBadRequest,
+	ErrorCodeNotDirectory:     http.StatusBadRequest,
+	ErrorCodeNotFound:         http.StatusNotFound,
+	ErrorCodePermissionDenied: http.StatusForbidden,
+	ErrorCodeUnauthorized:     http.StatusUnauthorized,
+	ErrorCodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	ErrorCodeAlreadyExists:    http.StatusConflict,
+	ErrorCodeConflict:         http.StatusConflict,
+	ErrorCodeTooLarge:         http.StatusRequestEntityTooLarge,
+	ErrorCodeBinaryFile:       http.StatusUnsupportedMediaType,
+	ErrorCodeInvalidRange:     http.StatusRequestedRangeNotSatisfiable,
+	ErrorCodeNoMatch:          http.StatusUnprocessableEntity,
+	ErrorCodeInternal:         http.StatusInternalServerError,
+	ErrorCodeUnsupported:      http.StatusNotImplemented,
+	ErrorCodeUpstreamFailed:   http.StatusBadGateway,
+	ErrorCodeTimeout:          http.StatusGatewayTimeout,
+}
+
 type codedError struct {
 	code string
 	msg  string
@@ -47,6 +99,61 @@ func errorCodeOf(err error) string {
 	return ""
 }
 
+// apiErrorCode maps a handler error (usually an *os.PathError) onto the
+// API taxonomy, or returns "" when only the HTTP status says anything.
+func apiErrorCode(err error) string {
+	if code := errorCodeOf(err); code != "" {
+		return code
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, errProcessNotFound):
+		return ErrorCodeNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorCodePermissionDenied
+	case errors.Is(err, fs.ErrExist):
+		return ErrorCodeAlreadyExists
+	case errors.Is(err, syscall.EISDIR):
+		return ErrorCodeIsDirectory
+	case errors.Is(err, syscall.ENOTDIR):
+		return ErrorCodeNotDirectory
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrorCodeTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorCodeTimeout
+	}
+	return ""
+}
+
+// errorCodeForStatus is the fallback code for errors that only carry an
+// HTTP status, so no error response goes out without error_code.
+func errorCodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodePermissionDenied
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrorCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrorCodeTooLarge
+	case http.StatusNotImplemented:
+		return ErrorCodeUnsupported
+	case http.StatusBadGateway:
+		return ErrorCodeUpstreamFailed
+	case http.StatusGatewayTimeout:
+		return ErrorCodeTimeout
+	default:
+		return ErrorCodeInternal
+	}
+}
+
 func classifyEasyTierError(err error, logs []string, fallback string) string {
 	return classifyEasyTierErrorByOS(runtime.GOOS, err, logs, fallback)
 }
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 )
 
@@ -83,3 +89,57 @@ func TestClassifyEasyTierErrorByOS(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIErrorCode(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_, notExist := os.Open(filepath.Join(dir, "missing"))
+	_, isDir := os.ReadFile(dir)
+	_, notDir := os.Stat(filepath.Join(file, "child"))
+	exists := os.Mkdir(dir, 0755)
+
+	type testCase struct {
+		name string
+		err  error
+		want string
+	}
+	tests := []testCase{
+		{name: "coded", err: newCodedError(ErrorCodeBinaryFile, "binary"), want: ErrorCodeBinaryFile},
+		{name: "not exist", err: notExist, want: ErrorCodeNotFound},
+		{name: "process", err: fmt.Errorf("pid 9: %w", errProcessNotFound), want: ErrorCodeNotFound},
+		{name: "permission", err: &fs.PathError{Op: "open", Path: "/x", Err: fs.ErrPermission}, want: ErrorCodePermissionDenied},
+		{name: "exists", err: exists, want: ErrorCodeAlreadyExists},
+		{name: "deadline", err: context.DeadlineExceeded, want: ErrorCodeTimeout},
+		{name: "plain", err: errors.New("boom"), want: ""},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests,
+			testCase{name: "is dir", err: isDir, want: ErrorCodeIsDirectory},
+			testCase{name: "not dir", err: notDir, want: ErrorCodeNotDirectory},
+		)
+	}
+	for _, tc := range tests {
+		if got := apiErrorCode(tc.err); got != tc.want {
+			t.Fatalf("%s: apiErrorCode(%v)=%q want %q", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestErrorCodeForStatus(t *testing.T) {
+	for status, want := range map[int]string{
+		400: ErrorCodeInvalidRequest,
+		401: ErrorCodeUnauthorized,
+		403: ErrorCodePermissionDenied,
+		404: ErrorCodeNotFound,
+		409: ErrorCodeConflict,
+		502: ErrorCodeUpstreamFailed,
+		500: ErrorCodeInternal,
+	} {
+		if got := errorCodeForStatus(status); got != want {
+			t.Fatalf("errorCodeForStatus(%d)=%q want %q", status, got, want)
+		}
+	}
+}
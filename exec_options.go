@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ExecDefaultMaxOutputBytes = 8 * 1024 * 1024
+	ExecMaxOutputBytesLimit   = 64 * 1024 * 1024
+
+	// execWaitDelay bounds how long /exec waits for output pipes after the
+	// command was killed.
+	execWaitDelay = 2 * time.Second
+)
+
+// cappedBuffer keeps the first max bytes written to it and silently drops the
+// rest, so a chatty command can neither exhaust memory nor block on a full
+// pipe.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) Len() int { return b.buf.Len() }
+
+func (b *cappedBuffer) String() string { return b.buf.String() }
+
+func (b *cappedBuffer) WriteString(s string) { b.buf.WriteString(s) }
+
+func normalizeExecMaxOutput(n int) int {
+	if n <= 0 {
+		return ExecDefaultMaxOutputBytes
+	}
+	if n > ExecMaxOutputBytesLimit {
+		return ExecMaxOutputBytesLimit
+	}
+	return n
+}
+
+// resolveExecCommand turns an ExecReq into argv. With args the program is
+// started directly; otherwise cmd runs through the requested shell, or
+// getShell() when none is given.
+func resolveExecCommand(req ExecReq) ([]string, error) {
+	if len(req.Args) > 0 {
+		if req.Cmd != "" {
+			return nil, fmt.Errorf("cmd and args are mutually exclusive")
+		}
+		if req.Shell != "" && req.Shell != "none" {
+			return nil, fmt.Errorf("args run without a shell; omit shell or set it to none")
+		}
+		return req.Args, nil
+	}
+	if req.Cmd == "" {
+		return nil, fmt.Errorf("cmd is required")
+	}
+
+	var name, flag string
+	switch strings.ToLower(strings.TrimSpace(req.Shell)) {
+	case "":
+		shell, shellFlag := getShell()
+		return []string{shell, shellFlag, req.Cmd}, nil
+	case "none":
+		return nil, fmt.Errorf("shell none requires args")
+	case "sh", "bash", "zsh", "dash", "fish":
+		name, flag = strings.ToLower(req.Shell), "-c"
+	case "pwsh", "powershell":
+		name, flag = strings.ToLower(req.Shell), "-Command"
+	case "cmd":
+		name, flag = "cmd", "/C"
+	default:
+		return nil, fmt.Errorf("unsupported shell: %s", req.Shell)
+	}
+	path, err := lookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("shell %s not found", name)
+	}
+	return []string{path, flag, req.Cmd}, nil
+}
+
+// mergeExecEnv applies overrides on top of base. Keys match case-insensitively
+// on Windows, where environment variable names are not case-sensitive.
+func mergeExecEnv(base []string, overrides map[string]string) []string {
+	if len(overrides) == 0 {
+		return nil
+	}
+	fold := runtime.GOOS == "windows"
+	norm := func(k string) string {
+		if fold {
+			return strings.ToUpper(k)
+		}
+		return k
+	}
+	skip := make(map[string]bool, len(overrides))
+	for k := range overrides {
+		skip[norm(k)] = true
+	}
+	out := make([]string, 0, len(base)+len(overrides))
+	for _, kv := range base {
+		k, _, _ := strings.Cut(kv, "=")
+		if !skip[norm(k)] {
+			out = append(out, kv)
+		}
+	}
+	keys := make([]string, 0, len(overrides))
+	for k := range overrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = append(out, k+"="+overrides[k])
+	}
+	return out
+}
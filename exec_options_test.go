@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCappedBufferTruncates(t *testing.T) {
+	b := &cappedBuffer{max: 5}
+	for _, chunk := range []string{"abc", "def", "gh"} {
+		if n, err := b.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("write must consume all input: n=%d err=%v", n, err)
+		}
+	}
+	if b.String() != "abcde" || !b.truncated {
+		t.Fatalf("capped buffer mismatch: got=%q truncated=%v", b.String(), b.truncated)
+	}
+}
+
+func TestResolveExecCommand(t *testing.T) {
+	got, err := resolveExecCommand(ExecReq{Args: []string{"echo", "a b"}})
+	if err != nil || !reflect.DeepEqual(got, []string{"echo", "a b"}) {
+		t.Fatalf("direct argv mismatch: got=%v err=%v", got, err)
+	}
+	for _, req := range []ExecReq{
+		{},
+		{Cmd: "ls", Args: []string{"ls"}},
+		{Args: []string{"ls"}, Shell: "bash"},
+		{Cmd: "ls", Shell: "none"},
+		{Cmd: "ls", Shell: "tcsh"},
+	} {
+		if _, err := resolveExecCommand(req); err == nil {
+			t.Fatalf("resolveExecCommand(%+v) should fail", req)
+		}
+	}
+}
+
+func TestMergeExecEnvOverridesAndAppends(t *testing.T) {
+	got := mergeExecEnv([]string{"PATH=/bin", "HOME=/root"}, map[string]string{"HOME": "/tmp", "FOO": "bar"})
+	want := []string{"PATH=/bin", "FOO=bar", "HOME=/tmp"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mergeExecEnv mismatch: got=%v want=%v", got, want)
+	}
+	if mergeExecEnv([]string{"A=1"}, nil) != nil {
+		t.Fatalf("no overrides should inherit the environment")
+	}
+}
+
+func TestAPIExecOptions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX sh")
+	}
+	s := NewAPIServer("127.0.0.1", 20380, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	url := fmt.Sprintf("http://127.0.0.1:%d/exec", s.Port())
+	client := &http.Client{Timeout: 8 * time.Second}
+
+	run := func(req ExecReq) ExecResp {
+		t.Helper()
+		status, out := callRaw(t, client, http.MethodPost, url, req)
+		if status != http.StatusOK {
+			t.Fatalf("exec status=%d body=%s", status, out)
+		}
+		var resp ExecResp
+		if err := json.Unmarshal(out, &resp); err != nil {
+			t.Fatalf("decode exec resp failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := run(ExecReq{Cmd: `read line; echo "$line-$GREETING"`, Shell: "sh", Stdin: "hi\n", Env: map[string]string{"GREETING": "there"}})
+	if resp.Stdout != "hi-there\n" || resp.Code != 0 {
+		t.Fatalf("stdin/env exec mismatch: got=%+v", resp)
+	}
+
+	resp = run(ExecReq{Args: []string{"printf", "%s", "a;b $HOME"}})
+	if resp.Stdout != "a;b $HOME" {
+		t.Fatalf("argv exec should not use a shell: got=%+v", resp)
+	}
+
+	resp = run(ExecReq{Cmd: "yes | head -c 10000", MaxOutputBytes: 100})
+	if len(resp.Stdout) != 100 || !resp.StdoutTruncated || resp.StderrTruncated {
+		t.Fatalf("output cap mismatch: len=%d resp=%+v", len(resp.Stdout), resp.StdoutTruncated)
+	}
+
+	resp = run(ExecReq{Cmd: "kill -TERM $$", Shell: "sh"})
+	if resp.Signal != "TERM" || resp.Code != 143 {
+		t.Fatalf("signal exit mismatch: got=%+v", resp)
+	}
+
+	resp = run(ExecReq{Cmd: "sleep 0.2"})
+	if resp.DurationMs < 150 {
+		t.Fatalf("duration too small: got=%d", resp.DurationMs)
+	}
+
+	status, out := callRaw(t, client, http.MethodPost, url, ExecReq{Cmd: "true", Env: map[string]string{"A=B": "x"}})
+	if status != http.StatusBadRequest || !strings.Contains(string(out), "invalid env name") {
+		t.Fatalf("invalid env should be rejected: status=%d body=%s", status, out)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAPIExecTimeoutKillsProcessTree(t *testing.T) {
+	s := NewAPIServer("127.0.0.1", 20480, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	url := fmt.Sprintf("http://127.0.0.1:%d/exec", s.Port())
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	// The background children inherit stdout, so killing only the shell
+	// would leave the request hanging for the full sleep.
+	pidFile := filepath.Join(t.TempDir(), "pids")
+	cmd := fmt.Sprintf("sleep 30 & echo $! >> %s; sleep 30 & echo $! >> %s; wait", pidFile, pidFile)
+	started := time.Now()
+	status, out := callRaw(t, client, http.MethodPost, url, ExecReq{Cmd: cmd, Shell: "sh", TimeoutSec: 1})
+	elapsed := time.Since(started)
+	if status != http.StatusOK {
+		t.Fatalf("exec status=%d body=%s", status, out)
+	}
+	var resp ExecResp
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("decode exec resp failed: %v", err)
+	}
+	if resp.Code != 124 || resp.KilledChildren != 2 {
+		t.Fatalf("timeout tree kill mismatch: got=%+v", resp)
+	}
+	if elapsed > 5*time.Second {
+		t.Fatalf("timed out exec took too long: %v", elapsed)
+	}
+
+	raw, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("read pid file failed: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for _, field := range strings.Fields(string(raw)) {
+		pid, _ := strconv.Atoi(field)
+		// Reaped or zombie children both count as gone.
+		for syscall.Kill(pid, 0) == nil && !processIsZombie(pid) {
+			if time.Now().After(deadline) {
+				t.Fatalf("child %d still running after timeout", pid)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+// Only a timeout or disconnect kills the tree: a command that exits
+// normally may leave a background child running, on every platform.
+func TestAPIExecSuccessLeavesBackgroundChildren(t *testing.T) {
+	s := NewAPIServer("127.0.0.1", 21680, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	url := fmt.Sprintf("http://127.0.0.1:%d/exec", s.Port())
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	status, out := callRaw(t, client, http.MethodPost, url, ExecReq{Cmd: "sleep 30 >/dev/null 2>&1 & echo $!", Shell: "sh", TimeoutSec: 10})
+	if status != http.StatusOK {
+		t.Fatalf("exec status=%d body=%s", status, out)
+	}
+	var resp ExecResp
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("decode exec resp failed: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(resp.Stdout))
+	if resp.Code != 0 || resp.KilledChildren != 0 || err != nil {
+		t.Fatalf("unexpected exec result: %+v", resp)
+	}
+	defer syscall.Kill(pid, syscall.SIGKILL)
+	time.Sleep(200 * time.Millisecond)
+	if syscall.Kill(pid, 0) != nil || processIsZombie(pid) {
+		t.Fatalf("background child %d should still run after a clean exit", pid)
+	}
+}
+
+func processIsZombie(pid int) bool {
+	raw, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return runtime.GOOS != "linux"
+	}
+	i := strings.LastIndexByte(string(raw), ')')
+	return i > 0 && len(raw) > i+2 && raw[i+2] == 'Z'
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// processTree runs a command in its own process group so that everything it
+// spawns can be killed together.
+type processTree struct {
+	cmd *exec.Cmd
+}
+
+func newProcessTree(cmd *exec.Cmd) *processTree {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	return &processTree{cmd: cmd}
+}
+
+func (t *processTree) started() {}
+
+func (t *processTree) close() {}
+
+// kill terminates the group and any descendant that left it (setsid, nohup
+// wrappers) and reports how many processes besides the leader were killed.
+func (t *processTree) kill() int {
+	if t.cmd.Process == nil {
+		return 0
+	}
+	pid := t.cmd.Process.Pid
+	var desc []int
+	// The request context is already done when kill runs.
+	ctx, cancel := context.WithTimeout(context.Background(), procCommandTimeout)
+	defer cancel()
+	if procs, err := listProcessesFn(ctx); err == nil {
+		desc = processDescendants(procs, pid)
+	}
+	_ = syscall.Kill(-pid, syscall.SIGKILL)
+	for _, child := range desc {
+		_ = syscall.Kill(child, syscall.SIGKILL)
+	}
+	return len(desc)
+}
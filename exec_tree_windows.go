@@ -0,0 +1,97 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+const (
+	processSetQuota  = 0x0100
+	processTerminate = 0x0001
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+)
+
+// processTree places a command in a job object; child processes inherit the
+// job, so terminating it ends the whole tree. The job is created before the
+// command starts, so a cancel that lands while the process is still being
+// assigned finds it, and it has no kill-on-close limit: like the Unix
+// process group, background children of a command that exits normally are
+// left running.
+type processTree struct {
+	cmd *exec.Cmd
+
+	mu  sync.Mutex
+	job syscall.Handle
+}
+
+func newProcessTree(cmd *exec.Cmd) *processTree {
+	t := &processTree{cmd: cmd}
+	if job, _, _ := procCreateJobObjectW.Call(0, 0); job != 0 {
+		t.job = syscall.Handle(job)
+	}
+	return t
+}
+
+func (t *processTree) started() {
+	if t.cmd.Process == nil {
+		return
+	}
+	h, err := syscall.OpenProcess(processSetQuota|processTerminate, false, uint32(t.cmd.Process.Pid))
+	if err != nil {
+		return
+	}
+	defer syscall.CloseHandle(h)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.job != 0 {
+		procAssignProcessToJobObject.Call(uintptr(t.job), uintptr(h))
+	}
+}
+
+// close releases the job without touching the processes in it.
+func (t *processTree) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.job != 0 {
+		syscall.CloseHandle(t.job)
+		t.job = 0
+	}
+}
+
+func (t *processTree) kill() int {
+	if t.cmd.Process == nil {
+		return 0
+	}
+	pid := t.cmd.Process.Pid
+	var desc []int
+	// The request context is already done when kill runs.
+	ctx, cancel := context.WithTimeout(context.Background(), procCommandTimeout)
+	defer cancel()
+	if procs, err := listProcessesFn(ctx); err == nil {
+		desc = processDescendants(procs, pid)
+	}
+	t.mu.Lock()
+	if t.job != 0 {
+		procTerminateJobObject.Call(uintptr(t.job), 1)
+	}
+	t.mu.Unlock()
+	// Processes spawned before the job was assigned are not in it.
+	for _, child := range desc {
+		if h, err := syscall.OpenProcess(processTerminate, false, uint32(child)); err == nil {
+			syscall.TerminateProcess(h, 1)
+			syscall.CloseHandle(h)
+		}
+	}
+	_ = t.cmd.Process.Kill()
+	return len(desc)
+}
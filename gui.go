@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"image/png"
 	"net"
 	"net/http"
 	"runtime"
@@ -25,6 +26,8 @@ type GUIServer struct {
 	logs       []CmdLog
 	debugLogs  []string
 	peerInfoFn func() (PeerInfoSnapshot, error)
+	forwardsFn func() []TunnelInfo
+	checkFn    func(*Config) error
 }
 
 type GUIState struct {
@@ -43,6 +46,10 @@ type GUIState struct {
 	ErrorCode        string           `json:"error_code,omitempty"`
 	ClipboardCommand string           `json:"clipboard_command,omitempty"`
 	Commands         []InstallCommand `json:"commands,omitempty"`
+	ExposedSubnets   []string         `json:"exposed_subnets,omitempty"`
+	APIToken         string           `json:"api_token,omitempty"`
+	// Signer is the pairing code's key fingerprint, or "unsigned".
+	Signer string `json:"signer,omitempty"`
 }
 
 type InstallCommand struct {
@@ -69,7 +76,9 @@ func NewGUIServer(startPort int) *GUIServer {
 	g.mux.HandleFunc("/api/logs", g.handleLogs)
 	g.mux.HandleFunc("/api/debug-logs", g.handleDebugLogs)
 	g.mux.HandleFunc("/api/peer-info", g.handlePeerInfo)
+	g.mux.HandleFunc("/api/forwards", g.handleForwards)
 	g.mux.HandleFunc("/api/stop", g.handleStop)
+	g.mux.HandleFunc("/api/qr.png", g.handleQR)
 	return g
 }
 
@@ -106,6 +115,20 @@ func (g *GUIServer) SetPeerInfoProvider(fn func() (PeerInfoSnapshot, error)) {
 	g.mu.Unlock()
 }
 
+// SetConfigCheck adds a role-specific check run on every submitted config
+// before it is accepted.
+func (g *GUIServer) SetConfigCheck(fn func(*Config) error) {
+	g.mu.Lock()
+	g.checkFn = fn
+	g.mu.Unlock()
+}
+
+func (g *GUIServer) SetForwardsProvider(fn func() []TunnelInfo) {
+	g.mu.Lock()
+	g.forwardsFn = fn
+	g.mu.Unlock()
+}
+
 func (g *GUIServer) GetState() GUIState {
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -131,7 +154,7 @@ func (g *GUIServer) Stop() {
 }
 
 func (g *GUIServer) SubmitConfigEncoded(encoded string) error {
-	cfg, err := DecodeConfig(encoded)
+	cfg, err := decodeConfigWithValidation(encoded)
 	if err != nil {
 		return err
 	}
@@ -149,6 +172,14 @@ func (g *GUIServer) SubmitConfig(cfg *Config) error {
 	if len(g.configCh) > 0 {
 		return ErrConfigPending
 	}
+	g.mu.Lock()
+	checkFn := g.checkFn
+	g.mu.Unlock()
+	if checkFn != nil {
+		if err := checkFn(cfg); err != nil {
+			return err
+		}
+	}
 	if err := precheckBeforeConnect(cfg); err != nil {
 		state.Phase = "error"
 		state.VirtIP = ""
@@ -163,6 +194,7 @@ func (g *GUIServer) SubmitConfig(cfg *Config) error {
 		state.VirtIP = ""
 		state.Error = ""
 		state.ErrorCode = ""
+		state.Signer = signerFingerprint(cfg)
 		g.SetState(state)
 		return nil
 	default:
@@ -270,11 +302,40 @@ func (g *GUIServer) handlePeerInfo(w http.ResponseWriter, r *http.Request) {
 	jsonResp(w, 200, snapshot)
 }
 
+func (g *GUIServer) handleForwards(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	fn := g.forwardsFn
+	g.mu.Unlock()
+	if fn == nil {
+		jsonResp(w, 200, []TunnelInfo{})
+		return
+	}
+	jsonResp(w, 200, fn())
+}
+
 func (g *GUIServer) handleStop(w http.ResponseWriter, r *http.Request) {
 	jsonResp(w, 200, map[string]string{"ok": "true"})
 	go func() { g.configCh <- nil }()
 }
 
+// handleQR renders ?text= as a QR code PNG, so the page can show a pairing
+// command for scanning without any online QR service.
+func (g *GUIServer) handleQR(w http.ResponseWriter, r *http.Request) {
+	text := r.URL.Query().Get("text")
+	if text == "" {
+		jsonResp(w, 400, map[string]string{"error": "text is required"})
+		return
+	}
+	code, err := encodeQR(text, qrLevelM)
+	if err != nil {
+		jsonResp(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	png.Encode(w, code.Image(6))
+}
+
 func jsonResp(w http.ResponseWriter, code int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -23,7 +25,12 @@ func TestSubmitConfigReturns409WhenPending(t *testing.T) {
 	}
 
 	// Use a valid config and assert pending conflict.
-	cfg, err := EncodeConfig(&Config{NetworkName: "n", NetworkSecret: "s", Peers: []string{"tcp://1.1.1.1:11010"}})
+	withTempConfigDir(t)
+	key, err := loadOrCreatePairingKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	cfg, _, err := buildEncodedConfigWithDefaults("n", "s", "tcp://1.1.1.1:11010", nil, pairingOptions{SigningKey: key})
 	if err != nil {
 		t.Fatalf("encode config failed: %v", err)
 	}
@@ -77,3 +84,44 @@ func TestPeerInfoEndpoint(t *testing.T) {
 		t.Fatalf("expected peer is_self=true")
 	}
 }
+
+func TestForwardsEndpointDefaultsToEmptyList(t *testing.T) {
+	g := NewGUIServer(18080)
+	w := httptest.NewRecorder()
+	g.handleForwards(w, httptest.NewRequest(http.MethodGet, "/api/forwards", nil))
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("expected empty list, got %d body=%s", w.Code, w.Body.String())
+	}
+
+	g.SetForwardsProvider(func() []TunnelInfo {
+		return []TunnelInfo{{ID: 1, Kind: TunnelModeLocal, Addr: "127.0.0.1:5432"}}
+	})
+	w = httptest.NewRecorder()
+	g.handleForwards(w, httptest.NewRequest(http.MethodGet, "/api/forwards", nil))
+	var resp []TunnelInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp) != 1 || resp[0].Addr != "127.0.0.1:5432" {
+		t.Fatalf("forwards mismatch: err=%v body=%s", err, w.Body.String())
+	}
+}
+
+func TestQREndpointRendersPNG(t *testing.T) {
+	g := NewGUIServer(18080)
+	w := httptest.NewRecorder()
+	g.handleQR(w, httptest.NewRequest(http.MethodGet, "/api/qr.png?text=TH-ABCD-EFGH", nil))
+	if w.Code != 200 || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != b.Dy() || b.Dx()%6 != 0 {
+		t.Fatalf("unexpected image bounds %v", b)
+	}
+
+	w = httptest.NewRecorder()
+	g.handleQR(w, httptest.NewRequest(http.MethodGet, "/api/qr.png", nil))
+	if w.Code != 400 {
+		t.Fatalf("missing text: expected 400, got %d", w.Code)
+	}
+}
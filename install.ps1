@@ -1,5 +1,7 @@
 param(
-    [string]$Version
+    [string]$Version,
+    # Internal release mirror, tried as <BaseUrl>/<version>/<zip> before GitHub.
+    [string]$BaseUrl
 )
 
 $ErrorActionPreference = "Stop"
@@ -46,6 +48,9 @@ $urls = @(
     "https://github.com/$repo/releases/download/$version/$filename",
     "https://ghfast.top/https://github.com/$repo/releases/download/$version/$filename"
 )
+if ($BaseUrl) {
+    $urls = @("$($BaseUrl.TrimEnd('/'))/$version/$filename") + $urls
+}
 
 Write-Host "Installing telehand $version (windows/$arch, source: $versionSource)..."
 
@@ -4,9 +4,11 @@ set -e
 REPO="sfpprxy/telehand"
 BINARY_NAME="telehand"
 VERSION=""
+BASE_URL=""
 
 usage() {
-  echo "Usage: $0 [--version <vX.Y.Z[-alpha.N]>]"
+  echo "Usage: $0 [--version <vX.Y.Z[-alpha.N]>] [--base-url <mirror>]"
+  echo "  --base-url  try <mirror>/<version>/<zip> before GitHub (internal release mirror)"
 }
 
 while [[ $# -gt 0 ]]; do
@@ -20,6 +22,15 @@ while [[ $# -gt 0 ]]; do
       VERSION="$2"
       shift 2
       ;;
+    --base-url)
+      if [[ -z "${2:-}" ]]; then
+        echo "Error: --base-url requires a value"
+        usage
+        exit 1
+      fi
+      BASE_URL="${2%/}"
+      shift 2
+      ;;
     -h|--help)
       usage
       exit 0
@@ -82,6 +93,9 @@ URLS=(
   "https://github.com/${REPO}/releases/download/${VERSION}/${FILENAME}"
   "https://ghfast.top/https://github.com/${REPO}/releases/download/${VERSION}/${FILENAME}"
 )
+if [[ -n "$BASE_URL" ]]; then
+  URLS=("${BASE_URL}/${VERSION}/${FILENAME}" "${URLS[@]}")
+fi
 
 echo "Installing ${BINARY_NAME} ${VERSION} (${GOOS}/${GOARCH}, source: ${VERSION_SOURCE})..."
 
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The commands connect prints (and the GUI lists) for the remote side. By
+// default they fetch install.sh / install.ps1 from GitHub; a profile can
+// point them at a mirror, pin a version, install from a directory the
+// receiver already has, pick which variants to show, and add its own.
+
+// defaultInstallMirror fronts GitHub for the Windows one-liner, where raw
+// GitHub is often unreachable. An install_mirror replaces it and applies to
+// every platform.
+const defaultInstallMirror = "https://ghfast.top/"
+
+const defaultInstallScriptBase = "https://raw.githubusercontent.com/sfpprxy/telehand/main/"
+
+// githubReleaseBase is where the scripts find <version>/<zip> on GitHub;
+// an install_mirror without install_release_base fronts it for the zips.
+const githubReleaseBase = "https://github.com/sfpprxy/telehand/releases/download"
+
+// installSettings are the install_* keys of a profile.
+type installSettings struct {
+	// Mirror is a proxy prefix put in front of the script URL and, unless
+	// ReleaseBase is set, of the GitHub release downloads.
+	Mirror string
+	// ScriptBase is where install.sh and install.ps1 live.
+	ScriptBase string
+	// ReleaseBase is passed to the scripts to download release zips from
+	// <ReleaseBase>/<version>/ instead of GitHub.
+	ReleaseBase string
+	// Version pins the release the scripts install.
+	Version string
+	// OfflineDir is a directory on the receiver holding release zips.
+	OfflineDir string
+	// Variants selects and orders the built-in commands.
+	Variants []string
+	// Templates are extra commands. {code}, {version}, {mirror},
+	// {script_base}, {release_base} and {offline_dir} are filled in.
+	Templates []InstallCommand
+}
+
+type installVariant struct {
+	Name     string
+	Platform string
+	render   func(r installRender) string
+}
+
+// installRender carries the resolved pieces a variant is assembled from.
+type installRender struct {
+	code       string
+	version    string
+	offlineDir string
+	shURL      string
+	psURL      string
+	shArgs     []string
+	psArgs     []string
+}
+
+var defaultInstallVariants = []string{"powershell", "unix", "powershell-run", "unix-run"}
+
+var installVariants = []installVariant{
+	{"powershell", "Windows (PowerShell，下载并运行)", func(r installRender) string {
+		return fmt.Sprintf("%s; .\\telehand.exe serve '%s'", r.psInstall(), r.code)
+	}},
+	{"unix", "macOS / Linux（下载并运行）", func(r installRender) string {
+		return fmt.Sprintf("%s && sudo ./telehand serve '%s'", r.shInstall(), r.code)
+	}},
+	{"linux-root", "Linux（root 用户，无 sudo，下载并运行）", func(r installRender) string {
+		return fmt.Sprintf("%s && ./telehand serve '%s'", r.shInstall(), r.code)
+	}},
+	{"cmd", "Windows (cmd.exe，下载并运行)", func(r installRender) string {
+		return fmt.Sprintf("powershell -NoProfile -ExecutionPolicy Bypass -Command \"%s; .\\telehand.exe serve '%s'\"", r.psInstall(), r.code)
+	}},
+	{"powershell-run", "Windows (PowerShell，仅运行)", func(r installRender) string {
+		return fmt.Sprintf(".\\telehand.exe serve '%s'", r.code)
+	}},
+	{"cmd-run", "Windows (cmd.exe，仅运行)", func(r installRender) string {
+		return fmt.Sprintf("telehand.exe serve \"%s\"", r.code)
+	}},
+	{"unix-run", "macOS / Linux（仅运行）", func(r installRender) string {
+		return fmt.Sprintf("sudo ./telehand serve '%s'", r.code)
+	}},
+	{"offline-powershell", "Windows (PowerShell，离线安装并运行)", func(r installRender) string {
+		return fmt.Sprintf("$a = if ([Environment]::Is64BitOperatingSystem) { 'amd64' } else { '386' }; "+
+			"Expand-Archive -Path \"%s\\telehand-windows-$a-%s.zip\" -DestinationPath . -Force; .\\telehand.exe serve '%s'",
+			strings.TrimRight(r.offlineDir, `\/`), r.version, r.code)
+	}},
+	{"offline-unix", "macOS / Linux（离线安装并运行）", func(r installRender) string {
+		return fmt.Sprintf("unzip -o \"%s/telehand-$(uname -s | tr '[:upper:]' '[:lower:]')-$(uname -m | sed -e s/x86_64/amd64/ -e s/aarch64/arm64/)-%s.zip\" && sudo ./telehand serve '%s'",
+			strings.TrimRight(r.offlineDir, "/"), r.version, r.code)
+	}},
+}
+
+func lookupInstallVariant(name string) (installVariant, bool) {
+	for _, v := range installVariants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return installVariant{}, false
+}
+
+func installVariantNames() []string {
+	names := make([]string, 0, len(installVariants))
+	for _, v := range installVariants {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// normalizeReleaseTag turns "0.4.0" into the "v0.4.0" tag the scripts want.
+func normalizeReleaseTag(v string) string {
+	v = strings.TrimSpace(v)
+	if v != "" && !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	return v
+}
+
+func (r installRender) shInstall() string {
+	if len(r.shArgs) == 0 {
+		return fmt.Sprintf("curl -fsSL %s | bash", r.shURL)
+	}
+	return fmt.Sprintf("curl -fsSL %s | bash -s -- %s", r.shURL, strings.Join(r.shArgs, " "))
+}
+
+func (r installRender) psInstall() string {
+	if len(r.psArgs) == 0 {
+		return fmt.Sprintf("iwr -useb %s | iex", r.psURL)
+	}
+	// Piping into iex cannot pass parameters; a script block can, and unlike
+	// a saved install.ps1 it is not blocked by the execution policy.
+	return fmt.Sprintf("& ([scriptblock]::Create((iwr -useb %s))) %s", r.psURL, strings.Join(r.psArgs, " "))
+}
+
+func buildRemoteInstallCommands(pairingCode string, profile *Profile) []InstallCommand {
+	var s installSettings
+	if profile != nil {
+		s = profile.Install
+	}
+	code := strings.TrimSpace(pairingCode)
+
+	scriptBase := strings.TrimSpace(s.ScriptBase)
+	if scriptBase == "" {
+		scriptBase = defaultInstallScriptBase
+	}
+	scriptBase = withTrailingSlash(scriptBase)
+	windowsMirror, unixMirror := "", ""
+	if m := strings.TrimSpace(s.Mirror); m != "" {
+		windowsMirror, unixMirror = withTrailingSlash(m), withTrailingSlash(m)
+	} else if scriptBase == defaultInstallScriptBase {
+		windowsMirror = defaultInstallMirror
+	}
+
+	// A release mirror or offline copy cannot ask GitHub for "latest", so
+	// they default to this build's own version.
+	version := normalizeReleaseTag(s.Version)
+	releaseBase := strings.TrimRight(strings.TrimSpace(s.ReleaseBase), "/")
+	if releaseBase == "" && unixMirror != "" {
+		releaseBase = unixMirror + githubReleaseBase
+	}
+	if version == "" && (releaseBase != "" || s.OfflineDir != "") {
+		version = normalizeReleaseTag(telehandVersion)
+	}
+
+	r := installRender{
+		code:       code,
+		version:    version,
+		offlineDir: strings.TrimSpace(s.OfflineDir),
+		shURL:      unixMirror + scriptBase + "install.sh",
+		psURL:      windowsMirror + scriptBase + "install.ps1",
+	}
+	if version != "" {
+		r.shArgs = append(r.shArgs, "--version", version)
+		r.psArgs = append(r.psArgs, "-Version", version)
+	}
+	if releaseBase != "" {
+		r.shArgs = append(r.shArgs, "--base-url", releaseBase)
+		r.psArgs = append(r.psArgs, "-BaseUrl", releaseBase)
+	}
+
+	names := s.Variants
+	if len(names) == 0 {
+		names = defaultInstallVariants
+		if r.offlineDir != "" {
+			names = append(append([]string{}, names...), "offline-powershell", "offline-unix")
+		}
+	}
+	var out []InstallCommand
+	for _, name := range names {
+		v, ok := lookupInstallVariant(name)
+		if !ok || (strings.HasPrefix(name, "offline-") && r.offlineDir == "") {
+			continue
+		}
+		out = append(out, InstallCommand{Platform: v.Platform, Command: v.render(r)})
+	}
+
+	replacer := strings.NewReplacer(
+		"{code}", code,
+		"{version}", version,
+		"{mirror}", unixMirror,
+		"{script_base}", scriptBase,
+		"{release_base}", releaseBase,
+		"{offline_dir}", r.offlineDir,
+	)
+	for _, t := range s.Templates {
+		out = append(out, InstallCommand{Platform: t.Platform, Command: replacer.Replace(t.Command)})
+	}
+	return out
+}
+
+// parseInstallTemplate reads an install_templates entry, "label=command".
+func parseInstallTemplate(entry string) (InstallCommand, error) {
+	label, command, ok := strings.Cut(entry, "=")
+	label, command = strings.TrimSpace(label), strings.TrimSpace(command)
+	if !ok || label == "" || command == "" {
+		return InstallCommand{}, fmt.Errorf("install_templates entry %q must look like \"label=command\"", entry)
+	}
+	if !strings.Contains(command, "{code}") {
+		return InstallCommand{}, fmt.Errorf("install_templates entry %q has no {code} placeholder", label)
+	}
+	return InstallCommand{Platform: label, Command: command}, nil
+}
+
+func withTrailingSlash(s string) string {
+	if !strings.HasSuffix(s, "/") {
+		s += "/"
+	}
+	return s
+}
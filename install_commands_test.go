@@ -0,0 +1,157 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildRemoteInstallCommandsContainsPairingCode(t *testing.T) {
+	code := "abc123=="
+	cmds := buildRemoteInstallCommands(code, nil)
+	if len(cmds) != 4 {
+		t.Fatalf("expected 4 platform commands, got %d", len(cmds))
+	}
+	hasWindowsInstall := false
+	hasUnixInstall := false
+	hasWindowsRunOnly := false
+	hasUnixRunOnly := false
+	for _, c := range cmds {
+		if !strings.Contains(c.Command, code) {
+			t.Fatalf("command for %s does not contain pairing code: %s", c.Platform, c.Command)
+		}
+		if c.Platform == "Windows (PowerShell，下载并运行)" {
+			hasWindowsInstall = true
+		}
+		if c.Platform == "macOS / Linux（下载并运行）" {
+			hasUnixInstall = true
+		}
+		if c.Platform == "Windows (PowerShell，仅运行)" {
+			hasWindowsRunOnly = true
+			if strings.Contains(c.Command, "install.ps1") {
+				t.Fatalf("run-only windows command should not contain installer: %s", c.Command)
+			}
+		}
+		if c.Platform == "macOS / Linux（仅运行）" {
+			hasUnixRunOnly = true
+			if strings.Contains(c.Command, "install.sh") || strings.Contains(c.Command, "curl ") {
+				t.Fatalf("run-only unix command should not contain installer: %s", c.Command)
+			}
+		}
+	}
+	if !hasWindowsInstall {
+		t.Fatalf("expected Windows install command")
+	}
+	if !hasUnixInstall {
+		t.Fatalf("expected macOS/Linux install command")
+	}
+	if !hasWindowsRunOnly {
+		t.Fatalf("expected Windows run-only command")
+	}
+	if !hasUnixRunOnly {
+		t.Fatalf("expected macOS/Linux run-only command")
+	}
+}
+
+func TestBuildRemoteInstallCommandsUsesProfileMirror(t *testing.T) {
+	cmds := buildRemoteInstallCommands("abc123==", &Profile{Install: installSettings{Mirror: "https://mirror.example.com"}})
+	for _, c := range cmds[:2] {
+		if !strings.Contains(c.Command, "https://mirror.example.com/https://raw.githubusercontent.com/") {
+			t.Fatalf("command for %s does not use the mirror: %s", c.Platform, c.Command)
+		}
+		if strings.Contains(c.Command, "ghfast.top") {
+			t.Fatalf("command for %s still uses the default mirror: %s", c.Platform, c.Command)
+		}
+	}
+	// The release zips go through the mirror too, pinned to this build.
+	tag := normalizeReleaseTag(telehandVersion)
+	want := []string{
+		"& ([scriptblock]::Create((iwr -useb https://mirror.example.com/https://raw.githubusercontent.com/sfpprxy/telehand/main/install.ps1))) -Version " + tag +
+			" -BaseUrl https://mirror.example.com/https://github.com/sfpprxy/telehand/releases/download; .\\telehand.exe serve 'abc123=='",
+		"curl -fsSL https://mirror.example.com/https://raw.githubusercontent.com/sfpprxy/telehand/main/install.sh | bash -s -- --version " + tag +
+			" --base-url https://mirror.example.com/https://github.com/sfpprxy/telehand/releases/download && sudo ./telehand serve 'abc123=='",
+	}
+	for i, w := range want {
+		if cmds[i].Command != w {
+			t.Fatalf("command %d:\n got %s\nwant %s", i, cmds[i].Command, w)
+		}
+	}
+}
+
+func TestBuildRemoteInstallCommandsDefaultsUnchanged(t *testing.T) {
+	cmds := buildRemoteInstallCommands("abc", nil)
+	want := []string{
+		"iwr -useb https://ghfast.top/https://raw.githubusercontent.com/sfpprxy/telehand/main/install.ps1 | iex; .\\telehand.exe serve 'abc'",
+		"curl -fsSL https://raw.githubusercontent.com/sfpprxy/telehand/main/install.sh | bash && sudo ./telehand serve 'abc'",
+		".\\telehand.exe serve 'abc'",
+		"sudo ./telehand serve 'abc'",
+	}
+	for i, c := range cmds {
+		if c.Command != want[i] {
+			t.Fatalf("command %d:\n got %s\nwant %s", i, c.Command, want[i])
+		}
+	}
+}
+
+func TestBuildRemoteInstallCommandsInternalMirror(t *testing.T) {
+	profile := &Profile{Install: installSettings{
+		ScriptBase:  "https://mirror.corp/telehand/",
+		ReleaseBase: "https://mirror.corp/telehand/releases/",
+		Version:     "v0.3.1",
+		Variants:    []string{"cmd", "linux-root", "cmd-run"},
+		Templates:   []InstallCommand{{Platform: "Jump host", Command: "ssh jump telehand-install {version} '{code}'"}},
+	}}
+	cmds := buildRemoteInstallCommands("abc", profile)
+	want := []InstallCommand{
+		{"Windows (cmd.exe，下载并运行)", "powershell -NoProfile -ExecutionPolicy Bypass -Command \"& ([scriptblock]::Create((iwr -useb https://mirror.corp/telehand/install.ps1))) -Version v0.3.1 -BaseUrl https://mirror.corp/telehand/releases; .\\telehand.exe serve 'abc'\""},
+		{"Linux（root 用户，无 sudo，下载并运行）", "curl -fsSL https://mirror.corp/telehand/install.sh | bash -s -- --version v0.3.1 --base-url https://mirror.corp/telehand/releases && ./telehand serve 'abc'"},
+		{"Windows (cmd.exe，仅运行)", "telehand.exe serve \"abc\""},
+		{"Jump host", "ssh jump telehand-install v0.3.1 'abc'"},
+	}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Fatalf("got %#v", cmds)
+	}
+}
+
+func TestBuildRemoteInstallCommandsOffline(t *testing.T) {
+	cmds := buildRemoteInstallCommands("abc", &Profile{Install: installSettings{OfflineDir: "/mnt/tools/"}})
+	if len(cmds) != 6 {
+		t.Fatalf("expected defaults plus two offline commands, got %d", len(cmds))
+	}
+	unix := cmds[5].Command
+	tag := normalizeReleaseTag(telehandVersion)
+	if !strings.HasPrefix(unix, `unzip -o "/mnt/tools/telehand-`) || !strings.Contains(unix, "-"+tag+`.zip"`) || strings.Contains(unix, "curl") {
+		t.Fatalf("unexpected offline command: %s", unix)
+	}
+	if !strings.Contains(cmds[4].Command, `Expand-Archive -Path "/mnt/tools\telehand-windows-$a-`+tag+`.zip"`) {
+		t.Fatalf("unexpected offline windows command: %s", cmds[4].Command)
+	}
+}
+
+func TestProfileInstallKeys(t *testing.T) {
+	cfg, err := parseTelehandConfig([]byte(`
+[profiles.corp]
+install_version = "0.3.1"
+install_variants = ["cmd", "offline-unix"]
+install_offline_dir = "/mnt/tools"
+install_templates = ["Jump host=ssh jump install, then serve '{code}'"]
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	in := cfg.Profiles["corp"].Install
+	if in.Version != "v0.3.1" || !reflect.DeepEqual(in.Variants, []string{"cmd", "offline-unix"}) ||
+		len(in.Templates) != 1 || in.Templates[0].Platform != "Jump host" {
+		t.Fatalf("unexpected install settings: %+v", in)
+	}
+
+	for input, want := range map[string]string{
+		"[profiles.a]\ninstall_variants = [\"bash\"]\n":              "unknown install variant",
+		"[profiles.a]\ninstall_variants = [\"offline-unix\"]\n":      "needs install_offline_dir",
+		"[profiles.a]\ninstall_templates = [\"no placeholder=x\"]\n": "no {code} placeholder",
+	} {
+		if _, err := parseTelehandConfig([]byte(input)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: got %v, want %q", input, err, want)
+		}
+	}
+}
@@ -24,8 +24,14 @@ func runMain(args []string) int {
 		return runConnect(args[1:])
 	case "gen-config":
 		return runGenConfig(args[1:])
+	case "remote":
+		return runRemote(args[1:])
+	case "relay":
+		return runRelay(args[1:])
+	case "peers":
+		return runPeers(args[1:])
 	default:
-		fmt.Fprintf(os.Stderr, "Usage:\n  telehand serve [pairing-code]\n  telehand connect [pairing-code]\n  telehand gen-config --network-name NAME --network-secret SECRET --peers PEERS\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n  telehand serve [pairing-code]\n  telehand connect [pairing-code]\n  telehand gen-config --network-name NAME --network-secret SECRET --peers PEERS\n  telehand remote sync [--addr HOST:PORT] [--pull] [--delete] [--exclude PATTERN]... <local> <remote>\n  telehand remote forward [--addr HOST:PORT] L|R:[bind:]port:host:port...\n  telehand relay [--listen URL]... [--public-host HOST] [--http ADDR] [--print-systemd]\n  telehand peers [show|refresh|sign]\n")
 		return ExitCodeParam
 	}
 }
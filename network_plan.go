@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"crypto/sha256"
 	"encoding/base32"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"os/exec"
@@ -38,6 +39,13 @@ func computeNetworkHash(networkName, networkSecret string) string {
 	return encoded[:10]
 }
 
+// sessionToken is a secret both ends derive from the pairing config; it gates
+// session-scoped services such as the SOCKS5 egress.
+func sessionToken(networkName, networkSecret string) string {
+	sum := sha256.Sum256([]byte("telehand-session\n" + strings.TrimSpace(networkName) + "\n" + strings.TrimSpace(networkSecret)))
+	return hex.EncodeToString(sum[:16])
+}
+
 func buildIPv4Candidates(networkHash, role string, count int) []IPv4Candidate {
 	if count <= 0 {
 		count = defaultSubnetCandidateCount
@@ -324,6 +332,36 @@ func addHostRouteForTarget(targetIP, tunDevice string) error {
 	if net.ParseIP(target) == nil {
 		return fmt.Errorf("invalid target ip: %q", targetIP)
 	}
+	return addRouteForPrefix(fmt.Sprintf("%s/32", target), tunDevice)
+}
+
+func removeHostRouteForTarget(targetIP, tunDevice string) error {
+	target := strings.TrimSpace(targetIP)
+	if net.ParseIP(target) == nil {
+		return fmt.Errorf("invalid target ip: %q", targetIP)
+	}
+	return removeRouteForPrefix(fmt.Sprintf("%s/32", target), tunDevice)
+}
+
+// addSubnetRouteForTarget routes a whole CIDR (a peer's exposed subnet)
+// through the TUN device.
+func addSubnetRouteForTarget(cidr, tunDevice string) error {
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil || ipNet.IP.To4() == nil {
+		return fmt.Errorf("invalid ipv4 cidr: %q", cidr)
+	}
+	return addRouteForPrefix(ipNet.String(), tunDevice)
+}
+
+func removeSubnetRouteForTarget(cidr, tunDevice string) error {
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil || ipNet.IP.To4() == nil {
+		return fmt.Errorf("invalid ipv4 cidr: %q", cidr)
+	}
+	return removeRouteForPrefix(ipNet.String(), tunDevice)
+}
+
+func addRouteForPrefix(prefix, tunDevice string) error {
 	iface := strings.TrimSpace(tunDevice)
 	if iface == "" {
 		return fmt.Errorf("empty tun device")
@@ -331,7 +369,7 @@ func addHostRouteForTarget(targetIP, tunDevice string) error {
 
 	switch runtime.GOOS {
 	case "darwin":
-		cmd := exec.Command("route", "-n", "add", "-host", target, "-interface", iface)
+		cmd := exec.Command("route", "-n", "add", darwinRouteKind(prefix), darwinRouteTarget(prefix), "-interface", iface)
 		out, err := cmd.CombinedOutput()
 		if err != nil {
 			// Route may already exist for retries; treat as success.
@@ -342,14 +380,14 @@ func addHostRouteForTarget(targetIP, tunDevice string) error {
 		}
 		return nil
 	case "linux":
-		cmd := exec.Command("ip", "route", "replace", fmt.Sprintf("%s/32", target), "dev", iface)
+		cmd := exec.Command("ip", "route", "replace", prefix, "dev", iface)
 		out, err := cmd.CombinedOutput()
 		if err != nil {
 			return fmt.Errorf("ip route replace failed: %v (%s)", err, strings.TrimSpace(string(out)))
 		}
 		return nil
 	case "windows":
-		script := fmt.Sprintf("if(-not (Get-NetRoute -DestinationPrefix '%s/32' -InterfaceAlias '%s' -ErrorAction SilentlyContinue)){New-NetRoute -DestinationPrefix '%s/32' -InterfaceAlias '%s' -NextHop '0.0.0.0' -PolicyStore ActiveStore | Out-Null}", target, escapePowerShellSingleQuoted(iface), target, escapePowerShellSingleQuoted(iface))
+		script := fmt.Sprintf("if(-not (Get-NetRoute -DestinationPrefix '%s' -InterfaceAlias '%s' -ErrorAction SilentlyContinue)){New-NetRoute -DestinationPrefix '%s' -InterfaceAlias '%s' -NextHop '0.0.0.0' -PolicyStore ActiveStore | Out-Null}", prefix, escapePowerShellSingleQuoted(iface), prefix, escapePowerShellSingleQuoted(iface))
 		cmd := exec.Command("powershell", "-NoProfile", "-Command", script)
 		out, err := cmd.CombinedOutput()
 		if err != nil {
@@ -357,15 +395,11 @@ func addHostRouteForTarget(targetIP, tunDevice string) error {
 		}
 		return nil
 	default:
-		return fmt.Errorf("host route add unsupported on %s", runtime.GOOS)
+		return fmt.Errorf("route add unsupported on %s", runtime.GOOS)
 	}
 }
 
-func removeHostRouteForTarget(targetIP, tunDevice string) error {
-	target := strings.TrimSpace(targetIP)
-	if net.ParseIP(target) == nil {
-		return fmt.Errorf("invalid target ip: %q", targetIP)
-	}
+func removeRouteForPrefix(prefix, tunDevice string) error {
 	iface := strings.TrimSpace(tunDevice)
 	if iface == "" {
 		return fmt.Errorf("empty tun device")
@@ -373,7 +407,7 @@ func removeHostRouteForTarget(targetIP, tunDevice string) error {
 
 	switch runtime.GOOS {
 	case "darwin":
-		cmd := exec.Command("route", "-n", "delete", "-host", target, "-interface", iface)
+		cmd := exec.Command("route", "-n", "delete", darwinRouteKind(prefix), darwinRouteTarget(prefix), "-interface", iface)
 		out, err := cmd.CombinedOutput()
 		if err != nil {
 			lower := strings.ToLower(string(out))
@@ -384,7 +418,7 @@ func removeHostRouteForTarget(targetIP, tunDevice string) error {
 		}
 		return nil
 	case "linux":
-		cmd := exec.Command("ip", "route", "del", fmt.Sprintf("%s/32", target), "dev", iface)
+		cmd := exec.Command("ip", "route", "del", prefix, "dev", iface)
 		out, err := cmd.CombinedOutput()
 		if err != nil {
 			lower := strings.ToLower(string(out))
@@ -395,7 +429,7 @@ func removeHostRouteForTarget(targetIP, tunDevice string) error {
 		}
 		return nil
 	case "windows":
-		script := fmt.Sprintf("Get-NetRoute -DestinationPrefix '%s/32' -InterfaceAlias '%s' -ErrorAction SilentlyContinue | Remove-NetRoute -Confirm:$false -ErrorAction SilentlyContinue", target, escapePowerShellSingleQuoted(iface))
+		script := fmt.Sprintf("Get-NetRoute -DestinationPrefix '%s' -InterfaceAlias '%s' -ErrorAction SilentlyContinue | Remove-NetRoute -Confirm:$false -ErrorAction SilentlyContinue", prefix, escapePowerShellSingleQuoted(iface))
 		cmd := exec.Command("powershell", "-NoProfile", "-Command", script)
 		out, err := cmd.CombinedOutput()
 		if err != nil {
@@ -403,8 +437,21 @@ func removeHostRouteForTarget(targetIP, tunDevice string) error {
 		}
 		return nil
 	default:
-		return fmt.Errorf("host route delete unsupported on %s", runtime.GOOS)
+		return fmt.Errorf("route delete unsupported on %s", runtime.GOOS)
+	}
+}
+
+// darwinRouteKind and darwinRouteTarget keep host routes in the
+// `-host a.b.c.d` form the BSD route tool expects for /32 prefixes.
+func darwinRouteKind(prefix string) string {
+	if strings.HasSuffix(prefix, "/32") {
+		return "-host"
 	}
+	return "-net"
+}
+
+func darwinRouteTarget(prefix string) string {
+	return strings.TrimSuffix(prefix, "/32")
 }
 
 func escapePowerShellSingleQuoted(v string) string {
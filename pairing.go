@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Permission scopes a pairing code can ask the receiver to serve.
+const (
+	PermissionRead    = "read"
+	PermissionWrite   = "write"
+	PermissionExec    = "exec"
+	PermissionForward = "forward"
+)
+
+var knownPermissions = []string{PermissionRead, PermissionWrite, PermissionExec, PermissionForward}
+
+// pairingOptions are the envelope fields an initiator adds on top of the
+// network settings when it mints a pairing code.
+type pairingOptions struct {
+	TTL         time.Duration
+	Permissions []string
+	APIToken    string
+	// SigningKey, when set, signs the code so the receiver can detect
+	// tampering and show whose code it is.
+	SigningKey ed25519.PrivateKey
+	// Short mints a "TH-" short code instead; it derives the secret and
+	// token from a seed and cannot be signed.
+	Short bool
+	// Once makes the code single-use (see pairing_once.go).
+	Once bool
+}
+
+// parsePermissions reads a comma-separated scope list. "all" or an empty
+// value grants everything and yields nil.
+func parsePermissions(raw string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		p := strings.ToLower(strings.TrimSpace(part))
+		if p == "" || seen[p] {
+			continue
+		}
+		if p == "all" {
+			return nil, nil
+		}
+		if !containsString(knownPermissions, p) {
+			return nil, fmt.Errorf("unknown permission %q (want %s or all)", p, strings.Join(knownPermissions, ", "))
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func randomToken() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPairingOptions stamps the envelope fields onto cfg. Restrictions are
+// only honoured by receivers that know about them, so a code carrying any
+// also asks for at least this version.
+func applyPairingOptions(cfg *Config, opts pairingOptions, now time.Time) {
+	cfg.Version = pairingFormatVersion
+	cfg.CreatedBy = fmt.Sprintf("%s (telehand %s)", detectHostIdentity(), telehandVersion)
+	if opts.TTL > 0 {
+		cfg.ExpiresAt = now.Add(opts.TTL).Unix()
+	}
+	cfg.Permissions = opts.Permissions
+	cfg.APIToken = strings.TrimSpace(opts.APIToken)
+	if opts.Once {
+		cfg.Nonce = randomToken()
+	}
+	if len(cfg.Permissions) > 0 || cfg.APIToken != "" || cfg.Nonce != "" {
+		cfg.MinClientVersion = telehandVersion
+	}
+}
+
+// checkMinClientVersion refuses codes minted for a newer telehand.
+func checkMinClientVersion(cfg *Config) error {
+	want := strings.TrimSpace(cfg.MinClientVersion)
+	if want == "" {
+		return nil
+	}
+	cmp, ok := compareVersions(telehandVersion, want)
+	if !ok {
+		return fmt.Errorf("invalid min_client_version %q in config", want)
+	}
+	if cmp < 0 {
+		return newCodedError(ErrorCodeConfigVersionUnsupported,
+			fmt.Sprintf("pairing code requires telehand %s or newer (this is %s); please upgrade telehand", want, telehandVersion))
+	}
+	return nil
+}
+
+// compareVersions compares dotted numeric versions such as "0.4.0" or
+// "v1.2"; missing parts count as zero.
+func compareVersions(a, b string) (int, bool) {
+	pa, okA := parseVersionParts(a)
+	pb, okB := parseVersionParts(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for len(pa) < len(pb) {
+		pa = append(pa, 0)
+	}
+	for len(pb) < len(pa) {
+		pb = append(pb, 0)
+	}
+	for i := range pa {
+		switch {
+		case pa[i] < pb[i]:
+			return -1, true
+		case pa[i] > pb[i]:
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+func parseVersionParts(v string) ([]int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if v == "" {
+		return nil, false
+	}
+	var parts []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
+
+// describePairing is the one-line summary printed when a code is accepted.
+func describePairing(cfg *Config) string {
+	var parts []string
+	if cfg.CreatedBy != "" {
+		parts = append(parts, "created_by="+cfg.CreatedBy)
+	}
+	if cfg.ExpiresAt > 0 {
+		parts = append(parts, "expires_at="+time.Unix(cfg.ExpiresAt, 0).Format(time.RFC3339))
+	}
+	perms := "all"
+	if len(cfg.Permissions) > 0 {
+		perms = strings.Join(cfg.Permissions, ",")
+	}
+	parts = append(parts, "permissions="+perms)
+	if cfg.APIToken != "" {
+		parts = append(parts, "api_token=required")
+	}
+	if cfg.Nonce != "" {
+		parts = append(parts, "one_time=true")
+	}
+	parts = append(parts, "signer="+signerFingerprint(cfg))
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// One-time pairing codes carry a nonce. The receiver remembers nonces it
+// reached running with and refuses them afterwards; the initiator binds
+// the nonce to the first receiver and flags any other receiver that joins
+// with the same code.
+const pairingStateFile = "pairing_state.json"
+
+type pairingUse struct {
+	Role     string `json:"role"`
+	UsedAt   int64  `json:"used_at"`
+	Receiver string `json:"receiver,omitempty"`
+}
+
+var pairingStateMu sync.Mutex
+
+func pairingStatePath() (string, error) {
+	dir, err := telehandConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, pairingStateFile), nil
+}
+
+func loadPairingState() (map[string]pairingUse, error) {
+	path, err := pairingStatePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]pairingUse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]pairingUse{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return state, nil
+}
+
+func savePairingState(state map[string]pairingUse) error {
+	path, err := pairingStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// checkPairingNonceUnused is the receiver's submit-time check.
+func checkPairingNonceUnused(cfg *Config) error {
+	if cfg == nil || cfg.Nonce == "" {
+		return nil
+	}
+	pairingStateMu.Lock()
+	defer pairingStateMu.Unlock()
+	state, err := loadPairingState()
+	if err != nil {
+		return err
+	}
+	if use, ok := state[cfg.Nonce]; ok && use.Role == "server" {
+		return newCodedError(ErrorCodeConfigAlreadyUsed,
+			fmt.Sprintf("one-time pairing code was already used on %s; ask for a new code", time.Unix(use.UsedAt, 0).Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// recordPairingUse marks nonce as used by this machine. For the initiator
+// it also pins receiver; an existing pin is returned unchanged.
+func recordPairingUse(nonce, role, receiver string) (pairingUse, error) {
+	pairingStateMu.Lock()
+	defer pairingStateMu.Unlock()
+	state, err := loadPairingState()
+	if err != nil {
+		return pairingUse{}, err
+	}
+	if use, ok := state[nonce]; ok && use.Role == role && (role == "server" || use.Receiver != "") {
+		return use, nil
+	}
+	use := pairingUse{Role: role, UsedAt: time.Now().Unix(), Receiver: receiver}
+	state[nonce] = use
+	return use, savePairingState(state)
+}
+
+// onceReceiverGuard is the initiator's side: once bound, receivers other
+// than the pinned one are marked rejected in peer snapshots.
+type onceReceiverGuard struct {
+	mu       sync.Mutex
+	nonce    string
+	receiver string
+}
+
+func newOnceReceiverGuard(nonce string) *onceReceiverGuard {
+	g := &onceReceiverGuard{nonce: nonce}
+	pairingStateMu.Lock()
+	defer pairingStateMu.Unlock()
+	if state, err := loadPairingState(); err == nil {
+		if use, ok := state[nonce]; ok && use.Role == "client" {
+			g.receiver = use.Receiver
+		}
+	}
+	return g
+}
+
+// bind pins the receiver the session reached. It reports an error when a
+// different receiver already holds the code.
+func (g *onceReceiverGuard) bind(receiver string) error {
+	receiver = strings.TrimSpace(receiver)
+	if receiver == "" {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.receiver != "" {
+		if g.receiver != receiver {
+			return newCodedError(ErrorCodeConfigAlreadyUsed,
+				fmt.Sprintf("one-time pairing code is bound to receiver %s; rejected %s", g.receiver, receiver))
+		}
+		return nil
+	}
+	use, err := recordPairingUse(g.nonce, "client", receiver)
+	if err != nil {
+		return err
+	}
+	g.receiver = use.Receiver
+	if g.receiver != receiver {
+		return newCodedError(ErrorCodeConfigAlreadyUsed,
+			fmt.Sprintf("one-time pairing code is bound to receiver %s; rejected %s", g.receiver, receiver))
+	}
+	return nil
+}
+
+// mark flags every receiver in snapshot other than the pinned one.
+func (g *onceReceiverGuard) mark(snapshot *PeerInfoSnapshot) {
+	g.mu.Lock()
+	bound := g.receiver
+	g.mu.Unlock()
+	if bound == "" {
+		return
+	}
+	for i := range snapshot.Peers {
+		p := &snapshot.Peers[i]
+		// Relays have no virtual IP; only members of the network count.
+		if p.IsSelf || p.Hostname == bound || p.VirtualIPv4 == "" || p.VirtualIPv4 == "-" {
+			continue
+		}
+		p.Rejected = "one-time pairing code already used by " + bound
+	}
+}
+
+// receiverHostname finds the hostname behind a virtual IP in snapshot.
+func receiverHostname(snapshot PeerInfoSnapshot, virtIP string) string {
+	for _, p := range snapshot.Peers {
+		ip, _, _ := strings.Cut(p.VirtualIPv4, "/")
+		if !p.IsSelf && ip == virtIP {
+			return p.Hostname
+		}
+	}
+	return ""
+}
+
+// claimOncePairing runs when a one-time session reaches running: the
+// receiver burns the nonce and the initiator pins the receiver it reached.
+func claimOncePairing(role string, cfg *Config, guard *onceReceiverGuard, query func() (PeerInfoSnapshot, error), targetIP string) error {
+	if cfg == nil || cfg.Nonce == "" {
+		return nil
+	}
+	if role == "server" {
+		_, err := recordPairingUse(cfg.Nonce, "server", "")
+		return err
+	}
+	if guard == nil {
+		return nil
+	}
+	snapshot, err := query()
+	if err != nil {
+		return err
+	}
+	return guard.bind(receiverHostname(snapshot, targetIP))
+}
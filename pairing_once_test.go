@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReceiverRefusesUsedOneTimeCode(t *testing.T) {
+	withTempConfigDir(t)
+	cfg := &Config{NetworkName: "n", NetworkSecret: "s", Peers: []string{"tcp://1.1.1.1:11010"}, Nonce: "abc"}
+
+	g := NewGUIServer(18080)
+	g.SetConfigCheck(checkPairingNonceUnused)
+	if err := checkPairingNonceUnused(cfg); err != nil {
+		t.Fatalf("fresh nonce rejected: %v", err)
+	}
+	if err := claimOncePairing("server", cfg, nil, nil, ""); err != nil {
+		t.Fatalf("record use: %v", err)
+	}
+	if err := g.SubmitConfig(cfg); errorCodeOf(err) != ErrorCodeConfigAlreadyUsed {
+		t.Fatalf("expected %q on reuse, got %v", ErrorCodeConfigAlreadyUsed, err)
+	}
+	if g.GetState().Phase != "config" {
+		t.Fatalf("refused code must not start connecting, phase=%s", g.GetState().Phase)
+	}
+
+	other := *cfg
+	other.Nonce = "def"
+	if err := checkPairingNonceUnused(&other); err != nil {
+		t.Fatalf("other nonce rejected: %v", err)
+	}
+	other.Nonce = ""
+	if err := checkPairingNonceUnused(&other); err != nil {
+		t.Fatalf("reusable code rejected: %v", err)
+	}
+}
+
+func TestInitiatorBindsFirstReceiver(t *testing.T) {
+	withTempConfigDir(t)
+	cfg := &Config{Nonce: "abc"}
+	snapshot := PeerInfoSnapshot{Peers: []PeerInfo{
+		{VirtualIPv4: "10.126.126.1/24", Hostname: "me", IsSelf: true},
+		{VirtualIPv4: "10.126.126.2/24", Hostname: "alice"},
+		{VirtualIPv4: "10.126.126.3/24", Hostname: "mallory"},
+		{VirtualIPv4: "-", Hostname: "relay"},
+	}}
+	query := func() (PeerInfoSnapshot, error) { return snapshot, nil }
+
+	guard := newOnceReceiverGuard(cfg.Nonce)
+	if err := claimOncePairing("client", cfg, guard, query, "10.126.126.2"); err != nil {
+		t.Fatalf("bind first receiver: %v", err)
+	}
+	marked := snapshot
+	marked.Peers = append([]PeerInfo(nil), snapshot.Peers...)
+	guard.mark(&marked)
+	for _, p := range marked.Peers {
+		if (p.Rejected != "") != (p.Hostname == "mallory") {
+			t.Fatalf("unexpected rejection state for %s: %q", p.Hostname, p.Rejected)
+		}
+	}
+
+	// A later connect with the same code remembers the pinned receiver.
+	again := newOnceReceiverGuard(cfg.Nonce)
+	if err := claimOncePairing("client", cfg, again, query, "10.126.126.3"); errorCodeOf(err) != ErrorCodeConfigAlreadyUsed {
+		t.Fatalf("expected %q for a second receiver, got %v", ErrorCodeConfigAlreadyUsed, err)
+	}
+	if err := again.bind("alice"); err != nil {
+		t.Fatalf("pinned receiver rejected: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const pairingKeyFile = "pairing_ed25519"
+
+// telehandConfigDir is where per-user telehand state lives
+// (~/.config/telehand on Linux); a var so tests can redirect it.
+var telehandConfigDir = func() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "telehand"), nil
+}
+
+// loadOrCreatePairingKey returns the initiator's signing key, generating
+// and storing it on first use.
+func loadOrCreatePairingKey() (ed25519.PrivateKey, error) {
+	dir, err := telehandConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, pairingKeyFile)
+	if data, err := os.ReadFile(path); err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid pairing key in %s", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	seed := base64.StdEncoding.EncodeToString(key.Seed()) + "\n"
+	if err := os.WriteFile(path, []byte(seed), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// keyFingerprint is short enough to read out over the phone.
+func keyFingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	h := hex.EncodeToString(sum[:8])
+	return h[0:4] + "-" + h[4:8] + "-" + h[8:12] + "-" + h[12:16]
+}
+
+// signerFingerprint describes who signed cfg, for display next to the
+// pairing details. It does not verify; decodeConfigWithValidation does.
+func signerFingerprint(cfg *Config) string {
+	if cfg == nil || cfg.Signer == "" {
+		return "unsigned"
+	}
+	pub, err := base64.StdEncoding.DecodeString(cfg.Signer)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return "invalid"
+	}
+	return keyFingerprint(pub)
+}
+
+// signConfig sets Signer and Signature on cfg. The signature covers every
+// other envelope field, so swapping peers or stretching expires_at breaks it.
+func signConfig(cfg *Config, key ed25519.PrivateKey) error {
+	cfg.Signer = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	cfg.Signature = ""
+	out := *cfg
+	if out.Version == 0 {
+		out.Version = pairingFormatVersion
+	}
+	raw, err := json.Marshal(&out)
+	if err != nil {
+		return err
+	}
+	msg, _, err := pairingSignedBytes(raw)
+	if err != nil {
+		return err
+	}
+	cfg.Version = out.Version
+	cfg.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg))
+	return nil
+}
+
+// verifyPairingSignature checks the signature of a decoded code. Only
+// legacy codes without a "v" field may be unsigned: every versioned code
+// telehand mints is signed, so one without a signature had it stripped.
+// (Short codes never get here.)
+func verifyPairingSignature(raw []byte) error {
+	msg, envelope, err := pairingSignedBytes(raw)
+	if err != nil {
+		return fmt.Errorf("invalid config format: %w", err)
+	}
+	signer, _ := envelope["signer"].(string)
+	sig, _ := envelope["sig"].(string)
+	if signer == "" && sig == "" {
+		if v, ok := envelope["v"].(json.Number); ok {
+			if n, err := v.Int64(); err != nil || n >= pairingFormatVersion {
+				return newCodedError(ErrorCodeConfigSignatureInvalid, "pairing code is unsigned; it may have been altered")
+			}
+		}
+		return nil
+	}
+	pub, err := base64.StdEncoding.DecodeString(signer)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return newCodedError(ErrorCodeConfigSignatureInvalid, "pairing code has an invalid signer key")
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || !ed25519.Verify(pub, msg, sigBytes) {
+		return newCodedError(ErrorCodeConfigSignatureInvalid, "pairing code signature does not match; it may have been altered")
+	}
+	return nil
+}
+
+// pairingSignedBytes is the canonical form that gets signed: the envelope
+// without "sig", re-encoded with sorted keys and numbers kept verbatim.
+// Working on the generic map keeps fields this version does not know
+// about covered by the signature.
+func pairingSignedBytes(raw []byte) ([]byte, map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var envelope map[string]any
+	if err := dec.Decode(&envelope); err != nil {
+		return nil, nil, err
+	}
+	sig := envelope["sig"]
+	delete(envelope, "sig")
+	msg, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sig != nil {
+		envelope["sig"] = sig
+	}
+	return msg, envelope, nil
+}
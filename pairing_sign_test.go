@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func withTempConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	orig := telehandConfigDir
+	telehandConfigDir = func() (string, error) { return dir, nil }
+	resetCachedDefaultPeers()
+	t.Cleanup(func() {
+		telehandConfigDir = orig
+		resetCachedDefaultPeers()
+	})
+	return dir
+}
+
+func rewriteEnvelope(t *testing.T, code string, edit func(map[string]any)) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(code)
+	if err != nil {
+		t.Fatalf("decode code: %v", err)
+	}
+	var envelope map[string]any
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		t.Fatalf("unmarshal envelope: %v", err)
+	}
+	edit(envelope)
+	out, _ := json.Marshal(envelope)
+	return base64.StdEncoding.EncodeToString(out)
+}
+
+func TestLoadOrCreatePairingKeyPersists(t *testing.T) {
+	dir := withTempConfigDir(t)
+	first, err := loadOrCreatePairingKey()
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	second, err := loadOrCreatePairingKey()
+	if err != nil {
+		t.Fatalf("load key: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("key changed between runs")
+	}
+	info, err := os.Stat(filepath.Join(dir, pairingKeyFile))
+	if err != nil {
+		t.Fatalf("stat key: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file mode %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestSignedPairingCodeRoundTrip(t *testing.T) {
+	withTempConfigDir(t)
+	key, err := loadOrCreatePairingKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	code, cfg, err := buildEncodedConfigWithDefaults("net", "secret", "tcp://1.1.1.1:11010", nil, pairingOptions{SigningKey: key})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	decoded, err := decodeConfigWithValidation(code)
+	if err != nil {
+		t.Fatalf("signed code rejected: %v", err)
+	}
+	if fp := signerFingerprint(decoded); fp != signerFingerprint(cfg) || len(fp) != len("0000-0000-0000-0000") {
+		t.Fatalf("unexpected fingerprint %q vs %q", fp, signerFingerprint(cfg))
+	}
+	if signerFingerprint(&Config{}) != "unsigned" {
+		t.Fatal("unsigned config should say so")
+	}
+}
+
+func TestTamperedPairingCodeRejected(t *testing.T) {
+	withTempConfigDir(t)
+	key, err := loadOrCreatePairingKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	code, _, err := buildEncodedConfigWithDefaults("net", "secret", "tcp://1.1.1.1:11010", nil, pairingOptions{SigningKey: key})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	edits := map[string]func(map[string]any){
+		"swapped peers": func(e map[string]any) { e["peers"] = []string{"tcp://6.6.6.6:11010"} },
+		"added field":   func(e map[string]any) { e["permissions"] = []string{"read"} },
+		"dropped sig":   func(e map[string]any) { delete(e, "sig") },
+		"other signer": func(e map[string]any) {
+			e["signer"] = base64.StdEncoding.EncodeToString(make([]byte, 32))
+		},
+	}
+	for name, edit := range edits {
+		_, err := decodeConfigWithValidation(rewriteEnvelope(t, code, edit))
+		if errorCodeOf(err) != ErrorCodeConfigSignatureInvalid {
+			t.Fatalf("%s: expected %q, got %v", name, ErrorCodeConfigSignatureInvalid, err)
+		}
+	}
+
+	// Stripping both fields (and swapping peers) is refused too: versioned
+	// codes are always signed.
+	stripped := rewriteEnvelope(t, code, func(e map[string]any) {
+		delete(e, "sig")
+		delete(e, "signer")
+		e["peers"] = []string{"tcp://6.6.6.6:11010"}
+	})
+	if _, err := decodeConfigWithValidation(stripped); errorCodeOf(err) != ErrorCodeConfigSignatureInvalid {
+		t.Fatalf("stripped signature: expected %q, got %v", ErrorCodeConfigSignatureInvalid, err)
+	}
+
+	// Legacy codes predate both the version field and signing.
+	legacy := rewriteEnvelope(t, code, func(e map[string]any) {
+		delete(e, "sig")
+		delete(e, "signer")
+		delete(e, "v")
+	})
+	cfg, err := decodeConfigWithValidation(legacy)
+	if err != nil || signerFingerprint(cfg) != "unsigned" {
+		t.Fatalf("legacy unsigned code: %v %+v", err, cfg)
+	}
+}
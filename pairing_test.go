@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodeRawConfig(t *testing.T, payload map[string]any) string {
+	t.Helper()
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// encodeSignedConfig signs payload the way a current telehand would, since
+// receivers refuse unsigned versioned codes.
+func encodeSignedConfig(t *testing.T, payload map[string]any) string {
+	t.Helper()
+	raw, _ := json.Marshal(payload)
+	var cfg Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	_, key, _ := ed25519.GenerateKey(nil)
+	if err := signConfig(&cfg, key); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	code, err := EncodeConfig(&cfg)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return code
+}
+
+func TestParsePermissions(t *testing.T) {
+	got, err := parsePermissions(" Read, exec ,read")
+	if err != nil || !reflect.DeepEqual(got, []string{"read", "exec"}) {
+		t.Fatalf("got %v (%v)", got, err)
+	}
+	for _, all := range []string{"", "all", "read,all"} {
+		if got, err := parsePermissions(all); err != nil || got != nil {
+			t.Fatalf("%q should grant everything, got %v (%v)", all, got, err)
+		}
+	}
+	if _, err := parsePermissions("read,root"); err == nil {
+		t.Fatal("expected unknown permission to be rejected")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+		ok   bool
+	}{
+		{"0.4.0", "0.4.0", 0, true},
+		{"0.4", "0.4.0", 0, true},
+		{"v0.10.0", "0.9.9", 1, true},
+		{"0.4.0", "1.0", -1, true},
+		{"dev", "0.4.0", 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := compareVersions(tc.a, tc.b)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("compareVersions(%q,%q)=%d,%v want %d,%v", tc.a, tc.b, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestBuildEncodedConfigWithDefaultsEnvelope(t *testing.T) {
+	orig := hostnameReader
+	hostnameReader = func() (string, error) { return "my-host", nil }
+	t.Cleanup(func() { hostnameReader = orig })
+
+	before := time.Now()
+	_, key, _ := ed25519.GenerateKey(nil)
+	code, cfg, err := buildEncodedConfigWithDefaults("", "", "", nil, pairingOptions{
+		SigningKey:  key,
+		TTL:         time.Hour,
+		Permissions: []string{PermissionRead},
+		APIToken:    "tok",
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	var envelope map[string]any
+	raw, _ := base64.StdEncoding.DecodeString(code)
+	json.Unmarshal(raw, &envelope)
+	if envelope["v"] != float64(pairingFormatVersion) || envelope["api_token"] != "tok" || envelope["min_client_version"] != telehandVersion {
+		t.Fatalf("unexpected envelope: %v", envelope)
+	}
+	if !strings.HasPrefix(cfg.CreatedBy, "my-host ") {
+		t.Fatalf("unexpected created_by: %q", cfg.CreatedBy)
+	}
+	if exp := time.Unix(cfg.ExpiresAt, 0); exp.Before(before.Add(59*time.Minute)) || exp.After(before.Add(61*time.Minute)) {
+		t.Fatalf("unexpected expires_at: %v", exp)
+	}
+
+	decoded, err := decodeConfigWithValidation(code)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Permissions, []string{PermissionRead}) || decoded.APIToken != "tok" {
+		t.Fatalf("envelope lost on decode: %+v", decoded)
+	}
+
+	// Without options nothing restrictive is emitted and no version floor set.
+	_, plain, err := buildEncodedConfigWithDefaults("", "", "", nil, pairingOptions{})
+	if err != nil {
+		t.Fatalf("build plain: %v", err)
+	}
+	if plain.ExpiresAt != 0 || plain.MinClientVersion != "" || plain.Permissions != nil || plain.Version != pairingFormatVersion {
+		t.Fatalf("unexpected plain envelope: %+v", plain)
+	}
+}
+
+func TestDecodeConfigWithValidationRejectsUnknownMajorVersion(t *testing.T) {
+	code := encodeRawConfig(t, map[string]any{
+		"v":              pairingFormatVersion + 1,
+		"network_name":   "n",
+		"network_secret": "s",
+		"peers":          []string{"tcp://1.1.1.1:11010"},
+		// An expiry in the past must not mask the version error.
+		"expires_at": time.Now().Add(-time.Minute).Unix(),
+	})
+	_, err := decodeConfigWithValidation(code)
+	if errorCodeOf(err) != ErrorCodeConfigVersionUnsupported {
+		t.Fatalf("expected %q, got %v", ErrorCodeConfigVersionUnsupported, err)
+	}
+}
+
+func TestDecodeConfigWithValidationMinClientVersion(t *testing.T) {
+	payload := map[string]any{
+		"v":                  pairingFormatVersion,
+		"network_name":       "n",
+		"network_secret":     "s",
+		"peers":              []string{"tcp://1.1.1.1:11010"},
+		"min_client_version": "999.0.0",
+	}
+	if _, err := decodeConfigWithValidation(encodeSignedConfig(t, payload)); errorCodeOf(err) != ErrorCodeConfigVersionUnsupported {
+		t.Fatalf("expected %q, got %v", ErrorCodeConfigVersionUnsupported, err)
+	}
+	payload["min_client_version"] = telehandVersion
+	if _, err := decodeConfigWithValidation(encodeSignedConfig(t, payload)); err != nil {
+		t.Fatalf("current version should be accepted: %v", err)
+	}
+	payload["min_client_version"] = "soon"
+	if _, err := decodeConfigWithValidation(encodeSignedConfig(t, payload)); err == nil {
+		t.Fatal("expected malformed min_client_version to be rejected")
+	}
+}
+
+func TestDecodeConfigWithValidationAcceptsUnversionedCode(t *testing.T) {
+	cfg, err := decodeConfigWithValidation(encodeRawConfig(t, map[string]any{
+		"network_name":   "n",
+		"network_secret": "s",
+		"peers":          []string{"tcp://1.1.1.1:11010"},
+	}))
+	if err != nil {
+		t.Fatalf("legacy code rejected: %v", err)
+	}
+	if cfg.Version != 0 || cfg.Permissions != nil || cfg.APIToken != "" {
+		t.Fatalf("unexpected legacy decode: %+v", cfg)
+	}
+}
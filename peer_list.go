@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default peer pool comes from peers.json in the config dir: a signed
+// list fetched from peer_list_url, so dead public relays can be replaced
+// without a release. DefaultPeers always follows it as the last resort.
+//
+//	{"peers":["tcp://1.2.3.4:11010"],"updated_at":1760000000,"signer":"<base64 key>","sig":"<base64>"}
+//
+// The signature covers every field but "sig", canonicalized the same way as
+// pairing codes, and the signer must be one of the trusted keys.
+const peerListFile = "peers.json"
+
+const (
+	peerListRefreshInterval = 24 * time.Hour
+	peerListFetchTimeout    = 10 * time.Second
+	peerListMaxBytes        = 64 << 10
+	envPeerListURL          = "TELEHAND_PEER_LIST_URL"
+)
+
+// Release builds can set these with
+// -ldflags "-X main.defaultPeerListURL=... -X main.defaultPeerListKeys=KEY1,KEY2";
+// config.toml adds peer_list_url and peer_list_keys on top.
+var (
+	defaultPeerListURL  = ""
+	defaultPeerListKeys = ""
+)
+
+type peerList struct {
+	Peers     []string `json:"peers"`
+	UpdatedAt int64    `json:"updated_at"`
+	Signer    string   `json:"signer"`
+	Signature string   `json:"sig"`
+}
+
+// peerListSource says where peers come from and whom to trust.
+type peerListSource struct {
+	URL  string
+	Keys []ed25519.PublicKey
+}
+
+func loadPeerListSource() (peerListSource, error) {
+	var src peerListSource
+	cfg, err := loadTelehandConfig()
+	if err != nil {
+		return src, err
+	}
+	src.URL = strings.TrimSpace(firstNonEmpty(os.Getenv(envPeerListURL), cfg.PeerListURL, defaultPeerListURL))
+	keys := append(strings.Split(defaultPeerListKeys, ","), cfg.PeerListKeys...)
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+		pub, err := parsePeerListKey(k)
+		if err != nil {
+			return src, err
+		}
+		src.Keys = append(src.Keys, pub)
+	}
+	return src, nil
+}
+
+func parsePeerListKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid peer list key %q (want a base64 ed25519 public key)", s)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+func peerListPath() (string, error) {
+	dir, err := telehandConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, peerListFile), nil
+}
+
+// parsePeerList verifies a signed list against keys and normalizes its
+// peers. A list without any usable peer is rejected.
+func parsePeerList(raw []byte, keys []ed25519.PublicKey) (*peerList, error) {
+	msg, _, err := pairingSignedBytes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer list: %w", err)
+	}
+	var list peerList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("invalid peer list: %w", err)
+	}
+	pub, err := base64.StdEncoding.DecodeString(list.Signer)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, errors.New("peer list has an invalid signer key")
+	}
+	trusted := false
+	for _, k := range keys {
+		if k.Equal(ed25519.PublicKey(pub)) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return nil, fmt.Errorf("peer list signer %s is not trusted", keyFingerprint(pub))
+	}
+	sig, err := base64.StdEncoding.DecodeString(list.Signature)
+	if err != nil || !ed25519.Verify(pub, msg, sig) {
+		return nil, errors.New("peer list signature does not match")
+	}
+	list.Peers = normalizePeerPool(list.Peers, MaxPeerCount, InvalidPeerDrop)
+	if len(list.Peers) == 0 {
+		return nil, errors.New("peer list has no valid peers")
+	}
+	return &list, nil
+}
+
+// signPeerList produces a list document for peer_list_url.
+func signPeerList(peers []string, updatedAt time.Time, key ed25519.PrivateKey) ([]byte, error) {
+	list := peerList{
+		Peers:     normalizePeerPool(peers, MaxPeerCount, InvalidPeerDrop),
+		UpdatedAt: updatedAt.Unix(),
+		Signer:    base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+	}
+	if len(list.Peers) == 0 {
+		return nil, errors.New("no valid peers")
+	}
+	raw, err := json.Marshal(&list)
+	if err != nil {
+		return nil, err
+	}
+	msg, _, err := pairingSignedBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+	list.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg))
+	return json.MarshalIndent(&list, "", "  ")
+}
+
+// loadCachedPeerList returns the verified cached list, or nil when there is
+// none or it no longer verifies (e.g. its key was removed).
+func loadCachedPeerList(keys []ed25519.PublicKey) (*peerList, error) {
+	path, err := peerListPath()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parsePeerList(raw, keys)
+}
+
+// The verified cached list is loaded once per process: defaultPeerPool sits
+// on hot paths (runtimePeerPool, short codes) and must not re-read
+// config.toml and peers.json and re-check the signature on every call.
+var (
+	cachedPeersMu     sync.Mutex
+	cachedPeersLoaded bool
+	cachedPeers       []string
+)
+
+// cachedDefaultPeers returns the peers of the verified cached list, or nil.
+// Why a list is ignored (a config.toml that does not parse, a signer that
+// is no longer trusted) is reported on stderr the first time.
+func cachedDefaultPeers() []string {
+	cachedPeersMu.Lock()
+	defer cachedPeersMu.Unlock()
+	if !cachedPeersLoaded {
+		peers, err := loadCachedDefaultPeers()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[telehand] cached peer list ignored: %v\n", err)
+		}
+		cachedPeers, cachedPeersLoaded = peers, true
+	}
+	return cachedPeers
+}
+
+// resetCachedDefaultPeers makes the next cachedDefaultPeers load again.
+func resetCachedDefaultPeers() {
+	cachedPeersMu.Lock()
+	cachedPeersLoaded, cachedPeers = false, nil
+	cachedPeersMu.Unlock()
+}
+
+func loadCachedDefaultPeers() ([]string, error) {
+	src, err := loadPeerListSource()
+	if err != nil {
+		return nil, fmt.Errorf("config.toml: %w", err)
+	}
+	if len(src.Keys) == 0 {
+		return nil, nil
+	}
+	list, err := loadCachedPeerList(src.Keys)
+	if err != nil || list == nil {
+		return nil, err
+	}
+	return list.Peers, nil
+}
+
+// refreshPeerList downloads, verifies and caches the list from src.URL.
+// A list older than the cached one is refused, so a replayed old list
+// cannot bring back retired relays.
+func refreshPeerList(ctx context.Context, src peerListSource) (*peerList, error) {
+	if src.URL == "" {
+		return nil, errors.New("no peer list URL configured (set peer_list_url in config.toml)")
+	}
+	if len(src.Keys) == 0 {
+		return nil, errors.New("no trusted peer list keys configured (set peer_list_keys in config.toml)")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", src.URL, resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, peerListMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > peerListMaxBytes {
+		return nil, fmt.Errorf("peer list larger than %d bytes", peerListMaxBytes)
+	}
+	list, err := parsePeerList(raw, src.Keys)
+	if err != nil {
+		return nil, err
+	}
+	if cached, _ := loadCachedPeerList(src.Keys); cached != nil && list.UpdatedAt < cached.UpdatedAt {
+		return nil, fmt.Errorf("fetched peer list (updated_at %d) is older than the cached one (%d)", list.UpdatedAt, cached.UpdatedAt)
+	}
+
+	path, err := peerListPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return list, nil
+}
+
+// refreshPeerListIfStale refreshes in the background when the cache was
+// last written more than peerListRefreshInterval ago. The current run
+// keeps the pool it already has; later runs pick up the new list.
+func refreshPeerListIfStale(onLog func(string)) {
+	src, err := loadPeerListSource()
+	if err != nil || src.URL == "" || len(src.Keys) == 0 {
+		return
+	}
+	if path, err := peerListPath(); err == nil {
+		if st, err := os.Stat(path); err == nil && time.Since(st.ModTime()) < peerListRefreshInterval {
+			return
+		}
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), peerListFetchTimeout)
+		defer cancel()
+		if _, err := refreshPeerList(ctx, src); err != nil && onLog != nil {
+			onLog(fmt.Sprintf("[telehand] peer list refresh failed: %v", err))
+		}
+	}()
+}
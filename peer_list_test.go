@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPeerListKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+}
+
+func mustSignPeerList(t *testing.T, key ed25519.PrivateKey, at time.Time, peers ...string) []byte {
+	t.Helper()
+	doc, err := signPeerList(peers, at, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return doc
+}
+
+// withPeerListKeys points config.toml at the public keys of keys.
+func withPeerListKeys(t *testing.T, dir string, keys ...ed25519.PrivateKey) {
+	t.Helper()
+	t.Setenv(envPeerListURL, "")
+	var quoted []string
+	for _, k := range keys {
+		quoted = append(quoted, `"`+base64.StdEncoding.EncodeToString(k.Public().(ed25519.PublicKey))+`"`)
+	}
+	mustWriteFile(t, filepath.Join(dir, telehandConfigFile), "peer_list_keys = ["+strings.Join(quoted, ", ")+"]\n")
+	resetCachedDefaultPeers()
+}
+
+func TestPeerListSignAndVerify(t *testing.T) {
+	key := testPeerListKey(1)
+	trusted := []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}
+	doc := mustSignPeerList(t, key, time.Unix(1760000000, 0), "tcp://1.2.3.4:11010", "bogus", "TCP://5.6.7.8:11010")
+
+	list, err := parsePeerList(doc, trusted)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if want := []string{"tcp://1.2.3.4:11010", "tcp://5.6.7.8:11010"}; !reflect.DeepEqual(list.Peers, want) || list.UpdatedAt != 1760000000 {
+		t.Fatalf("got %+v", list)
+	}
+
+	tampered := bytes.Replace(doc, []byte("1.2.3.4"), []byte("6.6.6.6"), 1)
+	if _, err := parsePeerList(tampered, trusted); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Fatalf("tampered list: got %v", err)
+	}
+	other := []ed25519.PublicKey{testPeerListKey(2).Public().(ed25519.PublicKey)}
+	if _, err := parsePeerList(doc, other); err == nil || !strings.Contains(err.Error(), "not trusted") {
+		t.Fatalf("untrusted signer: got %v", err)
+	}
+	if _, err := signPeerList([]string{"bogus"}, time.Now(), key); err == nil {
+		t.Fatal("expected error for a list without valid peers")
+	}
+}
+
+func TestDefaultPeerPoolUsesCachedList(t *testing.T) {
+	dir := withTempConfigDir(t)
+	key := testPeerListKey(1)
+	mustWriteFile(t, filepath.Join(dir, peerListFile), string(mustSignPeerList(t, key, time.Now(), "tcp://10.9.8.7:11010")))
+
+	// Not trusted yet: compiled list only.
+	withPeerListKeys(t, dir, testPeerListKey(2))
+	if got := defaultPeerPool(); !reflect.DeepEqual(got, DefaultPeers) {
+		t.Fatalf("untrusted cache: got %v", got)
+	}
+
+	withPeerListKeys(t, dir, key)
+	want := append([]string{"tcp://10.9.8.7:11010"}, DefaultPeers...)
+	if got := defaultPeerPool(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got := mergePeerPools([]string{"udp://1.1.1.1:11010"}, defaultPeerPool(), MaxPeerCount); got[1] != "tcp://10.9.8.7:11010" {
+		t.Fatalf("merged pool: %v", got)
+	}
+}
+
+func TestDefaultPeerPoolKeepsCompiledPeers(t *testing.T) {
+	dir := withTempConfigDir(t)
+	key := testPeerListKey(1)
+	withPeerListKeys(t, dir, key)
+	var listed []string
+	for i := 1; i <= DefaultPeerCount+4; i++ {
+		listed = append(listed, fmt.Sprintf("tcp://10.0.0.%d:11010", i))
+	}
+	mustWriteFile(t, filepath.Join(dir, peerListFile), string(mustSignPeerList(t, key, time.Now(), listed...)))
+
+	want := append(append([]string{}, listed[:DefaultPeerCount]...), DefaultPeers...)
+	if got := defaultPeerPool(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Loaded once: later edits only count after a refresh or restart.
+	mustWriteFile(t, filepath.Join(dir, peerListFile), string(mustSignPeerList(t, key, time.Now(), "tcp://10.1.1.1:11010")))
+	if got := defaultPeerPool(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("pool should not re-read peers.json: %v", got)
+	}
+}
+
+func TestCachedDefaultPeersReportsBadConfig(t *testing.T) {
+	dir := withTempConfigDir(t)
+	mustWriteFile(t, filepath.Join(dir, telehandConfigFile), "peer_list_keys = [\"abc\"]\n")
+	if _, err := loadCachedDefaultPeers(); err == nil || !strings.Contains(err.Error(), "config.toml") {
+		t.Fatalf("expected config error, got %v", err)
+	}
+	if got := defaultPeerPool(); !reflect.DeepEqual(got, DefaultPeers) {
+		t.Fatalf("bad config should fall back to DefaultPeers: %v", got)
+	}
+}
+
+func TestRefreshPeerList(t *testing.T) {
+	dir := withTempConfigDir(t)
+	key := testPeerListKey(1)
+	withPeerListKeys(t, dir, key)
+
+	var served []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(served) }))
+	defer srv.Close()
+	src, err := loadPeerListSource()
+	if err != nil {
+		t.Fatalf("source: %v", err)
+	}
+	src.URL = srv.URL
+
+	now := time.Now()
+	before := defaultPeerPool()
+	served = mustSignPeerList(t, key, now, "tcp://10.0.0.1:11010")
+	if _, err := refreshPeerList(context.Background(), src); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	// The running process keeps the pool it loaded; the next one sees the
+	// new list.
+	if got := defaultPeerPool(); !reflect.DeepEqual(got, before) {
+		t.Fatalf("pool changed within the process: %v", got)
+	}
+	resetCachedDefaultPeers()
+	if got := defaultPeerPool(); got[0] != "tcp://10.0.0.1:11010" {
+		t.Fatalf("pool after refresh: %v", got)
+	}
+
+	served = mustSignPeerList(t, key, now.Add(-time.Hour), "tcp://10.0.0.2:11010")
+	if _, err := refreshPeerList(context.Background(), src); err == nil || !strings.Contains(err.Error(), "older") {
+		t.Fatalf("rollback: got %v", err)
+	}
+	served = mustSignPeerList(t, testPeerListKey(2), now.Add(time.Hour), "tcp://10.0.0.3:11010")
+	if _, err := refreshPeerList(context.Background(), src); err == nil {
+		t.Fatal("expected untrusted list to be refused")
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, peerListFile))
+	if err != nil || !strings.Contains(string(raw), "10.0.0.1") {
+		t.Fatalf("cache should still hold the first list: %s, %v", raw, err)
+	}
+}
+
+func TestParseTelehandConfigPeerList(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(testPeerListKey(1).Public().(ed25519.PublicKey))
+	cfg, err := parseTelehandConfig([]byte("peer_list_url = \"https://example.com/peers.json\"\npeer_list_keys = \"" + key + "\"\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.PeerListURL != "https://example.com/peers.json" || !reflect.DeepEqual(cfg.PeerListKeys, []string{key}) {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if _, err := parseTelehandConfig([]byte("peer_list_keys = [\"abc\"]\n")); err == nil || !strings.Contains(err.Error(), "1: invalid peer list key") {
+		t.Fatalf("expected invalid key error, got %v", err)
+	}
+}
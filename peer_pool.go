@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"sort"
 	"strings"
 )
 
@@ -13,6 +14,8 @@ const (
 	InvalidPeerDrop  = true
 )
 
+// DefaultPeers is the compiled-in fallback for when there is no valid
+// signed peer list cached (see peer_list.go).
 var DefaultPeers = []string{
 	"tcp://43.139.65.49:11010",
 	"tcp://39.108.52.138:11010",
@@ -27,12 +30,17 @@ func parsePeers(peers string) []string {
 	return normalizePeerPool(raw, MaxPeerCount, InvalidPeerDrop)
 }
 
+// defaultPeerPool is the cached signed list, capped at DefaultPeerCount,
+// followed by DefaultPeers. The compiled peers are never capped away:
+// they are what a receiver that never refreshed has, and short codes
+// rely on both sides sharing them.
 func defaultPeerPool() []string {
 	limit := DefaultPeerCount
 	if limit <= 0 {
 		limit = MaxPeerCount
 	}
-	return normalizePeerPool(DefaultPeers, limit, InvalidPeerDrop)
+	pool := normalizePeerPool(cachedDefaultPeers(), limit, InvalidPeerDrop)
+	return mergePeerPools(pool, DefaultPeers, MaxPeerCount)
 }
 
 func mergePeerPools(preferred, fallback []string, maxCount int) []string {
@@ -82,6 +90,30 @@ func normalizePeerPool(raw []string, maxCount int, dropInvalid bool) []string {
 	return out
 }
 
+// peerSchemes are the EasyTier tunnel schemes a peer may use, mapped to
+// the transport each runs over. ws and wss get through HTTP proxies and
+// firewalls that only allow web traffic.
+var peerSchemes = map[string]string{
+	"tcp":  "tcp",
+	"udp":  "udp",
+	"ws":   "tcp",
+	"wss":  "tcp",
+	"quic": "udp",
+	"wg":   "udp",
+}
+
+func peerSchemeNames() []string {
+	names := make([]string, 0, len(peerSchemes))
+	for name := range peerSchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// peerDefaultPorts fill in a missing port; the other schemes need one.
+var peerDefaultPorts = map[string]string{"ws": "80", "wss": "443"}
+
 func normalizePeerAddress(peer string) (string, bool) {
 	value := strings.TrimSpace(peer)
 	if value == "" {
@@ -95,13 +127,26 @@ func normalizePeerAddress(peer string) (string, bool) {
 		return "", false
 	}
 	scheme := strings.ToLower(strings.TrimSpace(u.Scheme))
-	if scheme != "tcp" && scheme != "udp" {
+	transport, ok := peerSchemes[scheme]
+	if !ok {
 		return "", false
 	}
-	if strings.TrimSpace(u.Path) != "" && strings.TrimSpace(u.Path) != "/" {
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
 		return "", false
 	}
-	host, port, err := net.SplitHostPort(u.Host)
+	// Only WebSocket peers have a meaningful path.
+	path := strings.TrimSpace(u.EscapedPath())
+	if path == "/" {
+		path = ""
+	}
+	if path != "" && scheme != "ws" && scheme != "wss" {
+		return "", false
+	}
+	hostport := u.Host
+	if u.Port() == "" && peerDefaultPorts[scheme] != "" {
+		hostport = net.JoinHostPort(u.Hostname(), peerDefaultPorts[scheme])
+	}
+	host, port, err := net.SplitHostPort(hostport)
 	if err != nil {
 		return "", false
 	}
@@ -110,10 +155,10 @@ func normalizePeerAddress(peer string) (string, bool) {
 	if host == "" || port == "" {
 		return "", false
 	}
-	if _, err := net.LookupPort(scheme, port); err != nil {
+	if _, err := net.LookupPort(transport, port); err != nil {
 		return "", false
 	}
-	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port)), true
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, port), path), true
 }
 
 func maskPeerAddress(peer string) string {
@@ -130,7 +175,12 @@ func maskPeerAddress(peer string) string {
 		return "***"
 	}
 	maskedHost := maskHostToken(host)
-	return fmt.Sprintf("%s://%s", u.Scheme, net.JoinHostPort(maskedHost, port))
+	// A WebSocket path can be as identifying as the host.
+	path := ""
+	if u.Path != "" {
+		path = "/***"
+	}
+	return fmt.Sprintf("%s://%s%s", u.Scheme, net.JoinHostPort(maskedHost, port), path)
 }
 
 func maskHostToken(host string) string {
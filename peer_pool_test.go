@@ -52,3 +52,35 @@ func TestNormalizePeerAddressRejectsInvalidScheme(t *testing.T) {
 		t.Fatal("expected http peer to be rejected")
 	}
 }
+
+func TestParsePeersAcceptsAllTunnelSchemes(t *testing.T) {
+	got := parsePeers("WS://relay.example.com/et, wss://relay.example.com, quic://1.1.1.1:11012, wg://[2001:db8::1]:11011, " +
+		"udp://1.1.1.1:11010/path, tcp://1.1.1.1:11010?x=1, wss://user@relay.example.com:443")
+	want := []string{
+		"ws://relay.example.com:80/et",
+		"wss://relay.example.com:443",
+		"quic://1.1.1.1:11012",
+		"wg://[2001:db8::1]:11011",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsePeers mismatch: got=%v want=%v", got, want)
+	}
+	if _, ok := normalizePeerAddress("quic://1.1.1.1"); ok {
+		t.Fatal("expected quic peer without port to be rejected")
+	}
+}
+
+func TestMaskPeerAddressSchemes(t *testing.T) {
+	cases := map[string]string{
+		"tcp://43.139.65.49:11010":       "tcp://43.139.*.*:11010",
+		"wss://relay.example.com/secret": "wss://re***************:443/***",
+		"quic://10.1.2.3:11012":          "quic://10.1.*.*:11012",
+		"wg://10.1.2.3:11011":            "wg://10.1.*.*:11011",
+		"http://10.1.2.3:80":             "***",
+	}
+	for in, want := range cases {
+		if got := maskPeerAddress(in); got != want {
+			t.Fatalf("maskPeerAddress(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
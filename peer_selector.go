@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"net/url"
 	"sort"
 	"strings"
@@ -15,9 +21,16 @@ type PeerProbeResult struct {
 	Peer      string
 	Latency   time.Duration
 	Reachable bool
-	Err       error
+	// Unmeasured peers (udp, quic, wg) were not contacted at all; they
+	// rank after every reachable peer and before unreachable ones.
+	Unmeasured bool
+	Err        error
 }
 
+// errPeerNotProbed marks a peer the probe cannot reach without speaking
+// its protocol, so it has neither a latency nor a verdict.
+var errPeerNotProbed = errors.New("not probed")
+
 type PeerSelection struct {
 	Ordered []string
 	Results []PeerProbeResult
@@ -76,14 +89,16 @@ func rankPeersByLatencyWithProbe(
 			for t := range workCh {
 				latency, err := probe(t.peer, timeout, sampleCount)
 				reachable := err == nil
+				unmeasured := errors.Is(err, errPeerNotProbed)
 				if !reachable {
 					latency = PeerProbeUnreachableRTT
 				}
 				results[t.idx] = PeerProbeResult{
-					Peer:      t.peer,
-					Latency:   latency,
-					Reachable: reachable,
-					Err:       err,
+					Peer:       t.peer,
+					Latency:    latency,
+					Reachable:  reachable,
+					Unmeasured: unmeasured,
+					Err:        err,
 				}
 			}
 		}()
@@ -97,8 +112,8 @@ func rankPeersByLatencyWithProbe(
 
 	orderedResults := append([]PeerProbeResult(nil), results...)
 	sort.SliceStable(orderedResults, func(i, j int) bool {
-		if orderedResults[i].Reachable != orderedResults[j].Reachable {
-			return orderedResults[i].Reachable
+		if ri, rj := probeRank(orderedResults[i]), probeRank(orderedResults[j]); ri != rj {
+			return ri < rj
 		}
 		if orderedResults[i].Latency != orderedResults[j].Latency {
 			return orderedResults[i].Latency < orderedResults[j].Latency
@@ -115,6 +130,19 @@ func rankPeersByLatencyWithProbe(
 	}
 }
 
+// probeRank orders measured reachable peers first, then peers that were
+// not probed (kept in pool order), then unreachable ones.
+func probeRank(res PeerProbeResult) int {
+	switch {
+	case res.Reachable:
+		return 0
+	case res.Unmeasured:
+		return 1
+	default:
+		return 2
+	}
+}
+
 func formatPeerSelectionForLog(results []PeerProbeResult, masked bool) string {
 	if len(results) == 0 {
 		return "-"
@@ -125,6 +153,10 @@ func formatPeerSelectionForLog(results []PeerProbeResult, masked bool) string {
 		if masked {
 			peer = maskPeerAddress(peer)
 		}
+		if res.Unmeasured {
+			items = append(items, fmt.Sprintf("%s(unmeasured)", peer))
+			continue
+		}
 		if !res.Reachable {
 			items = append(items, fmt.Sprintf("%s(unreachable)", peer))
 			continue
@@ -138,42 +170,117 @@ func probePeerLatency(peer string, timeout time.Duration, sampleCount int) (time
 	if sampleCount <= 0 {
 		sampleCount = 1
 	}
-	network, address, err := peerDialTarget(peer)
+	target, err := peerDialTarget(peer)
 	if err != nil {
 		return 0, err
 	}
 	total := time.Duration(0)
 	for i := 0; i < sampleCount; i++ {
-		start := time.Now()
-		conn, dialErr := net.DialTimeout(network, address, timeout)
-		if dialErr != nil {
-			return 0, dialErr
+		rtt, err := target.probe(timeout)
+		if err != nil {
+			return 0, err
 		}
-		_ = conn.Close()
-		total += time.Since(start)
+		total += rtt
 	}
 	return total / time.Duration(sampleCount), nil
 }
 
-func peerDialTarget(peer string) (string, string, error) {
+// peerTarget is what a latency probe connects to for one peer.
+type peerTarget struct {
+	Scheme  string
+	Network string // "tcp" or "udp"
+	Address string // host:port
+	Path    string // ws/wss only
+}
+
+func peerDialTarget(peer string) (peerTarget, error) {
 	normalized, ok := normalizePeerAddress(peer)
 	if !ok {
-		return "", "", errors.New("invalid peer address")
+		return peerTarget{}, errors.New("invalid peer address")
 	}
 	u, err := url.Parse(normalized)
 	if err != nil || u == nil {
-		return "", "", errors.New("invalid peer address")
+		return peerTarget{}, errors.New("invalid peer address")
 	}
 	host, port, err := net.SplitHostPort(u.Host)
 	if err != nil {
-		return "", "", errors.New("invalid peer host:port")
+		return peerTarget{}, errors.New("invalid peer host:port")
 	}
 	scheme := strings.ToLower(strings.TrimSpace(u.Scheme))
-	switch scheme {
-	case "tcp", "udp":
-		return scheme, net.JoinHostPort(host, port), nil
-	default:
-		return "", "", fmt.Errorf("unsupported peer scheme: %s", scheme)
+	network, ok := peerSchemes[scheme]
+	if !ok {
+		return peerTarget{}, fmt.Errorf("unsupported peer scheme: %s", scheme)
 	}
+	return peerTarget{
+		Scheme:  scheme,
+		Network: network,
+		Address: net.JoinHostPort(host, port),
+		Path:    u.EscapedPath(),
+	}, nil
 }
 
+// probe takes one latency sample: the connect time. For ws and wss the
+// TLS and WebSocket handshakes then decide pass or fail without adding to
+// the sample, since a proxy in the way can accept the TCP connection and
+// still refuse the tunnel. udp, quic and wg get errPeerNotProbed: there
+// is nothing to handshake with short of speaking the protocol, so they
+// are not contacted at all.
+func (t peerTarget) probe(timeout time.Duration) (time.Duration, error) {
+	if t.Network != "tcp" {
+		return 0, errPeerNotProbed
+	}
+	deadline := time.Now().Add(timeout)
+	start := time.Now()
+	conn, err := net.DialTimeout(t.Network, t.Address, timeout)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	defer conn.Close()
+	switch t.Scheme {
+	case "wss":
+		host, _, _ := net.SplitHostPort(t.Address)
+		// EasyTier serves wss with a self-signed certificate by default and
+		// its own client does not verify it either; the probe only checks
+		// that a tunnel endpoint answers.
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+		tlsConn.SetDeadline(deadline)
+		if err := tlsConn.Handshake(); err != nil {
+			return 0, fmt.Errorf("tls handshake: %w", err)
+		}
+		err = websocketHandshake(tlsConn, t.Address, t.Path, deadline)
+	case "ws":
+		err = websocketHandshake(conn, t.Address, t.Path, deadline)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return rtt, nil
+}
+
+// websocketHandshake sends an upgrade request and wants 101 back.
+func websocketHandshake(conn net.Conn, host, path string, deadline time.Time) error {
+	if path == "" {
+		path = "/"
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n",
+		path, host, base64.StdEncoding.EncodeToString(nonce[:]))
+	if _, err := io.WriteString(conn, req); err != nil {
+		return fmt.Errorf("websocket handshake: %w", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return fmt.Errorf("websocket handshake: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("websocket handshake: %s", resp.Status)
+	}
+	return nil
+}
@@ -2,6 +2,10 @@ package main
 
 import (
 	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -47,6 +51,37 @@ func TestRankPeersByLatencyWithProbeOrdersReachableFirst(t *testing.T) {
 	}
 }
 
+func TestRankPeersByLatencyKeepsUnprobedBetween(t *testing.T) {
+	peers := []string{
+		"udp://1.1.1.1:11010",
+		"tcp://2.2.2.2:11010",
+		"wg://3.3.3.3:11011",
+		"tcp://4.4.4.4:11010",
+	}
+	probe := func(peer string, timeout time.Duration, sampleCount int) (time.Duration, error) {
+		switch peer {
+		case "tcp://2.2.2.2:11010":
+			return 40 * time.Millisecond, nil
+		case "tcp://4.4.4.4:11010":
+			return 0, errors.New("timeout")
+		}
+		return probePeerLatency(peer, timeout, sampleCount)
+	}
+	selection := rankPeersByLatencyWithProbe(peers, 800*time.Millisecond, 4, 1, probe)
+	want := []string{"tcp://2.2.2.2:11010", "udp://1.1.1.1:11010", "wg://3.3.3.3:11011", "tcp://4.4.4.4:11010"}
+	for i := range want {
+		if selection.Ordered[i] != want[i] {
+			t.Fatalf("order: got %v, want %v", selection.Ordered, want)
+		}
+	}
+	if r := selection.Results[1]; r.Reachable || !r.Unmeasured {
+		t.Fatalf("udp peer should be unmeasured, got %+v", r)
+	}
+	if line := formatPeerSelectionForLog(selection.Results, false); !strings.Contains(line, "udp://1.1.1.1:11010(unmeasured)") {
+		t.Fatalf("expected unmeasured marker, got %q", line)
+	}
+}
+
 func TestFormatPeerSelectionForLog(t *testing.T) {
 	line := formatPeerSelectionForLog([]PeerProbeResult{
 		{Peer: "tcp://1.2.3.4:11010", Latency: 12 * time.Millisecond, Reachable: true},
@@ -64,7 +99,60 @@ func TestFormatPeerSelectionForLog(t *testing.T) {
 }
 
 func TestPeerDialTargetRejectsInvalidPeer(t *testing.T) {
-	if _, _, err := peerDialTarget("bad-peer"); err == nil {
+	if _, err := peerDialTarget("bad-peer"); err == nil {
 		t.Fatal("expected peerDialTarget to fail on invalid peer")
 	}
 }
+
+func TestPeerDialTargetPerScheme(t *testing.T) {
+	cases := map[string]peerTarget{
+		"tcp://1.2.3.4:11010":     {Scheme: "tcp", Network: "tcp", Address: "1.2.3.4:11010"},
+		"wss://relay.example.com": {Scheme: "wss", Network: "tcp", Address: "relay.example.com:443"},
+		"ws://1.2.3.4:8080/et":    {Scheme: "ws", Network: "tcp", Address: "1.2.3.4:8080", Path: "/et"},
+		"quic://1.2.3.4:11012":    {Scheme: "quic", Network: "udp", Address: "1.2.3.4:11012"},
+		"wg://1.2.3.4:11011":      {Scheme: "wg", Network: "udp", Address: "1.2.3.4:11011"},
+	}
+	for peer, want := range cases {
+		got, err := peerDialTarget(peer)
+		if err != nil || got != want {
+			t.Fatalf("peerDialTarget(%q) = %+v, %v, want %+v", peer, got, err, want)
+		}
+	}
+}
+
+// websocketUpgradeHandler answers upgrades on /et like an EasyTier ws
+// listener and 404s everything else.
+func websocketUpgradeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/et" || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || r.Header.Get("Sec-WebSocket-Key") == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Upgrade", "websocket")
+	w.Header().Set("Connection", "Upgrade")
+	w.WriteHeader(http.StatusSwitchingProtocols)
+}
+
+func TestProbePeerLatencyWebSocket(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(websocketUpgradeHandler))
+	defer plain.Close()
+	secure := httptest.NewUnstartedServer(http.HandlerFunc(websocketUpgradeHandler))
+	secure.Config.ErrorLog = log.New(io.Discard, "", 0)
+	secure.StartTLS()
+	defer secure.Close()
+
+	wsPeer := "ws://" + plain.Listener.Addr().String() + "/et"
+	wssPeer := "wss://" + secure.Listener.Addr().String() + "/et"
+	for _, peer := range []string{wsPeer, wssPeer} {
+		if _, err := probePeerLatency(peer, 2*time.Second, 2); err != nil {
+			t.Fatalf("probe %s: %v", peer, err)
+		}
+	}
+	// A web server that is not a tunnel endpoint is not a usable peer.
+	if _, err := probePeerLatency(strings.TrimSuffix(wsPeer, "/et")+"/other", 2*time.Second, 1); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 handshake failure, got %v", err)
+	}
+	// Plain ws against a TLS listener fails the handshake too.
+	if _, err := probePeerLatency("ws://"+secure.Listener.Addr().String()+"/et", 2*time.Second, 1); err == nil {
+		t.Fatal("expected ws probe of a TLS listener to fail")
+	}
+}
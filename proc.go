@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errProcessNotFound = errors.New("process not found")
+
+type ProcessInfo struct {
+	PID        int     `json:"pid"`
+	PPID       int     `json:"ppid"`
+	Name       string  `json:"name"`
+	Cmdline    string  `json:"cmdline"`
+	User       string  `json:"user"`
+	CPUPercent float64 `json:"cpu_percent"`
+	CPUSeconds float64 `json:"cpu_seconds"`
+	RSS        int64   `json:"rss"`
+	StartTime  int64   `json:"start_time"`
+}
+
+type ProcPort struct {
+	Proto      string `json:"proto"`
+	LocalAddr  string `json:"local_addr"`
+	LocalPort  int    `json:"local_port"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	RemotePort int    `json:"remote_port,omitempty"`
+	State      string `json:"state,omitempty"`
+}
+
+type PsReq struct {
+	Filter string `json:"filter,omitempty"`
+	User   string `json:"user,omitempty"`
+	Sort   string `json:"sort,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type PsResp struct {
+	Processes []ProcessInfo `json:"processes"`
+	Total     int           `json:"total"`
+}
+
+type ProcInspectReq struct {
+	PID int `json:"pid"`
+}
+
+type ProcInspectResp struct {
+	ProcessInfo
+	Exe      string     `json:"exe,omitempty"`
+	Cwd      string     `json:"cwd,omitempty"`
+	Env      []string   `json:"env,omitempty"`
+	Ports    []ProcPort `json:"ports"`
+	Warnings []string   `json:"warnings,omitempty"`
+}
+
+type ProcSignalReq struct {
+	PID    int    `json:"pid"`
+	Signal string `json:"signal,omitempty"`
+}
+
+type ProcSignalResp struct {
+	OK     bool   `json:"ok"`
+	PID    int    `json:"pid"`
+	Signal string `json:"signal"`
+}
+
+// procCommandTimeout bounds the ps, lsof and PowerShell calls behind /ps
+// and /proc/inspect, like /sysinfo's.
+const procCommandTimeout = sysInfoCommandTimeout
+
+var (
+	listProcessesFn  = listProcesses
+	inspectProcessFn = inspectProcess
+	signalProcessFn  = signalProcess
+)
+
+func (s *APIServer) handlePs(w http.ResponseWriter, r *http.Request) {
+	var req PsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	switch req.Sort {
+	case "", "pid", "cpu", "rss", "start":
+	default:
+		jsonErr(w, "sort must be one of pid, cpu, rss, start", 400)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), procCommandTimeout)
+	defer cancel()
+	procs, err := listProcessesFn(ctx)
+	if err != nil {
+		apiErr(w, err, 500)
+		return
+	}
+	procs = filterProcesses(procs, req.Filter, req.User)
+	sortProcesses(procs, req.Sort)
+	total := len(procs)
+	if req.Limit > 0 && len(procs) > req.Limit {
+		procs = procs[:req.Limit]
+	}
+
+	summary := fmt.Sprintf("%d processes", total)
+	if req.Filter != "" {
+		summary = truncate(req.Filter, 60) + " " + summary
+	}
+	s.addLog("POST", "/ps", summary)
+	json.NewEncoder(w).Encode(PsResp{Processes: procs, Total: total})
+}
+
+func (s *APIServer) handleProcInspect(w http.ResponseWriter, r *http.Request) {
+	var req ProcInspectReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	if req.PID <= 0 {
+		jsonErr(w, "pid is required", 400)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), procCommandTimeout)
+	defer cancel()
+	resp, err := inspectProcessFn(ctx, req.PID)
+	if err != nil {
+		if errors.Is(err, errProcessNotFound) {
+			jsonErrWithCode(w, fmt.Sprintf("pid %d: %v", req.PID, err), ErrorCodeNotFound, 200)
+			return
+		}
+		apiErr(w, err, 500)
+		return
+	}
+	if resp.Ports == nil {
+		resp.Ports = []ProcPort{}
+	}
+	s.addLog("POST", "/proc/inspect", fmt.Sprintf("pid=%d %s", req.PID, truncate(resp.Name, 60)))
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *APIServer) handleProcSignal(w http.ResponseWriter, r *http.Request) {
+	var req ProcSignalReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "invalid request body", 400)
+		return
+	}
+	if req.PID <= 0 {
+		jsonErr(w, "pid is required", 400)
+		return
+	}
+	if req.PID == 1 || req.PID == os.Getpid() {
+		jsonErrWithCode(w, fmt.Sprintf("refusing to signal pid %d", req.PID), ErrorCodePermissionDenied, 400)
+		return
+	}
+	sig := normalizeSignalName(req.Signal)
+
+	if err := signalProcessFn(req.PID, sig); err != nil {
+		if errors.Is(err, errProcessNotFound) {
+			jsonErrWithCode(w, fmt.Sprintf("pid %d: %v", req.PID, err), ErrorCodeNotFound, 200)
+			return
+		}
+		var unsupported *unsupportedSignalError
+		if errors.As(err, &unsupported) {
+			apiErr(w, err, 400)
+			return
+		}
+		apiErr(w, err, 500)
+		return
+	}
+	s.addLog("POST", "/proc/signal", fmt.Sprintf("pid=%d SIG%s", req.PID, sig))
+	json.NewEncoder(w).Encode(ProcSignalResp{OK: true, PID: req.PID, Signal: sig})
+}
+
+type unsupportedSignalError struct {
+	signal string
+}
+
+func (e *unsupportedSignalError) Error() string {
+	return fmt.Sprintf("unsupported signal: %s", e.signal)
+}
+
+// normalizeSignalName accepts "TERM", "SIGTERM", "sigterm" and defaults to
+// TERM so that callers can write either form.
+func normalizeSignalName(sig string) string {
+	name := strings.ToUpper(strings.TrimSpace(sig))
+	name = strings.TrimPrefix(name, "SIG")
+	if name == "" {
+		return "TERM"
+	}
+	return name
+}
+
+func filterProcesses(procs []ProcessInfo, filter, user string) []ProcessInfo {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+	user = strings.TrimSpace(user)
+	if filter == "" && user == "" {
+		return procs
+	}
+	out := procs[:0]
+	for _, p := range procs {
+		if user != "" && !strings.EqualFold(p.User, user) {
+			continue
+		}
+		if filter != "" && !strings.Contains(strings.ToLower(p.Name), filter) && !strings.Contains(strings.ToLower(p.Cmdline), filter) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func sortProcesses(procs []ProcessInfo, by string) {
+	sort.SliceStable(procs, func(i, j int) bool {
+		switch by {
+		case "cpu":
+			if procs[i].CPUPercent != procs[j].CPUPercent {
+				return procs[i].CPUPercent > procs[j].CPUPercent
+			}
+		case "rss":
+			if procs[i].RSS != procs[j].RSS {
+				return procs[i].RSS > procs[j].RSS
+			}
+		case "start":
+			if procs[i].StartTime != procs[j].StartTime {
+				return procs[i].StartTime > procs[j].StartTime
+			}
+		}
+		return procs[i].PID < procs[j].PID
+	})
+}
+
+func sortProcPorts(ports []ProcPort) {
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Proto != ports[j].Proto {
+			return ports[i].Proto < ports[j].Proto
+		}
+		if ports[i].LocalPort != ports[j].LocalPort {
+			return ports[i].LocalPort < ports[j].LocalPort
+		}
+		return ports[i].RemotePort < ports[j].RemotePort
+	})
+}
+
+func cpuPercentSince(cpuSeconds float64, start int64, now time.Time) float64 {
+	elapsed := now.Sub(time.Unix(start, 0)).Seconds()
+	if start <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return roundTo(cpuSeconds/elapsed*100, 1)
+}
+
+func roundTo(v float64, digits int) float64 {
+	p := 1.0
+	for i := 0; i < digits; i++ {
+		p *= 10
+	}
+	return float64(int64(v*p+0.5)) / p
+}
+
+// procStat holds the fields of /proc/<pid>/stat that /ps reports.
+type procStat struct {
+	Comm      string
+	PPID      int
+	UTime     uint64
+	STime     uint64
+	StartTick uint64
+	RSSPages  int64
+}
+
+// parseProcStat parses /proc/<pid>/stat. comm is enclosed in parentheses and
+// may itself contain spaces or ')' so the last ')' ends it.
+func parseProcStat(raw string) (procStat, error) {
+	var st procStat
+	open := strings.IndexByte(raw, '(')
+	end := strings.LastIndexByte(raw, ')')
+	if open < 0 || end < open {
+		return st, fmt.Errorf("malformed stat: %q", truncate(raw, 40))
+	}
+	st.Comm = raw[open+1 : end]
+	fields := strings.Fields(raw[end+1:])
+	// fields[0] is field 3 (state) of proc(5).
+	if len(fields) < 22 {
+		return st, fmt.Errorf("malformed stat: %d fields", len(fields))
+	}
+	var err error
+	if st.PPID, err = strconv.Atoi(fields[1]); err != nil {
+		return st, err
+	}
+	st.UTime, _ = strconv.ParseUint(fields[11], 10, 64)
+	st.STime, _ = strconv.ParseUint(fields[12], 10, 64)
+	st.StartTick, _ = strconv.ParseUint(fields[19], 10, 64)
+	st.RSSPages, _ = strconv.ParseInt(fields[21], 10, 64)
+	return st, nil
+}
+
+var procTCPStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// parseProcNetSockets parses /proc/net/{tcp,tcp6,udp,udp6} and returns the
+// sockets keyed by inode.
+func parseProcNetSockets(raw, proto string) map[string]ProcPort {
+	out := make(map[string]ProcPort)
+	for i, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 10 {
+			continue
+		}
+		laddr, lport, ok1 := parseProcNetAddr(fields[1])
+		raddr, rport, ok2 := parseProcNetAddr(fields[2])
+		if !ok1 || !ok2 {
+			continue
+		}
+		port := ProcPort{Proto: proto, LocalAddr: laddr, LocalPort: lport}
+		if strings.HasPrefix(proto, "tcp") {
+			port.State = procTCPStates[strings.ToUpper(fields[3])]
+		}
+		if rport != 0 {
+			port.RemoteAddr, port.RemotePort = raddr, rport
+		}
+		out[fields[9]] = port
+	}
+	return out
+}
+
+// parseProcNetAddr decodes "0100007F:1F90" style addresses. The kernel prints
+// each 32-bit word of the address in host (little-endian) order.
+func parseProcNetAddr(s string) (string, int, bool) {
+	host, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, false
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	b, err := hex.DecodeString(host)
+	if err != nil || (len(b) != 4 && len(b) != 16) {
+		return "", 0, false
+	}
+	for i := 0; i+4 <= len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	return net.IP(b).String(), int(port), true
+}
+
+// parsePsCPUTime parses the cputime column of ps: "[dd-]hh:mm:ss" on Linux
+// and "mmm:ss.cc" on macOS.
+func parsePsCPUTime(s string) float64 {
+	var days float64
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		v, _ := strconv.ParseFloat(d, 64)
+		days, s = v, rest
+	}
+	var total float64
+	for _, part := range strings.Split(s, ":") {
+		v, _ := strconv.ParseFloat(part, 64)
+		total = total*60 + v
+	}
+	return days*86400 + total
+}
+
+// parsePsLine parses one line of
+// `ps -o pid=,ppid=,user=,%cpu=,rss=,time=,lstart=,args=` as printed by the
+// macOS ps with LC_ALL=C. rss is reported in KiB.
+func parsePsLine(line string, loc *time.Location) (ProcessInfo, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 11 {
+		return ProcessInfo{}, false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return ProcessInfo{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	cpu, _ := strconv.ParseFloat(fields[3], 64)
+	rssKiB, _ := strconv.ParseInt(fields[4], 10, 64)
+	p := ProcessInfo{
+		PID:        pid,
+		PPID:       ppid,
+		User:       fields[2],
+		CPUPercent: cpu,
+		CPUSeconds: parsePsCPUTime(fields[5]),
+		RSS:        rssKiB * 1024,
+		Cmdline:    strings.Join(fields[11:], " "),
+	}
+	if start, err := time.ParseInLocation("Mon Jan 2 15:04:05 2006", strings.Join(fields[6:11], " "), loc); err == nil {
+		p.StartTime = start.Unix()
+	}
+	if len(fields) > 11 {
+		p.Name = filepath.Base(fields[11])
+	}
+	return p, true
+}
+
+// parseLsofFields parses `lsof -F PnT` output into ports. Each network file
+// starts with an 'f' line followed by protocol, name and TCP state lines.
+func parseLsofFields(raw string) []ProcPort {
+	var out []ProcPort
+	var cur *ProcPort
+	flush := func() {
+		if cur != nil && cur.Proto != "" {
+			out = append(out, *cur)
+		}
+		cur = nil
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		if line == "" {
+			continue
+		}
+		val := line[1:]
+		switch line[0] {
+		case 'f':
+			flush()
+			cur = &ProcPort{}
+		case 'P':
+			if cur != nil {
+				cur.Proto = strings.ToLower(val)
+			}
+		case 'n':
+			if cur == nil {
+				continue
+			}
+			local, remote, _ := strings.Cut(val, "->")
+			cur.LocalAddr, cur.LocalPort = splitLsofAddr(local)
+			if remote != "" {
+				cur.RemoteAddr, cur.RemotePort = splitLsofAddr(remote)
+			}
+		case 'T':
+			if cur != nil && strings.HasPrefix(val, "ST=") {
+				cur.State = strings.TrimPrefix(val, "ST=")
+			}
+		}
+	}
+	flush()
+	return out
+}
+
+func splitLsofAddr(s string) (string, int) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return s, 0
+	}
+	port, _ := strconv.Atoi(s[i+1:])
+	host := strings.TrimSuffix(strings.TrimPrefix(s[:i], "["), "]")
+	return host, port
+}
+
+// processDescendants returns the pids of every process below root in the
+// ppid tree, children before grandchildren.
+func processDescendants(procs []ProcessInfo, root int) []int {
+	children := make(map[int][]int)
+	for _, p := range procs {
+		if p.PID != p.PPID {
+			children[p.PPID] = append(children[p.PPID], p.PID)
+		}
+	}
+	var out []int
+	queue := []int{root}
+	seen := map[int]bool{root: true}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		for _, c := range children[pid] {
+			if !seen[c] {
+				seen[c] = true
+				out = append(out, c)
+				queue = append(queue, c)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+//go:build darwin
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const darwinPsColumns = "pid=,ppid=,user=,%cpu=,rss=,time=,lstart=,args="
+
+func runDarwinPs(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "ps", args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ps failed: %v", err)
+	}
+	return string(out), nil
+}
+
+// darwinProcessNames maps pid to executable path; comm is printed alone so
+// paths containing spaces are not split like args are.
+func darwinProcessNames(ctx context.Context, args ...string) map[int]string {
+	out, err := runDarwinPs(ctx, append(args, "-o", "pid=,comm=")...)
+	if err != nil {
+		return nil
+	}
+	names := make(map[int]string)
+	for _, line := range strings.Split(out, "\n") {
+		pidStr, comm, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		if pid, err := strconv.Atoi(pidStr); err == nil {
+			names[pid] = strings.TrimSpace(comm)
+		}
+	}
+	return names
+}
+
+func readDarwinProcesses(ctx context.Context, args ...string) ([]ProcessInfo, map[int]string, error) {
+	out, err := runDarwinPs(ctx, append(args, "-o", darwinPsColumns)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := darwinProcessNames(ctx, args...)
+	var procs []ProcessInfo
+	for _, line := range strings.Split(out, "\n") {
+		p, ok := parsePsLine(line, time.Local)
+		if !ok {
+			continue
+		}
+		if comm := names[p.PID]; comm != "" {
+			p.Name = filepath.Base(comm)
+		}
+		procs = append(procs, p)
+	}
+	return procs, names, nil
+}
+
+func listProcesses(ctx context.Context) ([]ProcessInfo, error) {
+	procs, _, err := readDarwinProcesses(ctx, "-axww")
+	return procs, err
+}
+
+func inspectProcess(ctx context.Context, pid int) (ProcInspectResp, error) {
+	procs, names, err := readDarwinProcesses(ctx, "-ww", "-p", strconv.Itoa(pid))
+	if err != nil && ctx.Err() != nil {
+		return ProcInspectResp{}, err
+	}
+	if err != nil || len(procs) == 0 {
+		// ps exits non-zero when the pid does not exist.
+		return ProcInspectResp{}, errProcessNotFound
+	}
+	resp := ProcInspectResp{ProcessInfo: procs[0], Exe: names[pid]}
+	resp.Warnings = append(resp.Warnings, "env: not available on darwin")
+
+	cwdOut, err := exec.CommandContext(ctx, "lsof", "-a", "-p", strconv.Itoa(pid), "-d", "cwd", "-Fn").Output()
+	if err == nil {
+		for _, line := range strings.Split(string(cwdOut), "\n") {
+			if strings.HasPrefix(line, "n") {
+				resp.Cwd = strings.TrimPrefix(line, "n")
+			}
+		}
+	}
+	if resp.Cwd == "" {
+		resp.Warnings = append(resp.Warnings, "cwd: not permitted or lsof unavailable")
+	}
+
+	// lsof exits 1 when the process has no network files; that is not an error.
+	portsOut, err := exec.CommandContext(ctx, "lsof", "-a", "-p", strconv.Itoa(pid), "-i", "-nP", "-FPnT").Output()
+	if err != nil && len(portsOut) == 0 {
+		if _, ok := err.(*exec.ExitError); !ok {
+			resp.Warnings = append(resp.Warnings, "ports: "+err.Error())
+		}
+	}
+	resp.Ports = parseLsofFields(string(portsOut))
+	sortProcPorts(resp.Ports)
+	return resp, nil
+}
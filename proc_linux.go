@@ -0,0 +1,178 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// USER_HZ is 100 on every Linux architecture telehand ships for.
+const procClockTicks = 100
+
+func listProcesses(ctx context.Context) ([]ProcessInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	boot := procBootTime()
+	users := map[string]string{}
+	now := time.Now()
+
+	out := make([]ProcessInfo, 0, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		// Processes may exit while the table is being read.
+		if p, err := readLinuxProcess(pid, boot, users, now); err == nil {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func readLinuxProcess(pid int, boot int64, users map[string]string, now time.Time) (ProcessInfo, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	raw, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ProcessInfo{}, errProcessNotFound
+		}
+		return ProcessInfo{}, err
+	}
+	st, err := parseProcStat(string(raw))
+	if err != nil {
+		return ProcessInfo{}, err
+	}
+
+	p := ProcessInfo{
+		PID:        pid,
+		PPID:       st.PPID,
+		Name:       st.Comm,
+		CPUSeconds: float64(st.UTime+st.STime) / procClockTicks,
+		RSS:        st.RSSPages * int64(os.Getpagesize()),
+	}
+	if boot > 0 {
+		p.StartTime = boot + int64(st.StartTick/procClockTicks)
+	}
+	p.CPUPercent = cpuPercentSince(p.CPUSeconds, p.StartTime, now)
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		p.Cmdline = strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+	}
+	if uid := procStatusUID(filepath.Join(dir, "status")); uid != "" {
+		name, ok := users[uid]
+		if !ok {
+			name = uid
+			if u, err := user.LookupId(uid); err == nil {
+				name = u.Username
+			}
+			users[uid] = name
+		}
+		p.User = name
+	}
+	return p, nil
+}
+
+func procBootTime() int64 {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "btime "); ok {
+			n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+func procStatusUID(path string) string {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		if v, ok := strings.CutPrefix(line, "Uid:"); ok {
+			if fields := strings.Fields(v); len(fields) > 0 {
+				return fields[0]
+			}
+		}
+	}
+	return ""
+}
+
+func inspectProcess(ctx context.Context, pid int) (ProcInspectResp, error) {
+	p, err := readLinuxProcess(pid, procBootTime(), map[string]string{}, time.Now())
+	if err != nil {
+		return ProcInspectResp{}, err
+	}
+	resp := ProcInspectResp{ProcessInfo: p}
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+
+	if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+		resp.Exe = exe
+	}
+	if cwd, err := os.Readlink(filepath.Join(dir, "cwd")); err == nil {
+		resp.Cwd = cwd
+	} else {
+		resp.Warnings = append(resp.Warnings, "cwd: "+err.Error())
+	}
+	if env, err := os.ReadFile(filepath.Join(dir, "environ")); err == nil {
+		for _, kv := range bytes.Split(env, []byte{0}) {
+			if len(kv) > 0 {
+				resp.Env = append(resp.Env, string(kv))
+			}
+		}
+	} else {
+		resp.Warnings = append(resp.Warnings, "env: "+err.Error())
+	}
+
+	inodes, err := procSocketInodes(filepath.Join(dir, "fd"))
+	if err != nil {
+		resp.Warnings = append(resp.Warnings, "ports: "+err.Error())
+		return resp, nil
+	}
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		raw, err := os.ReadFile(filepath.Join(dir, "net", proto))
+		if err != nil {
+			continue
+		}
+		for inode, port := range parseProcNetSockets(string(raw), proto) {
+			if inodes[inode] {
+				resp.Ports = append(resp.Ports, port)
+			}
+		}
+	}
+	sortProcPorts(resp.Ports)
+	return resp, nil
+}
+
+func procSocketInodes(fdDir string) (map[string]bool, error) {
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool)
+	for _, e := range entries {
+		link, err := os.Readlink(filepath.Join(fdDir, e.Name()))
+		if err != nil {
+			continue
+		}
+		if inode, ok := strings.CutPrefix(link, "socket:["); ok {
+			out[strings.TrimSuffix(inode, "]")] = true
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseProcStatHandlesParensInComm(t *testing.T) {
+	raw := "1234 (my (weird) proc) S 1 1234 1234 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 1 0 5000 12345678 300 18446744073709551615"
+	st, err := parseProcStat(raw)
+	if err != nil {
+		t.Fatalf("parseProcStat failed: %v", err)
+	}
+	if st.Comm != "my (weird) proc" || st.PPID != 1 || st.UTime != 250 || st.STime != 50 || st.StartTick != 5000 || st.RSSPages != 300 {
+		t.Fatalf("parseProcStat mismatch: got=%+v", st)
+	}
+}
+
+func TestParseProcNetSockets(t *testing.T) {
+	raw := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 4242 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0200007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 4343 1 0000000000000000 20 4 30 10 -1`
+	got := parseProcNetSockets(raw, "tcp")
+	listen := got["4242"]
+	if listen.LocalAddr != "127.0.0.1" || listen.LocalPort != 8080 || listen.State != "LISTEN" || listen.RemotePort != 0 {
+		t.Fatalf("listen socket mismatch: got=%+v", listen)
+	}
+	conn := got["4343"]
+	if conn.RemoteAddr != "127.0.0.2" || conn.RemotePort != 54321 || conn.State != "ESTABLISHED" {
+		t.Fatalf("established socket mismatch: got=%+v", conn)
+	}
+}
+
+func TestParsePsLineDarwin(t *testing.T) {
+	line := "  501   1 joe  12.5  20480   1:02.50 Mon Jan  2 15:04:05 2006 /Applications/App.app/Contents/MacOS/App --flag"
+	p, ok := parsePsLine(line, time.UTC)
+	if !ok {
+		t.Fatalf("parsePsLine rejected line")
+	}
+	want := ProcessInfo{
+		PID: 501, PPID: 1, User: "joe", CPUPercent: 12.5, CPUSeconds: 62.5, RSS: 20480 * 1024,
+		StartTime: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Unix(),
+		Name:      "App", Cmdline: "/Applications/App.app/Contents/MacOS/App --flag",
+	}
+	if p != want {
+		t.Fatalf("parsePsLine mismatch: got=%+v want=%+v", p, want)
+	}
+}
+
+func TestParseLsofFields(t *testing.T) {
+	raw := "p42\nf7\nPTCP\nn*:8080\nTST=LISTEN\nf9\nPTCP\nn10.0.0.1:8080->10.0.0.2:50000\nTST=ESTABLISHED\nf11\nPUDP\nn[::1]:5353\n"
+	got := parseLsofFields(raw)
+	if len(got) != 3 {
+		t.Fatalf("port count mismatch: got=%+v", got)
+	}
+	if got[0].LocalAddr != "*" || got[0].LocalPort != 8080 || got[0].State != "LISTEN" {
+		t.Fatalf("listen port mismatch: got=%+v", got[0])
+	}
+	if got[1].RemoteAddr != "10.0.0.2" || got[1].RemotePort != 50000 {
+		t.Fatalf("connection mismatch: got=%+v", got[1])
+	}
+	if got[2].Proto != "udp" || got[2].LocalAddr != "::1" || got[2].LocalPort != 5353 {
+		t.Fatalf("udp port mismatch: got=%+v", got[2])
+	}
+}
+
+func TestAPIProcessEndpoints(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("exercises the /proc implementation")
+	}
+	s := NewAPIServer("127.0.0.1", 20180, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	base := fmt.Sprintf("http://127.0.0.1:%d", s.Port())
+	client := &http.Client{Timeout: 8 * time.Second}
+
+	child := exec.Command("sleep", "30")
+	if err := child.Start(); err != nil {
+		t.Fatalf("start child failed: %v", err)
+	}
+	defer child.Process.Kill()
+
+	status, out := callRaw(t, client, http.MethodPost, base+"/ps", PsReq{Filter: "sleep 30"})
+	var ps PsResp
+	json.Unmarshal(out, &ps)
+	found := false
+	for _, p := range ps.Processes {
+		found = found || (p.PID == child.Process.Pid && p.PPID == os.Getpid() && p.Name == "sleep")
+	}
+	if status != http.StatusOK || !found {
+		t.Fatalf("/ps did not list child: status=%d body=%s", status, out)
+	}
+
+	status, out = callRaw(t, client, http.MethodPost, base+"/proc/inspect", ProcInspectReq{PID: os.Getpid()})
+	var inspect ProcInspectResp
+	json.Unmarshal(out, &inspect)
+	cwd, _ := os.Getwd()
+	hasAPIPort := false
+	for _, p := range inspect.Ports {
+		hasAPIPort = hasAPIPort || (p.Proto == "tcp" && p.LocalPort == s.Port() && p.State == "LISTEN")
+	}
+	if status != http.StatusOK || inspect.Cwd != cwd || len(inspect.Env) == 0 || !hasAPIPort {
+		t.Fatalf("/proc/inspect mismatch: status=%d body=%s", status, out)
+	}
+
+	status, out = callRaw(t, client, http.MethodPost, base+"/proc/signal", ProcSignalReq{PID: child.Process.Pid, Signal: "sigkill"})
+	if status != http.StatusOK {
+		t.Fatalf("/proc/signal failed: status=%d body=%s", status, out)
+	}
+	if err := child.Wait(); err == nil {
+		t.Fatalf("child should exit with a signal")
+	}
+
+	status, out = callRaw(t, client, http.MethodPost, base+"/proc/signal", ProcSignalReq{PID: os.Getpid()})
+	if status != http.StatusBadRequest {
+		t.Fatalf("signalling self should be refused: status=%d body=%s", status, out)
+	}
+}
+
+func TestProcessDescendants(t *testing.T) {
+	procs := []ProcessInfo{
+		{PID: 1, PPID: 0}, {PID: 10, PPID: 1}, {PID: 11, PPID: 10},
+		{PID: 12, PPID: 10}, {PID: 13, PPID: 11}, {PID: 20, PPID: 1},
+	}
+	got := processDescendants(procs, 10)
+	if !reflect.DeepEqual(got, []int{11, 12, 13}) {
+		t.Fatalf("descendants mismatch: got=%v", got)
+	}
+}
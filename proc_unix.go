@@ -0,0 +1,53 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+var unixSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+}
+
+func signalProcess(pid int, sig string) error {
+	num, ok := unixSignals[sig]
+	if !ok {
+		return &unsupportedSignalError{signal: sig}
+	}
+	if err := syscall.Kill(pid, num); err != nil {
+		if err == syscall.ESRCH {
+			return errProcessNotFound
+		}
+		return fmt.Errorf("kill %d SIG%s: %w", pid, sig, err)
+	}
+	return nil
+}
+
+// exitSignal reports the signal that terminated a process, if any.
+func exitSignal(state *os.ProcessState) (string, int) {
+	if state == nil {
+		return "", 0
+	}
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return "", 0
+	}
+	sig := ws.Signal()
+	for name, s := range unixSignals {
+		if s == sig {
+			return name, int(sig)
+		}
+	}
+	return sig.String(), int(sig)
+}
@@ -0,0 +1,149 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Win32_Process has no per-process user without a slow GetOwner call per row;
+// Get-Process -IncludeUserName is used instead and needs elevation, which the
+// receiver already requires on Windows.
+const windowsProcessScript = `$ErrorActionPreference='SilentlyContinue';` +
+	`$u=@{};Get-Process -IncludeUserName | ForEach-Object { $u[[int]$_.Id]=$_.UserName };` +
+	`$p=Get-CimInstance Win32_Process %s | ForEach-Object {[pscustomobject]@{` +
+	`pid=[int]$_.ProcessId;ppid=[int]$_.ParentProcessId;name=[string]$_.Name;cmdline=[string]$_.CommandLine;` +
+	`exe=[string]$_.ExecutablePath;rss=[int64]$_.WorkingSetSize;` +
+	`cpu=([double]$_.UserModeTime+[double]$_.KernelModeTime)/1e7;` +
+	`start=$(if($_.CreationDate){([DateTimeOffset]$_.CreationDate).ToUnixTimeSeconds()}else{0});` +
+	`user=[string]$u[[int]$_.ProcessId]}};` +
+	`ConvertTo-Json -Compress -InputObject @($p)`
+
+type windowsProcessRow struct {
+	PID     int     `json:"pid"`
+	PPID    int     `json:"ppid"`
+	Name    string  `json:"name"`
+	Cmdline string  `json:"cmdline"`
+	Exe     string  `json:"exe"`
+	RSS     int64   `json:"rss"`
+	CPU     float64 `json:"cpu"`
+	Start   int64   `json:"start"`
+	User    string  `json:"user"`
+}
+
+func runWindowsProcessQuery(ctx context.Context, filter string) ([]windowsProcessRow, error) {
+	script := fmt.Sprintf(windowsProcessScript, filter)
+	out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-Command", script).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Get-CimInstance Win32_Process failed: %v", err)
+	}
+	var rows []windowsProcessRow
+	if trimmed := strings.TrimSpace(string(out)); trimmed != "" {
+		if err := json.Unmarshal([]byte(trimmed), &rows); err != nil {
+			return nil, fmt.Errorf("parse process list failed: %v", err)
+		}
+	}
+	return rows, nil
+}
+
+func (row windowsProcessRow) info(now time.Time) ProcessInfo {
+	return ProcessInfo{
+		PID:        row.PID,
+		PPID:       row.PPID,
+		Name:       row.Name,
+		Cmdline:    row.Cmdline,
+		User:       row.User,
+		CPUSeconds: roundTo(row.CPU, 2),
+		CPUPercent: cpuPercentSince(row.CPU, row.Start, now),
+		RSS:        row.RSS,
+		StartTime:  row.Start,
+	}
+}
+
+func listProcesses(ctx context.Context) ([]ProcessInfo, error) {
+	rows, err := runWindowsProcessQuery(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]ProcessInfo, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.info(now))
+	}
+	return out, nil
+}
+
+type windowsPortRow struct {
+	Proto      string `json:"proto"`
+	LocalAddr  string `json:"local_addr"`
+	LocalPort  int    `json:"local_port"`
+	RemoteAddr string `json:"remote_addr"`
+	RemotePort int    `json:"remote_port"`
+	State      string `json:"state"`
+}
+
+const windowsPortsScript = `$ErrorActionPreference='SilentlyContinue';` +
+	`$t=Get-NetTCPConnection -OwningProcess %[1]d | ForEach-Object {[pscustomobject]@{proto='tcp';local_addr=[string]$_.LocalAddress;local_port=[int]$_.LocalPort;remote_addr=[string]$_.RemoteAddress;remote_port=[int]$_.RemotePort;state=[string]$_.State}};` +
+	`$u=Get-NetUDPEndpoint -OwningProcess %[1]d | ForEach-Object {[pscustomobject]@{proto='udp';local_addr=[string]$_.LocalAddress;local_port=[int]$_.LocalPort;remote_addr='';remote_port=0;state=''}};` +
+	`ConvertTo-Json -Compress -InputObject @(@($t)+@($u) | Where-Object {$_})`
+
+func inspectProcess(ctx context.Context, pid int) (ProcInspectResp, error) {
+	rows, err := runWindowsProcessQuery(ctx, fmt.Sprintf("-Filter 'ProcessId=%d'", pid))
+	if err != nil {
+		return ProcInspectResp{}, err
+	}
+	if len(rows) == 0 {
+		return ProcInspectResp{}, errProcessNotFound
+	}
+	resp := ProcInspectResp{ProcessInfo: rows[0].info(time.Now()), Exe: rows[0].Exe}
+	resp.Warnings = append(resp.Warnings, "cwd: not available on windows", "env: not available on windows")
+
+	out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-Command", fmt.Sprintf(windowsPortsScript, pid)).Output()
+	if err != nil {
+		resp.Warnings = append(resp.Warnings, "ports: "+err.Error())
+		return resp, nil
+	}
+	var ports []windowsPortRow
+	if trimmed := strings.TrimSpace(string(out)); trimmed != "" {
+		if err := json.Unmarshal([]byte(trimmed), &ports); err != nil {
+			resp.Warnings = append(resp.Warnings, "ports: "+err.Error())
+		}
+	}
+	for _, p := range ports {
+		port := ProcPort(p)
+		if port.RemotePort == 0 {
+			port.RemoteAddr = ""
+		}
+		resp.Ports = append(resp.Ports, port)
+	}
+	sortProcPorts(resp.Ports)
+	return resp, nil
+}
+
+// Windows has no signals; TERM, KILL and INT all terminate the process.
+func signalProcess(pid int, sig string) error {
+	switch sig {
+	case "TERM", "KILL", "INT":
+	default:
+		return &unsupportedSignalError{signal: sig}
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return errProcessNotFound
+	}
+	if err := proc.Kill(); err != nil {
+		return fmt.Errorf("terminate %d: %w", pid, err)
+	}
+	return nil
+}
+
+// Windows processes do not die from signals; the exit code says it all.
+func exitSignal(state *os.ProcessState) (string, int) {
+	return "", 0
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// config.toml holds named profiles of defaults for connect and serve:
+//
+//	default_profile = "team"
+//	peer_list_url = "https://example.com/telehand/peers.json"
+//	peer_list_keys = ["<base64 ed25519 public key>"]
+//
+//	[profiles.team]
+//	peers = ["tcp://relay.example.com:11010"]
+//	permissions = "read,exec"
+//	ttl = "2h"
+//	install_mirror = "https://mirror.example.com/"
+//
+// Only the TOML this needs is understood: top-level keys, [profiles.<name>]
+// tables, strings, booleans, integers and arrays of strings.
+const telehandConfigFile = "config.toml"
+
+// Environment variables between flags and profile in precedence.
+const (
+	envProfile       = "TELEHAND_PROFILE"
+	envNetworkName   = "TELEHAND_NETWORK_NAME"
+	envNetworkSecret = "TELEHAND_NETWORK_SECRET"
+	envPeers         = "TELEHAND_PEERS"
+)
+
+// Profile is one [profiles.<name>] table.
+type Profile struct {
+	Name          string
+	NetworkName   string
+	NetworkSecret string
+	// Peers is comma-separated, like --peers.
+	Peers   string
+	Install installSettings
+	// Flags are defaults for command-line flags, keyed by flag name.
+	Flags map[string]string
+}
+
+type telehandFileConfig struct {
+	Path           string
+	DefaultProfile string
+	// PeerListURL and PeerListKeys locate and authenticate the signed
+	// default peer list (see peer_list.go).
+	PeerListURL  string
+	PeerListKeys []string
+	Profiles     map[string]*Profile
+}
+
+// profileFlagKeys maps profile keys to the flags they default. Keys for a
+// flag a command does not have are ignored by that command.
+var profileFlagKeys = map[string]string{
+	"ttl":         "ttl",
+	"permissions": "permissions",
+	"api_token":   "api-token",
+	"once":        "once",
+	"short":       "short",
+	"qr":          "qr",
+	"no_browser":  "no-browser",
+}
+
+func telehandConfigPath() (string, error) {
+	dir, err := telehandConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, telehandConfigFile), nil
+}
+
+// loadTelehandConfig reads config.toml; a missing file is an empty config.
+func loadTelehandConfig() (*telehandFileConfig, error) {
+	path, err := telehandConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &telehandFileConfig{Path: path, Profiles: map[string]*Profile{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseTelehandConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.Path = path
+	return cfg, nil
+}
+
+// selectProfile picks the profile named by --profile, then TELEHAND_PROFILE,
+// then default_profile. No name at all means no profile; a name that does
+// not exist is an error.
+func selectProfile(flagName string) (*Profile, error) {
+	name := strings.TrimSpace(flagName)
+	if name == "" {
+		name = strings.TrimSpace(os.Getenv(envProfile))
+	}
+	cfg, err := loadTelehandConfig()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = cfg.DefaultProfile
+	}
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(cfg.Profiles))
+		for n := range cfg.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("profile %q not found: %s has no profiles", name, cfg.Path)
+		}
+		return nil, fmt.Errorf("profile %q not found in %s (have %s)", name, cfg.Path, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// applyFlagDefaults sets the profile's flag defaults on fs for every flag
+// the command line did not set itself.
+func (p *Profile) applyFlagDefaults(fs *flag.FlagSet) error {
+	if p == nil {
+		return nil
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	names := make([]string, 0, len(p.Flags))
+	for name := range p.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if explicit[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, p.Flags[name]); err != nil {
+			return fmt.Errorf("profile %s: %s: %w", p.Name, name, err)
+		}
+	}
+	return nil
+}
+
+// appliesBesides reports whether p still changes anything once the flags
+// in ignored are out of play: install settings, or a default for another
+// flag of fs that the command line did not set. Call it before
+// applyFlagDefaults.
+func (p *Profile) appliesBesides(fs *flag.FlagSet, ignored ...string) bool {
+	if p == nil {
+		return false
+	}
+	in := p.Install
+	if in.Mirror != "" || in.ScriptBase != "" || in.ReleaseBase != "" || in.Version != "" ||
+		in.OfflineDir != "" || len(in.Variants) > 0 || len(in.Templates) > 0 {
+		return true
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for name := range p.Flags {
+		if !explicit[name] && fs.Lookup(name) != nil && !containsString(ignored, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTelehandConfig(data []byte) (*telehandFileConfig, error) {
+	cfg := &telehandFileConfig{Profiles: map[string]*Profile{}}
+	var profile *Profile
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripTOMLComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("%d: %s", lineNo, fmt.Sprintf(format, args...))
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fail("unsupported table header %s", line)
+			}
+			header := strings.TrimSpace(line[1 : len(line)-1])
+			rest, ok := strings.CutPrefix(header, "profiles.")
+			if !ok {
+				return nil, fail("unknown table [%s] (want [profiles.<name>])", header)
+			}
+			name := strings.TrimSpace(rest)
+			if unq, err := strconv.Unquote(name); err == nil {
+				name = unq
+			}
+			if name == "" {
+				return nil, fail("empty profile name")
+			}
+			if _, dup := cfg.Profiles[name]; dup {
+				return nil, fail("duplicate profile %q", name)
+			}
+			profile = &Profile{Name: name, Flags: map[string]string{}}
+			cfg.Profiles[name] = profile
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fail("expected key = value")
+		}
+		key = strings.TrimSpace(key)
+		raw = strings.TrimSpace(raw)
+		// Arrays may continue over several lines.
+		for strings.HasPrefix(raw, "[") && !tomlArrayClosed(raw) && sc.Scan() {
+			lineNo++
+			raw += " " + strings.TrimSpace(stripTOMLComment(sc.Text()))
+		}
+		value, err := parseTOMLValue(raw)
+		if err != nil {
+			return nil, fail("%s: %v", key, err)
+		}
+
+		if profile == nil {
+			switch key {
+			case "default_profile", "peer_list_url":
+				s, ok := value.(string)
+				if !ok {
+					return nil, fail("%s must be a string", key)
+				}
+				if key == "default_profile" {
+					cfg.DefaultProfile = s
+				} else {
+					cfg.PeerListURL = s
+				}
+			case "peer_list_keys":
+				switch v := value.(type) {
+				case string:
+					cfg.PeerListKeys = strings.Split(v, ",")
+				case []string:
+					cfg.PeerListKeys = v
+				default:
+					return nil, fail("peer_list_keys must be strings")
+				}
+				for _, k := range cfg.PeerListKeys {
+					if _, err := parsePeerListKey(k); err != nil {
+						return nil, fail("%v", err)
+					}
+				}
+			default:
+				return nil, fail("unknown top-level key %q", key)
+			}
+			continue
+		}
+		if err := profile.set(key, value); err != nil {
+			return nil, fail("%v", err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, p := range cfg.Profiles {
+		if p.Install.OfflineDir != "" {
+			continue
+		}
+		for _, v := range p.Install.Variants {
+			if strings.HasPrefix(v, "offline-") {
+				return nil, fmt.Errorf("profile %s: install variant %s needs install_offline_dir", p.Name, v)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+func (p *Profile) set(key string, value any) error {
+	if key == "install_templates" {
+		// Kept apart: templates are free-form and may contain commas.
+		entries, ok := value.([]string)
+		if !ok {
+			return fmt.Errorf("%s: want an array of strings", key)
+		}
+		for _, e := range entries {
+			t, err := parseInstallTemplate(e)
+			if err != nil {
+				return err
+			}
+			p.Install.Templates = append(p.Install.Templates, t)
+		}
+		return nil
+	}
+	str := func() (string, error) {
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case []string:
+			return strings.Join(v, ","), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		}
+		return "", fmt.Errorf("%s: unsupported value", key)
+	}
+	s, err := str()
+	if err != nil {
+		return err
+	}
+	switch key {
+	case "network_name":
+		p.NetworkName = s
+	case "network_secret":
+		p.NetworkSecret = s
+	case "peers":
+		p.Peers = s
+	case "install_mirror":
+		p.Install.Mirror = s
+	case "install_script_base":
+		p.Install.ScriptBase = s
+	case "install_release_base":
+		p.Install.ReleaseBase = s
+	case "install_version":
+		p.Install.Version = normalizeReleaseTag(s)
+	case "install_offline_dir":
+		p.Install.OfflineDir = s
+	case "install_variants":
+		for _, name := range strings.Split(s, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := lookupInstallVariant(name); !ok {
+				return fmt.Errorf("unknown install variant %q (want %s)", name, strings.Join(installVariantNames(), ", "))
+			}
+			p.Install.Variants = append(p.Install.Variants, name)
+		}
+	default:
+		name, ok := profileFlagKeys[key]
+		if !ok {
+			return fmt.Errorf("unknown profile key %q", key)
+		}
+		p.Flags[name] = s
+	}
+	return nil
+}
+
+// stripTOMLComment drops a trailing # comment that is not inside a string.
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func tomlArrayClosed(raw string) bool {
+	return strings.HasSuffix(strings.TrimSpace(raw), "]")
+}
+
+func parseTOMLValue(raw string) (any, error) {
+	switch {
+	case raw == "":
+		return nil, errors.New("missing value")
+	case raw == "true":
+		return true, nil
+	case raw == "false":
+		return false, nil
+	case raw[0] == '"' || raw[0] == '\'':
+		s, rest, err := parseTOMLString(raw)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after string", rest)
+		}
+		return s, nil
+	case raw[0] == '[':
+		return parseTOMLStringArray(raw)
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(raw, "_", ""), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value %s (quote strings)", raw)
+	}
+	return n, nil
+}
+
+// parseTOMLString reads one basic ("...") or literal ('...') string from the
+// start of raw and returns what follows it.
+func parseTOMLString(raw string) (string, string, error) {
+	if raw[0] == '\'' {
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", "", errors.New("unterminated string")
+		}
+		return raw[1 : end+1], raw[end+2:], nil
+	}
+	for i := 1; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '"':
+			s, err := strconv.Unquote(raw[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string: %v", err)
+			}
+			return s, raw[i+1:], nil
+		}
+	}
+	return "", "", errors.New("unterminated string")
+}
+
+func parseTOMLStringArray(raw string) ([]string, error) {
+	rest := strings.TrimSpace(raw[1:])
+	out := []string{}
+	for {
+		if strings.HasPrefix(rest, "]") {
+			if strings.TrimSpace(rest[1:]) != "" {
+				return nil, fmt.Errorf("unexpected %q after array", rest[1:])
+			}
+			return out, nil
+		}
+		if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+			return nil, errors.New("arrays may only hold strings")
+		}
+		s, after, err := parseTOMLString(rest)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+		rest = strings.TrimSpace(after)
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") {
+			return nil, errors.New("expected , or ] in array")
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleTelehandConfig = `
+# team defaults
+default_profile = "team"
+
+[profiles.team]
+network_name = "telehand:support"   # shared name
+peers = [
+  "tcp://relay-a.example.com:11010",
+  'udp://relay-b.example.com:11010', # backup
+]
+permissions = "read,exec"
+ttl = "2h"
+once = true
+install_mirror = "https://mirror.example.com/"
+
+[profiles."lab #2"]
+peers = "tcp://10.0.0.1:11010"
+no_browser = true
+`
+
+func TestParseTelehandConfig(t *testing.T) {
+	cfg, err := parseTelehandConfig([]byte(sampleTelehandConfig))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.DefaultProfile != "team" || len(cfg.Profiles) != 2 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	team := cfg.Profiles["team"]
+	if team.NetworkName != "telehand:support" ||
+		team.Peers != "tcp://relay-a.example.com:11010,udp://relay-b.example.com:11010" ||
+		team.Install.Mirror != "https://mirror.example.com/" {
+		t.Fatalf("unexpected team profile: %+v", team)
+	}
+	wantFlags := map[string]string{"permissions": "read,exec", "ttl": "2h", "once": "true"}
+	if !reflect.DeepEqual(team.Flags, wantFlags) {
+		t.Fatalf("flags = %v, want %v", team.Flags, wantFlags)
+	}
+	if lab := cfg.Profiles["lab #2"]; lab == nil || lab.Flags["no-browser"] != "true" {
+		t.Fatalf("unexpected lab profile: %+v", lab)
+	}
+}
+
+func TestParseTelehandConfigErrors(t *testing.T) {
+	cases := map[string]string{
+		"[profiles.a]\nnetwork_nmae = \"x\"\n": "2: unknown profile key",
+		"colour = \"blue\"\n":                  "1: unknown top-level key",
+		"[servers.a]\n":                        "1: unknown table",
+		"[profiles.a]\npeers = [1, 2]\n":       "2: peers: arrays may only hold strings",
+		"[profiles.a]\nttl = 2h\n":             "2: ttl: unsupported value",
+		"[profiles.a]\n[profiles.a]\n":         "2: duplicate profile",
+	}
+	for input, want := range cases {
+		_, err := parseTelehandConfig([]byte(input))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: got %v, want error containing %q", input, err, want)
+		}
+	}
+}
+
+func TestSelectProfilePrecedence(t *testing.T) {
+	dir := withTempConfigDir(t)
+	t.Setenv(envProfile, "")
+	if p, err := selectProfile(""); err != nil || p != nil {
+		t.Fatalf("no config: got %v, %v", p, err)
+	}
+
+	mustWriteFile(t, filepath.Join(dir, telehandConfigFile), sampleTelehandConfig)
+	if p, err := selectProfile(""); err != nil || p.Name != "team" {
+		t.Fatalf("default_profile: got %v, %v", p, err)
+	}
+	t.Setenv(envProfile, "lab #2")
+	if p, err := selectProfile(""); err != nil || p.Name != "lab #2" {
+		t.Fatalf("env: got %v, %v", p, err)
+	}
+	if p, err := selectProfile("team"); err != nil || p.Name != "team" {
+		t.Fatalf("flag: got %v, %v", p, err)
+	}
+	if _, err := selectProfile("missing"); err == nil || !strings.Contains(err.Error(), "have lab #2, team") {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+}
+
+func TestProfileFlagDefaultsYieldToFlags(t *testing.T) {
+	fs := flag.NewFlagSet("connect", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	ttl := fs.Duration("ttl", 0, "")
+	perms := fs.String("permissions", "", "")
+	once := fs.Bool("once", false, "")
+	if err := fs.Parse([]string{"--permissions", "read"}); err != nil {
+		t.Fatal(err)
+	}
+	p := &Profile{Name: "team", Flags: map[string]string{"ttl": "2h", "permissions": "read,exec", "once": "true", "no-browser": "true"}}
+	if err := p.applyFlagDefaults(fs); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if *ttl != 2*time.Hour || *perms != "read" || !*once {
+		t.Fatalf("got ttl=%v permissions=%q once=%v", *ttl, *perms, *once)
+	}
+
+	bad := &Profile{Name: "team", Flags: map[string]string{"ttl": "soon"}}
+	if err := bad.applyFlagDefaults(fs); err != nil {
+		t.Fatalf("explicitly set flags must not be touched, got %v", err)
+	}
+	fs = flag.NewFlagSet("connect", flag.ContinueOnError)
+	fs.Duration("ttl", 0, "")
+	if err := bad.applyFlagDefaults(fs); err == nil || !strings.Contains(err.Error(), "profile team: ttl") {
+		t.Fatalf("expected invalid ttl error, got %v", err)
+	}
+}
+
+func TestProfileAppliesBesides(t *testing.T) {
+	newFS := func(args ...string) *flag.FlagSet {
+		fs := flag.NewFlagSet("connect", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Duration("ttl", 0, "")
+		fs.Bool("no-browser", false, "")
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	}
+	mint := &Profile{Name: "team", NetworkName: "team-net", Peers: "tcp://1.2.3.4:11010", Flags: map[string]string{"ttl": "2h"}}
+	if mint.appliesBesides(newFS(), "ttl") {
+		t.Fatal("a profile of only minting defaults should not apply")
+	}
+	session := &Profile{Name: "team", Flags: map[string]string{"ttl": "2h", "no-browser": "true"}}
+	if !session.appliesBesides(newFS(), "ttl") {
+		t.Fatal("no-browser default should apply")
+	}
+	if session.appliesBesides(newFS("--no-browser"), "ttl") {
+		t.Fatal("a flag the user set is not the profile's doing")
+	}
+	install := &Profile{Name: "team", Install: installSettings{Version: "v0.4.0"}}
+	if !install.appliesBesides(newFS(), "ttl") {
+		t.Fatal("install settings should apply")
+	}
+	var none *Profile
+	if none.appliesBesides(newFS()) {
+		t.Fatal("nil profile applies nothing")
+	}
+}
+
+func TestWithDefaultNetworkInputsPrecedence(t *testing.T) {
+	orig := hostnameReader
+	hostnameReader = func() (string, error) { return "my-host", nil }
+	t.Cleanup(func() { hostnameReader = orig })
+	t.Setenv(envNetworkName, "")
+	t.Setenv(envNetworkSecret, "")
+	t.Setenv(envPeers, "")
+
+	profile := &Profile{NetworkName: "from-profile", NetworkSecret: "profile-secret", Peers: "tcp://10.0.0.1:11010"}
+	name, secret, peers := withDefaultNetworkInputs("", "", "", profile)
+	if name != "from-profile" || secret != "profile-secret" || parsePeers(peers)[0] != "tcp://10.0.0.1:11010" {
+		t.Fatalf("profile layer: %q %q %q", name, secret, peers)
+	}
+
+	t.Setenv(envNetworkName, "from-env")
+	t.Setenv(envPeers, "tcp://10.0.0.2:11010")
+	name, secret, peers = withDefaultNetworkInputs("", "", "", profile)
+	if name != "from-env" || secret != "profile-secret" || parsePeers(peers)[0] != "tcp://10.0.0.2:11010" {
+		t.Fatalf("env layer: %q %q %q", name, secret, peers)
+	}
+
+	name, _, peers = withDefaultNetworkInputs("from-flag", "", "tcp://10.0.0.3:11010", profile)
+	if name != "from-flag" || parsePeers(peers)[0] != "tcp://10.0.0.3:11010" {
+		t.Fatalf("flag layer: %q %q", name, peers)
+	}
+	if pool := parsePeers(peers); !containsString(pool, defaultPeerPool()[0]) {
+		t.Fatalf("default pool should still be merged in: %v", pool)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQRReedSolomonKnownVector(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the worked example in the QR literature.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := qrRSRemainder(data, qrRSDivisor(10)); !bytes.Equal(got, want) {
+		t.Fatalf("ecc = %v, want %v", got, want)
+	}
+}
+
+func TestQRFormatAndVersionInfo(t *testing.T) {
+	cases := []struct {
+		level qrECLevel
+		mask  int
+		want  int
+	}{
+		{qrLevelL, 0, 0b111011111000100},
+		{qrLevelL, 7, 0b110100101110110},
+		{qrLevelM, 0, 0b101010000010010},
+		{qrLevelM, 5, 0b100000011001110},
+	}
+	for _, c := range cases {
+		if got := qrFormatInfo(c.level, c.mask); got != c.want {
+			t.Fatalf("format(%d,%d) = %015b, want %015b", c.level, c.mask, got, c.want)
+		}
+	}
+	if got := qrVersionInfo(7); got != 0b000111110010010100 {
+		t.Fatalf("version info 7 = %018b", got)
+	}
+}
+
+func TestQRAlignmentPositions(t *testing.T) {
+	cases := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		14: {6, 26, 46, 66},
+		32: {6, 34, 60, 86, 112, 138},
+		36: {6, 24, 50, 76, 102, 128, 154},
+	}
+	for v, want := range cases {
+		if got := newQRMatrix(v).alignmentPositions(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("version %d: got %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestQRDataCapacity(t *testing.T) {
+	// Byte-mode capacities from the standard's tables.
+	cases := []struct {
+		version int
+		level   qrECLevel
+		bytes   int
+	}{
+		{1, qrLevelL, 17}, {1, qrLevelM, 14}, {10, qrLevelM, 213}, {40, qrLevelL, 2953},
+	}
+	for _, c := range cases {
+		if qrDataBits(make([]byte, c.bytes), c.version) > qrDataCodewords(c.version, c.level)*8 {
+			t.Fatalf("%d bytes should fit version %d level %d", c.bytes, c.version, c.level)
+		}
+		if qrDataBits(make([]byte, c.bytes+1), c.version) <= qrDataCodewords(c.version, c.level)*8 {
+			t.Fatalf("%d bytes should not fit version %d level %d", c.bytes+1, c.version, c.level)
+		}
+	}
+}
+
+func TestQRReadBack(t *testing.T) {
+	texts := []string{
+		"TH-ABCD-EFGH-JKMN",
+		strings.Repeat("eyJuZXR3b3JrX25hbWUiOiJ0ZWxlaGFuZDp0ZXN0In0=", 12),
+	}
+	for _, text := range texts {
+		for _, level := range []qrECLevel{qrLevelL, qrLevelM} {
+			code, err := encodeQR(text, level)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if code.Size != code.Version*4+17 || len(code.Modules) != code.Size {
+				t.Fatalf("bad size %d for version %d", code.Size, code.Version)
+			}
+			got := qrReadBack(t, code, level)
+			if !bytes.Equal(got, []byte(text)) {
+				t.Fatalf("read back %q, want %q", got, text)
+			}
+		}
+	}
+}
+
+// qrReadBack decodes code the way a scanner would after locating it:
+// format bits, unmask, zigzag read, de-interleave and parse the segment.
+func qrReadBack(t *testing.T, code *QRCode, level qrECLevel) []byte {
+	t.Helper()
+	q := newQRMatrix(code.Version)
+	q.drawFunctionPatterns(level)
+
+	var format int
+	for i := 0; i <= 5; i++ {
+		if code.Modules[i][8] {
+			format |= 1 << i
+		}
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if qrFormatInfo(level, m)&0x3f == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("format bits %06b match no mask", format)
+	}
+	q.modules = code.Modules
+	q.applyMask(mask)
+	defer q.applyMask(mask)
+
+	var raw []byte
+	var cur byte
+	n := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if q.isFunction[y][x] {
+					continue
+				}
+				cur <<= 1
+				if q.modules[y][x] {
+					cur |= 1
+				}
+				if n++; n%8 == 0 {
+					raw = append(raw, cur)
+				}
+			}
+		}
+	}
+
+	numBlocks := qrECCBlocks[level][code.Version]
+	eccLen := qrECCPerBlock[level][code.Version]
+	total := qrRawModules(code.Version) / 8
+	numShort := numBlocks - total%numBlocks
+	shortData := total/numBlocks - eccLen
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortData; i++ {
+		for b := range blocks {
+			if i < shortData || b >= numShort {
+				blocks[b] = append(blocks[b], raw[k])
+				k++
+			}
+		}
+	}
+	var data []byte
+	for b, blk := range blocks {
+		data = append(data, blk...)
+		ecc := make([]byte, eccLen)
+		for i := range ecc {
+			ecc[i] = raw[k+i*numBlocks+b]
+		}
+		if want := qrRSRemainder(blk, qrRSDivisor(eccLen)); !bytes.Equal(ecc, want) {
+			t.Fatalf("block %d ecc mismatch", b)
+		}
+	}
+
+	if data[0]>>4 != 0x4 {
+		t.Fatalf("mode %x, want byte mode", data[0]>>4)
+	}
+	bits := qrCountBits(code.Version)
+	readBits := func(off, width int) int {
+		v := 0
+		for i := off; i < off+width; i++ {
+			v = v<<1 | int(data[i/8]>>(7-i%8)&1)
+		}
+		return v
+	}
+	count := readBits(4, bits)
+	out := make([]byte, count)
+	for i := range out {
+		out[i] = byte(readBits(4+bits+8*i, 8))
+	}
+	return out
+}
+
+func TestQRTooLong(t *testing.T) {
+	if _, err := encodeQR(strings.Repeat("x", 2954), qrLevelL); err != errQRTooLong {
+		t.Fatalf("err = %v, want errQRTooLong", err)
+	}
+}
+
+func TestQRTerminalString(t *testing.T) {
+	code, err := encodeQR("TH-ABCD", qrLevelM)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(code.TerminalString(), "\n"), "\n")
+	total := code.Size + 2*qrTerminalQuietZone
+	if len(lines) != (total+1)/2 {
+		t.Fatalf("got %d lines, want %d", len(lines), (total+1)/2)
+	}
+	for _, l := range lines {
+		if n := len([]rune(l)); n != total {
+			t.Fatalf("line width %d, want %d", n, total)
+		}
+	}
+	// First line is all quiet zone: light on top and bottom.
+	if strings.Trim(lines[0], "█") != "" {
+		t.Fatalf("quiet zone not light: %q", lines[0])
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Relay mode runs the embedded easytier-core as a public node: no TUN, no
+// network of its own to speak of, it just forwards for whatever networks
+// connect to it (optionally limited by a whitelist). Teams point --peers
+// at it instead of the public DefaultPeers.
+
+var defaultRelayListeners = []string{"tcp://0.0.0.0:11010", "udp://0.0.0.0:11010"}
+
+const (
+	defaultRelayHTTP     = "127.0.0.1:11090"
+	relayPollInterval    = 10 * time.Second
+	relayFirstPollDelay  = 2 * time.Second
+	relayMaxRestartDelay = 30 * time.Second
+	relayStableAfter     = time.Minute
+	relayStatusStarting  = "starting"
+	relayStatusOK        = "ok"
+	relayStatusDown      = "down"
+	relayStatusStopping  = "stopping"
+)
+
+type relayOptions struct {
+	Listeners     []string
+	PublicHost    string
+	NetworkName   string
+	NetworkSecret string
+	// Whitelist is passed to --relay-network-whitelist; "*" relays any
+	// network, "telehand:*" only telehand's default naming.
+	Whitelist string
+	Peers     []string
+}
+
+// RelayHealth is served on the relay's local /health endpoint.
+type RelayHealth struct {
+	Status    string   `json:"status"`
+	Version   string   `json:"version"`
+	StartedAt string   `json:"started_at"`
+	UptimeSec int64    `json:"uptime_sec"`
+	Restarts  int      `json:"restarts"`
+	Listeners []string `json:"listeners"`
+	PeerURLs  []string `json:"peer_urls"`
+	// Networks counts networks currently relayed and NetworkPeers the
+	// nodes connected across them; RelayPeers are peers in the relay's own
+	// network (other relays joined with --peers).
+	Networks     int    `json:"networks"`
+	NetworkPeers int    `json:"network_peers"`
+	RelayPeers   int    `json:"relay_peers"`
+	UpdatedAt    string `json:"updated_at,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type RelayNetwork struct {
+	Name  string `json:"name"`
+	Peers int    `json:"peers"`
+}
+
+// relayArgs builds the easytier-core command line for a relay node.
+func relayArgs(opts relayOptions, rpcPort string) []string {
+	args := []string{
+		"--no-tun",
+		"--network-name", opts.NetworkName,
+		"--network-secret", opts.NetworkSecret,
+		"-r", fmt.Sprintf("127.0.0.1:%s", rpcPort),
+	}
+	for _, l := range opts.Listeners {
+		args = append(args, "-l", l)
+	}
+	if w := strings.TrimSpace(opts.Whitelist); w != "" {
+		args = append(args, "--relay-network-whitelist", w)
+	}
+	for _, p := range opts.Peers {
+		args = append(args, "--peers", p)
+	}
+	return args
+}
+
+// normalizeRelayListener checks a listener URL such as tcp://0.0.0.0:11010.
+// Relays need a fixed port, since clients are given it ahead of time.
+func normalizeRelayListener(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid listener %q (want scheme://host:port)", raw)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if _, ok := peerSchemes[scheme]; !ok {
+		return "", fmt.Errorf("listener %q: unsupported scheme (want one of %s)", raw, strings.Join(peerSchemeNames(), ", "))
+	}
+	_, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return "", fmt.Errorf("listener %q: %v", raw, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return "", fmt.Errorf("listener %q: port must be 1-65535", raw)
+	}
+	u.Scheme = scheme
+	return u.String(), nil
+}
+
+// relayPeerURLs turns listeners into the addresses clients should use:
+// wildcard hosts become publicHost, specific addresses are kept.
+func relayPeerURLs(listeners []string, publicHost string) []string {
+	var out []string
+	for _, l := range listeners {
+		u, err := url.Parse(l)
+		if err != nil {
+			continue
+		}
+		host, port, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			host = publicHost
+		}
+		u.Host = net.JoinHostPort(host, port)
+		out = append(out, u.String())
+	}
+	return out
+}
+
+// detectOutboundIPv4 is the address this machine uses to reach the
+// internet. Dialing UDP sends nothing; behind NAT it is a private address.
+func detectOutboundIPv4() string {
+	conn, err := net.Dial("udp4", "1.1.1.1:53")
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// parseForeignNetworks reads `easytier-cli -o json foreign-network`: the
+// networks this node relays for, keyed by network name.
+func parseForeignNetworks(out []byte) ([]RelayNetwork, error) {
+	var resp struct {
+		ForeignNetworks map[string]struct {
+			Peers []json.RawMessage `json:"peers"`
+		} `json:"foreign_networks"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("invalid foreign network json: %v", err)
+	}
+	nets := make([]RelayNetwork, 0, len(resp.ForeignNetworks))
+	for name, entry := range resp.ForeignNetworks {
+		nets = append(nets, RelayNetwork{Name: name, Peers: len(entry.Peers)})
+	}
+	sort.Slice(nets, func(i, j int) bool { return nets[i].Name < nets[j].Name })
+	return nets, nil
+}
+
+func (et *EasyTier) queryForeignNetworks() ([]RelayNetwork, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultEasyTierCLIQueryTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, et.cliBin, "-p", fmt.Sprintf("127.0.0.1:%s", et.rpcPort), "-o", "json", "foreign-network")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("easytier-cli timed out")
+		}
+		return nil, fmt.Errorf("easytier-cli error: %v, output=%s", err, strings.TrimSpace(string(out)))
+	}
+	return parseForeignNetworks(out)
+}
+
+// relayServer supervises one easytier-core relay and keeps the stats the
+// health endpoint serves.
+type relayServer struct {
+	opts     relayOptions
+	peerURLs []string
+	onLog    func(string)
+
+	mu       sync.Mutex
+	health   RelayHealth
+	networks []RelayNetwork
+	started  time.Time
+}
+
+func newRelayServer(opts relayOptions, onLog func(string)) *relayServer {
+	r := &relayServer{
+		opts:     opts,
+		peerURLs: relayPeerURLs(opts.Listeners, opts.PublicHost),
+		onLog:    onLog,
+		started:  time.Now(),
+	}
+	r.health = RelayHealth{
+		Status:    relayStatusStarting,
+		Version:   telehandVersion,
+		StartedAt: r.started.Format(time.RFC3339),
+		Listeners: opts.Listeners,
+		PeerURLs:  r.peerURLs,
+	}
+	return r
+}
+
+func (r *relayServer) snapshot() (RelayHealth, []RelayNetwork) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.health
+	h.UptimeSec = int64(time.Since(r.started).Seconds())
+	nets := append([]RelayNetwork{}, r.networks...)
+	return h, nets
+}
+
+func (r *relayServer) update(fn func(h *RelayHealth)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(&r.health)
+}
+
+// poll refreshes the stats from easytier-cli. Node info doubles as the
+// liveness check; the network counts are best effort.
+func (r *relayServer) poll(et *EasyTier) {
+	if _, err := et.queryNodeInfo(); err != nil {
+		r.update(func(h *RelayHealth) { h.Status, h.Error = relayStatusStarting, err.Error() })
+		return
+	}
+	nets, netErr := et.queryForeignNetworks()
+	raw, peerErr := et.queryRawPeerList()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := &r.health
+	h.Status, h.Error = relayStatusOK, ""
+	h.UpdatedAt = time.Now().Format(time.RFC3339)
+	if netErr == nil {
+		r.networks = nets
+		h.Networks, h.NetworkPeers = len(nets), 0
+		for _, n := range nets {
+			h.NetworkPeers += n.Peers
+		}
+	} else {
+		h.Error = netErr.Error()
+	}
+	if peerErr == nil {
+		h.RelayPeers = 0
+		for _, p := range raw {
+			if p.Cost != "Local" {
+				h.RelayPeers++
+			}
+		}
+	} else if h.Error == "" {
+		h.Error = peerErr.Error()
+	}
+}
+
+func (r *relayServer) handleHealth(w http.ResponseWriter, req *http.Request) {
+	h, _ := r.snapshot()
+	status := http.StatusOK
+	if h.Status != relayStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	jsonResp(w, status, h)
+}
+
+func (r *relayServer) handleNetworks(w http.ResponseWriter, req *http.Request) {
+	_, nets := r.snapshot()
+	jsonResp(w, http.StatusOK, nets)
+}
+
+func (r *relayServer) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", r.handleHealth)
+	mux.HandleFunc("/networks", r.handleNetworks)
+	return mux
+}
+
+// startNode launches one easytier-core; the returned channel yields its
+// exit. The relay owns Wait, so it stops nodes with stopNode rather than
+// EasyTier.Stop.
+func (r *relayServer) startNode() (*EasyTier, <-chan error, error) {
+	et := NewEasyTier(r.onLog)
+	corePath, err := et.prepareBinaries()
+	if err == nil {
+		err = et.launch(corePath, relayArgs(r.opts, et.rpcPort))
+	}
+	if err != nil {
+		if et.tmpDir != "" {
+			os.RemoveAll(et.tmpDir)
+		}
+		return nil, nil, err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- et.wait() }()
+	return et, exited, nil
+}
+
+func stopNode(et *EasyTier, exited <-chan error) {
+	if et.cmd != nil && et.cmd.Process != nil {
+		et.cmd.Process.Kill()
+		<-exited
+	}
+	os.RemoveAll(et.tmpDir)
+}
+
+// run keeps a relay node up until stop fires, restarting easytier-core
+// with backoff when it dies. Failing to start the very first node is
+// returned as an error; later failures are retried.
+func (r *relayServer) run(stop <-chan struct{}) error {
+	delay := time.Second
+	first := true
+	for {
+		et, exited, err := r.startNode()
+		if err != nil {
+			if first {
+				return err
+			}
+			r.update(func(h *RelayHealth) { h.Status, h.Error = relayStatusDown, err.Error() })
+		}
+		first = false
+
+		if err == nil {
+			upAt := time.Now()
+			timer := time.NewTimer(relayFirstPollDelay)
+		watch:
+			for {
+				select {
+				case <-stop:
+					timer.Stop()
+					r.update(func(h *RelayHealth) { h.Status = relayStatusStopping })
+					stopNode(et, exited)
+					return nil
+				case exitErr := <-exited:
+					timer.Stop()
+					os.RemoveAll(et.tmpDir)
+					msg := "easytier-core exited"
+					if exitErr != nil {
+						msg = fmt.Sprintf("easytier-core exited: %v", exitErr)
+					}
+					r.logf("[telehand] %s", msg)
+					r.update(func(h *RelayHealth) { h.Status, h.Error = relayStatusDown, msg })
+					break watch
+				case <-timer.C:
+					r.poll(et)
+					timer.Reset(relayPollInterval)
+				}
+			}
+			if time.Since(upAt) > relayStableAfter {
+				delay = time.Second
+			}
+		}
+
+		r.logf("[telehand] restarting relay in %s", delay)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > relayMaxRestartDelay {
+			delay = relayMaxRestartDelay
+		}
+		r.update(func(h *RelayHealth) { h.Restarts++ })
+	}
+}
+
+func (r *relayServer) logf(format string, args ...any) {
+	if r.onLog != nil {
+		r.onLog(fmt.Sprintf(format, args...))
+	}
+}
+
+// systemdUnit renders a unit that runs `telehand relay args...` as a
+// service; systemd restarts telehand itself if it ever exits.
+func systemdUnit(exe string, args []string) string {
+	quoted := make([]string, 0, len(args)+2)
+	for _, a := range append([]string{exe, "relay"}, args...) {
+		if a == "" || strings.ContainsAny(a, " \t\"'\\$%;") {
+			a = strconv.Quote(a)
+		}
+		// systemd expands % specifiers and $VARS even inside quotes.
+		quoted = append(quoted, strings.NewReplacer("%", "%%", "$", "$$").Replace(a))
+	}
+	return fmt.Sprintf(`[Unit]
+Description=Telehand relay (EasyTier public node)
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=%s
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, strings.Join(quoted, " "))
+}
+
+var errRelayNoPublicHost = errors.New("cannot detect a public address; pass --public-host")
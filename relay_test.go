@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRelayListener(t *testing.T) {
+	ok := map[string]string{
+		"tcp://0.0.0.0:11010":        "tcp://0.0.0.0:11010",
+		" UDP://[::]:11010 ":         "udp://[::]:11010",
+		"wss://0.0.0.0:443/telehand": "wss://0.0.0.0:443/telehand",
+		"wg://203.0.113.7:11011":     "wg://203.0.113.7:11011",
+	}
+	for in, want := range ok {
+		got, err := normalizeRelayListener(in)
+		if err != nil || got != want {
+			t.Fatalf("%q: got %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"0.0.0.0:11010", "http://0.0.0.0:80", "tcp://0.0.0.0", "tcp://0.0.0.0:0"} {
+		if _, err := normalizeRelayListener(in); err == nil {
+			t.Fatalf("%q: expected error", in)
+		}
+	}
+}
+
+func TestRelayPeerURLs(t *testing.T) {
+	got := relayPeerURLs([]string{
+		"tcp://0.0.0.0:11010",
+		"udp://[::]:11010",
+		"wss://0.0.0.0:443/et",
+		"tcp://10.1.2.3:11012",
+	}, "relay.example.com")
+	want := []string{
+		"tcp://relay.example.com:11010",
+		"udp://relay.example.com:11010",
+		"wss://relay.example.com:443/et",
+		"tcp://10.1.2.3:11012",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRelayArgs(t *testing.T) {
+	args := relayArgs(relayOptions{
+		Listeners:     []string{"tcp://0.0.0.0:11010", "udp://0.0.0.0:11010"},
+		NetworkName:   "telehand-relay:a",
+		NetworkSecret: "s",
+		Whitelist:     "telehand:*",
+		Peers:         []string{"tcp://10.0.0.2:11010"},
+	}, "15888")
+	want := []string{
+		"--no-tun", "--network-name", "telehand-relay:a", "--network-secret", "s", "-r", "127.0.0.1:15888",
+		"-l", "tcp://0.0.0.0:11010", "-l", "udp://0.0.0.0:11010",
+		"--relay-network-whitelist", "telehand:*",
+		"--peers", "tcp://10.0.0.2:11010",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("got %v\nwant %v", args, want)
+	}
+}
+
+func TestParseForeignNetworks(t *testing.T) {
+	out := []byte(`{"foreign_networks":{
+		"telehand:b":{"network_secret_digest":[1,2],"peers":[{"peer_id":1},{"peer_id":2}]},
+		"telehand:a":{"peers":[{"peer_id":3}]}
+	}}`)
+	got, err := parseForeignNetworks(out)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []RelayNetwork{{Name: "telehand:a", Peers: 1}, {Name: "telehand:b", Peers: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, err := parseForeignNetworks([]byte(`{}`)); err != nil || len(got) != 0 {
+		t.Fatalf("empty: got %v, %v", got, err)
+	}
+	if _, err := parseForeignNetworks([]byte("not json")); err == nil {
+		t.Fatal("expected error for invalid output")
+	}
+}
+
+func TestRelayHealthEndpoint(t *testing.T) {
+	r := newRelayServer(relayOptions{Listeners: []string{"tcp://0.0.0.0:11010"}, PublicHost: "198.51.100.4"}, nil)
+	mux := r.mux()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("starting relay: status %d", rec.Code)
+	}
+
+	r.update(func(h *RelayHealth) { h.Status, h.Networks, h.NetworkPeers = relayStatusOK, 2, 3 })
+	r.networks = []RelayNetwork{{Name: "telehand:a", Peers: 1}, {Name: "telehand:b", Peers: 2}}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var h RelayHealth
+	if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s, err %v", rec.Code, rec.Body, err)
+	}
+	if h.Networks != 2 || h.NetworkPeers != 3 || h.Version != telehandVersion ||
+		!reflect.DeepEqual(h.PeerURLs, []string{"tcp://198.51.100.4:11010"}) {
+		t.Fatalf("unexpected health: %+v", h)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/networks", nil))
+	var nets []RelayNetwork
+	if err := json.Unmarshal(rec.Body.Bytes(), &nets); err != nil || len(nets) != 2 {
+		t.Fatalf("networks: %s, %v", rec.Body, err)
+	}
+}
+
+func TestSystemdUnit(t *testing.T) {
+	args := withoutFlag([]string{"--public-host", "relay.example.com", "--print-systemd", "--relay-networks", "telehand:* ops:*"}, "print-systemd")
+	unit := systemdUnit("/usr/local/bin/telehand", args)
+	want := `ExecStart=/usr/local/bin/telehand relay --public-host relay.example.com --relay-networks "telehand:* ops:*"`
+	if !strings.Contains(unit, want+"\n") {
+		t.Fatalf("unit missing %q:\n%s", want, unit)
+	}
+	if !strings.Contains(unit, "Restart=always") || !strings.Contains(unit, "WantedBy=multi-user.target") {
+		t.Fatalf("unexpected unit:\n%s", unit)
+	}
+}
+
+func TestRunRelayPeersNeedSecret(t *testing.T) {
+	for _, args := range [][]string{
+		{"--peers", "tcp://10.0.0.2:11010"},
+		{"--peers", "tcp://10.0.0.2:11010", "--print-systemd"},
+	} {
+		if code := runRelay(args); code != ExitCodeParam {
+			t.Fatalf("%v: exit %d, want %d", args, code, ExitCodeParam)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// runAsIdentity is the account /exec and file writes switch to. A nil
+// identity means "stay as the telehand process", and every method accepts it.
+type runAsIdentity struct {
+	Name   string
+	UID    int
+	GID    int
+	Groups []uint32
+	Home   string
+}
+
+func (id *runAsIdentity) name() string {
+	if id == nil {
+		return ""
+	}
+	return id.Name
+}
+
+// chown hands a freshly written path over to the identity. Symlinks are not
+// followed.
+func (id *runAsIdentity) chown(path string) error {
+	if id == nil {
+		return nil
+	}
+	return os.Lchown(path, id.UID, id.GID)
+}
+
+// prepareWrite runs before a file write on behalf of id. The write itself
+// happens as the telehand process, so it first checks that id could make
+// it (see checkWriteAccess), and it reports whether path already exists:
+// only paths a call creates are chowned, so an existing file, say a
+// root-owned one under sudo, keeps its owner.
+func (id *runAsIdentity) prepareWrite(path string) (existed bool, err error) {
+	_, statErr := os.Lstat(path)
+	existed = statErr == nil
+	if id == nil {
+		return existed, nil
+	}
+	return existed, id.checkWriteAccess(path)
+}
+
+// prepareRemove checks that id could remove path and everything under it
+// (see checkRemoveAccess); the removal itself happens as the telehand
+// process.
+func (id *runAsIdentity) prepareRemove(path string) error {
+	if id == nil {
+		return nil
+	}
+	return id.checkRemoveAccess(path)
+}
+
+// chownCreated chowns path unless prepareWrite found it already there.
+func (id *runAsIdentity) chownCreated(path string, existed bool) error {
+	if existed {
+		return nil
+	}
+	return id.chown(path)
+}
+
+// mkdirAll is os.MkdirAll(dir, 0755) that also chowns every directory it had
+// to create; existing parents keep their owner.
+func (id *runAsIdentity) mkdirAll(dir string) error {
+	if id == nil {
+		return os.MkdirAll(dir, 0755)
+	}
+	dir = filepath.Clean(dir)
+	first := ""
+	for p := dir; ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil {
+			break
+		}
+		first = p
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if first == "" {
+		return nil
+	}
+	for p := dir; ; p = filepath.Dir(p) {
+		if err := id.chown(p); err != nil {
+			return err
+		}
+		if p == first || filepath.Dir(p) == p {
+			return nil
+		}
+	}
+}
+
+// env returns the login variables a shell expects to match its user.
+func (id *runAsIdentity) env() map[string]string {
+	if id == nil {
+		return nil
+	}
+	return map[string]string{"HOME": id.Home, "USER": id.Name, "LOGNAME": id.Name}
+}
@@ -0,0 +1,269 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func requireRootWithNobody(t *testing.T) *runAsIdentity {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("run_as needs root")
+	}
+	id, err := lookupRunAs("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+	return id
+}
+
+func fileOwner(t *testing.T, p string) int {
+	t.Helper()
+	info, err := os.Lstat(p)
+	if err != nil {
+		t.Fatalf("stat %s failed: %v", p, err)
+	}
+	return int(info.Sys().(*syscall.Stat_t).Uid)
+}
+
+// openTempDir is a temp dir every user can write to; t.TempDir is 0700.
+func openTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, p := range []string{filepath.Dir(dir), dir} {
+		if err := os.Chmod(p, 0o777); err != nil {
+			t.Fatalf("chmod %s: %v", p, err)
+		}
+	}
+	return dir
+}
+
+func TestResolveRunAsDefaultsToSudoUser(t *testing.T) {
+	nobody := requireRootWithNobody(t)
+	t.Setenv("SUDO_USER", "nobody")
+	id, err := resolveRunAs("")
+	if err != nil || id == nil || id.UID != nobody.UID {
+		t.Fatalf("default run_as mismatch: id=%+v err=%v", id, err)
+	}
+	if id, err := resolveRunAs("root"); err != nil || id != nil {
+		t.Fatalf("run_as root should keep the current identity: id=%+v err=%v", id, err)
+	}
+	t.Setenv("SUDO_USER", "telehand-no-such-user")
+	if id, err := resolveRunAs(""); err != nil || id != nil {
+		t.Fatalf("unknown SUDO_USER should be ignored: id=%+v err=%v", id, err)
+	}
+	if _, err := resolveRunAs("telehand-no-such-user"); err == nil {
+		t.Fatalf("unknown explicit run_as should fail")
+	}
+}
+
+func TestRunAsMkdirAllChownsCreatedDirsOnly(t *testing.T) {
+	id := requireRootWithNobody(t)
+	root := t.TempDir()
+	if err := id.mkdirAll(filepath.Join(root, "a", "b")); err != nil {
+		t.Fatalf("mkdirAll failed: %v", err)
+	}
+	if fileOwner(t, root) != 0 {
+		t.Fatalf("existing parent must keep its owner")
+	}
+	for _, p := range []string{filepath.Join(root, "a"), filepath.Join(root, "a", "b")} {
+		if fileOwner(t, p) != id.UID {
+			t.Fatalf("%s should be owned by %d", p, id.UID)
+		}
+	}
+}
+
+func TestAPIRunAs(t *testing.T) {
+	id := requireRootWithNobody(t)
+	t.Setenv("SUDO_USER", "")
+	s := NewAPIServer("127.0.0.1", 20580, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	base := fmt.Sprintf("http://127.0.0.1:%d", s.Port())
+	client := &http.Client{Timeout: 8 * time.Second}
+
+	status, out := callRaw(t, client, http.MethodPost, base+"/exec", ExecReq{Cmd: "id -u; echo $USER", RunAs: "nobody"})
+	if status != http.StatusOK {
+		t.Fatalf("exec status=%d body=%s", status, out)
+	}
+	var resp ExecResp
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("decode exec resp failed: %v", err)
+	}
+	if resp.Stdout != fmt.Sprintf("%d\nnobody\n", id.UID) || resp.RunAs != "nobody" {
+		t.Fatalf("run_as exec mismatch: got=%+v", resp)
+	}
+
+	target := filepath.Join(openTempDir(t), "sub", "note.txt")
+	status, out = callRaw(t, client, http.MethodPost, base+"/write", WriteReq{Path: target, Content: "hi", RunAs: "nobody"})
+	if status != http.StatusOK {
+		t.Fatalf("write status=%d body=%s", status, out)
+	}
+	if fileOwner(t, target) != id.UID || fileOwner(t, filepath.Dir(target)) != id.UID {
+		t.Fatalf("written file and new parent should belong to nobody")
+	}
+
+	status, out = callRaw(t, client, http.MethodPost, base+"/write", WriteReq{Path: target, Content: "hi", RunAs: "telehand-no-such-user"})
+	if status != http.StatusBadRequest || !strings.Contains(string(out), "not found") {
+		t.Fatalf("unknown run_as should be rejected: status=%d body=%s", status, out)
+	}
+}
+
+func TestAPIRunAsKeepsExistingOwner(t *testing.T) {
+	requireRootWithNobody(t)
+	t.Setenv("SUDO_USER", "")
+	s := NewAPIServer("127.0.0.1", 21280, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	base := fmt.Sprintf("http://127.0.0.1:%d", s.Port())
+	client := &http.Client{Timeout: 8 * time.Second, Transport: &http.Transport{}}
+
+	dir := openTempDir(t)
+	shared := filepath.Join(dir, "shared.txt")
+	mustWriteFile(t, shared, "old")
+	if err := os.Chmod(shared, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	status, out := callRaw(t, client, http.MethodPost, base+"/write", WriteReq{Path: shared, Content: "new", RunAs: "nobody"})
+	if status != http.StatusOK {
+		t.Fatalf("write status=%d body=%s", status, out)
+	}
+	status, out = callRaw(t, client, http.MethodPost, base+"/sync/put", SyncPutReq{Root: dir, Path: "shared.txt", Data: "c3luYw==", Final: true, Size: 4, RunAs: "nobody"})
+	if status != http.StatusOK {
+		t.Fatalf("sync put status=%d body=%s", status, out)
+	}
+	if fileOwner(t, shared) != 0 {
+		t.Fatalf("overwriting must not hand a root-owned file to nobody")
+	}
+	assertFileContent(t, shared, "sync")
+
+	// Files nobody could not write itself stay untouched.
+	private := filepath.Join(dir, "private.txt")
+	mustWriteFile(t, private, "root only")
+	for _, req := range []struct {
+		path string
+		body any
+	}{
+		{"/write", WriteReq{Path: private, Content: "x", RunAs: "nobody"}},
+		{"/upload", UploadReq{Path: private, Data: "eA==", RunAs: "nobody"}},
+		{"/write", WriteReq{Path: filepath.Join(t.TempDir(), "new.txt"), Content: "x", RunAs: "nobody"}},
+	} {
+		status, out = callRaw(t, client, http.MethodPost, base+req.path, req.body)
+		if status != http.StatusForbidden || !strings.Contains(string(out), "permission_denied") {
+			t.Fatalf("%s should be denied: status=%d body=%s", req.path, status, out)
+		}
+	}
+	assertFileContent(t, private, "root only")
+}
+
+func TestAPIRunAsEditPatchAndSyncDelete(t *testing.T) {
+	id := requireRootWithNobody(t)
+	// The default identity: under sudo, requests without run_as act as
+	// SUDO_USER too.
+	t.Setenv("SUDO_USER", "nobody")
+	s := NewAPIServer("127.0.0.1", 21580, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	base := fmt.Sprintf("http://127.0.0.1:%d", s.Port())
+	client := &http.Client{Timeout: 8 * time.Second, Transport: &http.Transport{}}
+
+	dir := openTempDir(t)
+	shared := filepath.Join(dir, "shared.txt")
+	mustWriteFile(t, shared, "a\nb")
+	if err := os.Chmod(shared, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if status, out := callRaw(t, client, http.MethodPost, base+"/edit", EditReq{Path: shared, StartLine: 1, EndLine: 1, Content: "A"}); status != http.StatusOK {
+		t.Fatalf("edit status=%d body=%s", status, out)
+	}
+	if status, out := callRaw(t, client, http.MethodPost, base+"/patch", PatchReq{Path: shared, Old: "b", New: "B"}); status != http.StatusOK {
+		t.Fatalf("patch status=%d body=%s", status, out)
+	}
+	assertFileContent(t, shared, "A\nB")
+	if fileOwner(t, shared) != 0 {
+		t.Fatalf("edit and patch must keep the existing owner")
+	}
+
+	private := filepath.Join(dir, "private.txt")
+	mustWriteFile(t, private, "root only")
+	for _, req := range []struct {
+		path string
+		body any
+	}{
+		{"/edit", EditReq{Path: private, StartLine: 1, EndLine: 1, Content: "x"}},
+		{"/patch", PatchReq{Path: private, Old: "root", New: "x"}},
+		{"/patch", PatchReq{Path: private, Old: "root", New: "x", RunAs: "nobody"}},
+	} {
+		status, out := callRaw(t, client, http.MethodPost, base+req.path, req.body)
+		if status != http.StatusForbidden || !strings.Contains(string(out), "permission_denied") {
+			t.Fatalf("%s should be denied: status=%d body=%s", req.path, status, out)
+		}
+	}
+	assertFileContent(t, private, "root only")
+
+	// A root-owned 0755 directory: nobody can neither empty nor remove it.
+	locked := filepath.Join(dir, "locked")
+	mustWriteFile(t, filepath.Join(locked, "keep.txt"), "keep")
+	if err := os.Chmod(locked, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, paths := range [][]string{{"locked/keep.txt"}, {"locked"}} {
+		status, out := callRaw(t, client, http.MethodPost, base+"/sync/delete", SyncDeleteReq{Root: dir, Paths: paths})
+		if status != http.StatusForbidden || !strings.Contains(string(out), "permission_denied") {
+			t.Fatalf("delete %v should be denied: status=%d body=%s", paths, status, out)
+		}
+	}
+	assertFileContent(t, filepath.Join(locked, "keep.txt"), "keep")
+
+	mine := filepath.Join(dir, "mine")
+	if err := id.mkdirAll(mine); err != nil {
+		t.Fatal(err)
+	}
+	mustWriteFile(t, filepath.Join(mine, "f.txt"), "x")
+	status, out := callRaw(t, client, http.MethodPost, base+"/sync/delete", SyncDeleteReq{Root: dir, Paths: []string{"mine"}, RunAs: "nobody"})
+	if status != http.StatusOK {
+		t.Fatalf("delete own dir status=%d body=%s", status, out)
+	}
+	if _, err := os.Stat(mine); !os.IsNotExist(err) {
+		t.Fatalf("mine should be gone: %v", err)
+	}
+}
+
+func TestCheckRemoveAccessSticky(t *testing.T) {
+	id := requireRootWithNobody(t)
+	dir := openTempDir(t)
+	if err := os.Chmod(dir, 0o777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	rootFile := filepath.Join(dir, "root.txt")
+	mustWriteFile(t, rootFile, "x")
+	if err := id.checkRemoveAccess(rootFile); err == nil {
+		t.Fatal("sticky dir: nobody must not remove root's file")
+	}
+	own := filepath.Join(dir, "own.txt")
+	mustWriteFile(t, own, "x")
+	if err := id.chown(own); err != nil {
+		t.Fatal(err)
+	}
+	if err := id.checkRemoveAccess(own); err != nil {
+		t.Fatalf("sticky dir: own file should be removable: %v", err)
+	}
+	if err := id.checkRemoveAccess(filepath.Join(dir, "missing")); err != nil {
+		t.Fatalf("missing path: %v", err)
+	}
+}
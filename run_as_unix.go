@@ -0,0 +1,263 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// defaultRunAsUser mirrors buildOpenBrowserCommand: under sudo, work happens
+// as the user who invoked sudo rather than as root.
+func defaultRunAsUser() string {
+	if os.Geteuid() != 0 {
+		return ""
+	}
+	name := strings.TrimSpace(os.Getenv("SUDO_USER"))
+	if name == "root" {
+		return ""
+	}
+	return name
+}
+
+// resolveRunAs looks up the account named by run_as (a user name or uid).
+// An empty name falls back to SUDO_USER; switching to the current user
+// returns nil.
+func resolveRunAs(name string) (*runAsIdentity, error) {
+	name = strings.TrimSpace(name)
+	explicit := name != ""
+	if !explicit {
+		name = defaultRunAsUser()
+		if name == "" {
+			return nil, nil
+		}
+	}
+	id, err := lookupRunAs(name)
+	if err != nil {
+		if !explicit {
+			// A stale SUDO_USER must not break every request.
+			return nil, nil
+		}
+		return nil, err
+	}
+	if id.UID == os.Geteuid() {
+		return nil, nil
+	}
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("run_as %s requires telehand to run as root", name)
+	}
+	return id, nil
+}
+
+func lookupRunAs(name string) (*runAsIdentity, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, numErr := strconv.Atoi(name); numErr == nil {
+			u, err = user.LookupId(name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("run_as user %s not found", name)
+	}
+	uid, err1 := strconv.Atoi(u.Uid)
+	gid, err2 := strconv.Atoi(u.Gid)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("run_as user %s has no numeric uid/gid", name)
+	}
+	id := &runAsIdentity{Name: u.Username, UID: uid, GID: gid, Home: u.HomeDir}
+	if gids, err := u.GroupIds(); err == nil {
+		for _, g := range gids {
+			if n, err := strconv.ParseUint(g, 10, 32); err == nil {
+				id.Groups = append(id.Groups, uint32(n))
+			}
+		}
+	}
+	return id, nil
+}
+
+func applyRunAs(cmd *exec.Cmd, id *runAsIdentity) {
+	if id == nil {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    uint32(id.UID),
+		Gid:    uint32(id.GID),
+		Groups: id.Groups,
+	}
+}
+
+// checkWriteAccess applies the permission bits as if id made the write:
+// search on every existing ancestor, then write on the file if it exists,
+// or on the closest existing ancestor that the write would create under.
+func (id *runAsIdentity) checkWriteAccess(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	var chain []string
+	for p := abs; ; p = filepath.Dir(p) {
+		chain = append(chain, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	denied := &os.PathError{Op: "write as " + id.Name, Path: path, Err: syscall.EACCES}
+	for i := len(chain) - 1; i >= 0; i-- {
+		info, err := os.Stat(chain[i])
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			// chain[i+1] is the deepest existing directory.
+			parent, err := os.Stat(chain[i+1])
+			if err != nil {
+				return err
+			}
+			if !id.permits(parent, 0o3) {
+				return denied
+			}
+			return nil
+		}
+		if i == 0 {
+			if !id.permits(info, 0o2) {
+				return denied
+			}
+			return nil
+		}
+		if !id.permits(info, 0o1) {
+			return denied
+		}
+	}
+	return nil
+}
+
+// checkRemoveAccess applies the permission bits as if id ran rm -rf on
+// path: search on every ancestor and write on the parent, then, for a
+// directory, read, write and search on every directory inside it. A sticky
+// directory only lets id remove entries it owns (or the directory's own).
+func (id *runAsIdentity) checkRemoveAccess(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(abs)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	parent := filepath.Dir(abs)
+	if err := id.checkWriteAccess(parent); err != nil {
+		return err
+	}
+	denied := &os.PathError{Op: "remove as " + id.Name, Path: path, Err: syscall.EACCES}
+	parentInfo, err := os.Stat(parent)
+	if err != nil {
+		return err
+	}
+	if !id.permits(parentInfo, 0o3) || !id.mayUnlink(parentInfo, info) {
+		return denied
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	return filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		dirInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !id.permits(dirInfo, 0o7) {
+			return &os.PathError{Op: "remove as " + id.Name, Path: p, Err: syscall.EACCES}
+		}
+		if dirInfo.Mode()&os.ModeSticky == 0 {
+			return nil
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			child, err := e.Info()
+			if err != nil {
+				return err
+			}
+			if !id.mayUnlink(dirInfo, child) {
+				return &os.PathError{Op: "remove as " + id.Name, Path: filepath.Join(p, e.Name()), Err: syscall.EACCES}
+			}
+		}
+		return nil
+	})
+}
+
+// mayUnlink applies the sticky bit of dir to removing child from it.
+func (id *runAsIdentity) mayUnlink(dir, child os.FileInfo) bool {
+	if dir.Mode()&os.ModeSticky == 0 {
+		return true
+	}
+	return ownedBy(dir, id.UID) || ownedBy(child, id.UID)
+}
+
+func ownedBy(info os.FileInfo, uid int) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == uid
+}
+
+// permits reports whether id has bits (rwx as 4/2/1) on info, picking the
+// owner, group or other class the way the kernel does.
+func (id *runAsIdentity) permits(info os.FileInfo, bits uint32) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	mode := uint32(info.Mode().Perm())
+	switch {
+	case int(st.Uid) == id.UID:
+		return mode>>6&bits == bits
+	case id.inGroup(st.Gid):
+		return mode>>3&bits == bits
+	default:
+		return mode&bits == bits
+	}
+}
+
+func (id *runAsIdentity) inGroup(gid uint32) bool {
+	if int(gid) == id.GID {
+		return true
+	}
+	for _, g := range id.Groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreOwner gives path the owner recorded in prev, for files replaced
+// on id's behalf.
+func (id *runAsIdentity) restoreOwner(path string, prev os.FileInfo) error {
+	if id == nil {
+		return nil
+	}
+	st, ok := prev.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return os.Lchown(path, int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Starting a process as another Windows user needs that user's password or
+// session token, neither of which telehand has, so run_as is refused.
+func resolveRunAs(name string) (*runAsIdentity, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("run_as is not supported on windows")
+}
+
+func applyRunAs(cmd *exec.Cmd, id *runAsIdentity) {}
+
+// checkWriteAccess and checkRemoveAccess are never reached: resolveRunAs
+// returns no identity.
+func (id *runAsIdentity) checkWriteAccess(path string) error { return nil }
+
+func (id *runAsIdentity) checkRemoveAccess(path string) error { return nil }
+
+func (id *runAsIdentity) restoreOwner(path string, prev os.FileInfo) error { return nil }
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -21,6 +22,10 @@ type sessionOptions struct {
 	EncodedConfig    string
 	Commands         []InstallCommand
 	ClipboardCommand string
+	SocksPort        int      // receiver: SOCKS5 port on the virtual IP, 0 disables
+	SocksListen      string   // initiator: local SOCKS5 listen address
+	ExposeSubnets    []string // receiver: LAN subnets proxied to the initiator
+	AcceptSubnets    []string // initiator: receiver subnets it is willing to route
 }
 
 type sessionDeps struct {
@@ -29,6 +34,8 @@ type sessionDeps struct {
 	routeInterfaceForTarget  func(string) (string, error)
 	addHostRouteForTarget    func(string, string) error
 	removeHostRouteForTarget func(string, string) error
+	addSubnetRoute           func(string, string) error
+	removeSubnetRoute        func(string, string) error
 	probePeerVirtualIP       func(string, int, time.Duration) error
 	shouldCheckRouteOwner    func() bool
 }
@@ -73,6 +80,8 @@ var (
 		routeInterfaceForTarget:  routeInterfaceForTarget,
 		addHostRouteForTarget:    addHostRouteForTarget,
 		removeHostRouteForTarget: removeHostRouteForTarget,
+		addSubnetRoute:           addSubnetRouteForTarget,
+		removeSubnetRoute:        removeSubnetRouteForTarget,
 		probePeerVirtualIP:       probePeerVirtualIP,
 		shouldCheckRouteOwner:    shouldCheckRouteOwnership,
 	}
@@ -91,6 +100,7 @@ var (
 	bootstrapWaitTimeout    = BootstrapWaitTimeout
 
 	collectLocalIPv4NetsFn          = collectLocalIPv4Nets
+	collectRouteIPv4NetsFn          = collectRouteIPv4Nets
 	chooseCandidatesFn              = chooseCandidates
 	rankPeersByLatencyFn            = rankPeersByLatency
 	newEasyTierFn                   = NewEasyTier
@@ -125,19 +135,25 @@ func runSession(opts sessionOptions) int {
 		runtimeET       *EasyTier
 		runtimeNetOwner string
 		runtimeNetHash  string
+		runtimeSocks    int
+		runtimeExposed  []string
+		runtimeOnce     *onceReceiverGuard
 	)
 	gui.SetPeerInfoProvider(func() (PeerInfoSnapshot, error) {
 		runtimeMu.RLock()
 		et := runtimeET
 		networkOwner := runtimeNetOwner
 		networkHash := runtimeNetHash
+		exposed := runtimeExposed
+		once := runtimeOnce
 		runtimeMu.RUnlock()
 		if et == nil {
 			return PeerInfoSnapshot{
-				UpdatedAt:    time.Now().Format(time.RFC3339),
-				NetworkOwner: networkOwner,
-				NetworkHash:  networkHash,
-				Peers:        []PeerInfo{},
+				UpdatedAt:      time.Now().Format(time.RFC3339),
+				NetworkOwner:   networkOwner,
+				NetworkHash:    networkHash,
+				Peers:          []PeerInfo{},
+				ExposedSubnets: exposed,
 			}, nil
 		}
 		snapshot, err := et.QueryPeerInfo(role)
@@ -146,8 +162,15 @@ func runSession(opts sessionOptions) int {
 		}
 		snapshot.NetworkOwner = networkOwner
 		snapshot.NetworkHash = networkHash
+		snapshot.ExposedSubnets = exposed
+		if once != nil {
+			once.mark(&snapshot)
+		}
 		return snapshot, nil
 	})
+	if role == "server" {
+		gui.SetConfigCheck(checkPairingNonceUnused)
+	}
 
 	submitFn := func(encoded string) error {
 		return submitEncodedConfig(encoded, gui.SubmitConfigEncoded)
@@ -158,6 +181,9 @@ func runSession(opts sessionOptions) int {
 		gui.AddLog(log)
 	}, func() HealthResp {
 		s := gui.GetState()
+		runtimeMu.RLock()
+		socksPort := runtimeSocks
+		runtimeMu.RUnlock()
 		return HealthResp{
 			Status:    "ok",
 			Phase:     s.Phase,
@@ -167,6 +193,10 @@ func runSession(opts sessionOptions) int {
 			GUIPort:   gui.Port(),
 			Error:     s.Error,
 			ErrorCode: s.ErrorCode,
+			SocksPort: socksPort,
+			// Only the receiver advertises; an initiator never re-exports
+			// what it learned from its peer.
+			ExposedSubnets: exposedSubnetsForRole(role, opts.ExposeSubnets),
 		}
 	}, submitFn)
 	if err := api.Start(); err != nil {
@@ -174,6 +204,7 @@ func runSession(opts sessionOptions) int {
 		return ExitCodeService
 	}
 	apiPort = api.Port()
+	gui.SetForwardsProvider(api.Tunnels)
 	fmt.Printf("API server started at http://0.0.0.0:%d\n", apiPort)
 
 	if err := gui.Start(); err != nil {
@@ -219,6 +250,11 @@ func runSession(opts sessionOptions) int {
 	}
 
 	cfg.Peers = runtimePeerPool(cfg.Peers)
+	cfg.ProxyNetworks = exposedSubnetsForRole(role, opts.ExposeSubnets)
+	if role == "server" {
+		// The receiver serves only what the pairing code asked for.
+		api.SetAccess(cfg.APIToken, cfg.Permissions)
+	}
 	if len(cfg.Peers) == 0 {
 		errCode := ErrorCodePeerUnreachable
 		errMsg := formatConnectError(errCode, fmt.Errorf("no available peers after normalization"))
@@ -238,6 +274,15 @@ func runSession(opts sessionOptions) int {
 	state.NetworkOwner = networkOwner
 	state.NetworkHash = networkHash
 	state.BusinessEndpoint = "正在连接业务端..."
+	if role == "client" {
+		// The initiator hands the token to its agent via the AI prompt.
+		state.APIToken = cfg.APIToken
+		if cfg.Nonce != "" {
+			runtimeMu.Lock()
+			runtimeOnce = newOnceReceiverGuard(cfg.Nonce)
+			runtimeMu.Unlock()
+		}
+	}
 	gui.SetState(state)
 	runtimeMu.Lock()
 	runtimeNetOwner = networkOwner
@@ -333,10 +378,49 @@ func runSession(opts sessionOptions) int {
 		state.BusinessEndpoint = "已连接"
 		state.Error = ""
 		state.ErrorCode = ""
+		state.ExposedSubnets = exposedSubnetsForRole(role, opts.ExposeSubnets)
 		gui.SetState(state)
 		fmt.Printf("State: connecting -> running\n")
 		fmt.Printf("API server reachable at http://%s:%d\n", result.virtIP, apiPort)
 		fmt.Printf("State guard: threshold=%d consecutive failures\n", defaultRunningGuardConfig.consecutiveFailed)
+		runtimeMu.RLock()
+		once := runtimeOnce
+		runtimeMu.RUnlock()
+		if err := claimOncePairing(role, cfg, once, func() (PeerInfoSnapshot, error) {
+			return activeET.QueryPeerInfo(role)
+		}, result.activeHostRoutePeer); err != nil {
+			if errorCodeOf(err) == ErrorCodeConfigAlreadyUsed {
+				// Reached a receiver other than the one the code is bound
+				// to: refuse to work with it.
+				setSessionError(gui, apiPort, ErrorCodeConfigAlreadyUsed, err.Error())
+				fmt.Fprintln(os.Stderr, err.Error())
+				requestStop()
+			} else {
+				fmt.Fprintf(os.Stderr, "One-time pairing state not saved: %v\n", err)
+			}
+		}
+
+		token := sessionToken(cfg.NetworkName, cfg.NetworkSecret)
+		socksPort, stopSocks := startSessionSocks(opts, role, token, result.virtIP, result.activeHostRoutePeer, apiPort, api.addLog)
+		runtimeMu.Lock()
+		runtimeSocks = socksPort
+		runtimeExposed = state.ExposedSubnets
+		runtimeMu.Unlock()
+		reportExposed := func(subnets []string) {
+			runtimeMu.Lock()
+			runtimeExposed = subnets
+			runtimeMu.Unlock()
+			s := gui.GetState()
+			s.ExposedSubnets = subnets
+			gui.SetState(s)
+		}
+		logSubnet := func(msg string) {
+			gui.AddDebugLog(msg)
+			if cliOnly {
+				fmt.Println(msg)
+			}
+		}
+		stopSubnets := startSessionSubnetRoutes(role, result.activeHostRoutePeer, apiPort, baseline.TunDevice, opts.AcceptSubnets, deps, logSubnet, reportExposed)
 
 		stopPeerPrint := make(chan struct{}, 1)
 		go printPeerInfoLoop(stopPeerPrint, func() (PeerInfoSnapshot, error) {
@@ -366,6 +450,8 @@ func runSession(opts sessionOptions) int {
 			fmt.Println("State: stopping")
 			guardStop <- struct{}{}
 			stopPeerPrint <- struct{}{}
+			stopSocks()
+			stopSubnets()
 			api.Stop()
 			if activeET != nil {
 				if deps.removeHostRouteForTarget != nil && activeHostRouteTarget != "" {
@@ -387,6 +473,12 @@ func runSession(opts sessionOptions) int {
 
 		guardStop <- struct{}{}
 		stopPeerPrint <- struct{}{}
+		stopSocks()
+		stopSubnets()
+		runtimeMu.Lock()
+		runtimeSocks = 0
+		runtimeExposed = nil
+		runtimeMu.Unlock()
 		if activeET != nil {
 			if deps.removeHostRouteForTarget != nil && activeHostRouteTarget != "" {
 				_ = deps.removeHostRouteForTarget(activeHostRouteTarget, baseline.TunDevice)
@@ -519,7 +611,7 @@ func connectWithPeerFallback(
 			})
 			setRuntimeET(activeET)
 
-			startErr := easyTierStartFn(activeET, &peerCfg, EasyTierStartOptions{IPv4CIDR: candidate.LocalCIDR})
+			startErr := easyTierStartFn(activeET, &peerCfg, EasyTierStartOptions{IPv4CIDR: candidate.LocalCIDR, ProxyNetworks: peerCfg.ProxyNetworks})
 			if startErr != nil {
 				errCode := classifyEasyTierError(startErr, activeET.Logs(), ErrorCodeEasyTierStartFailed)
 				lastErr = startErr
@@ -900,6 +992,8 @@ func exitCodeFromErrorCode(code string, fallback int) int {
 	switch code {
 	case ErrorCodeEasyTierIPTimeout, ErrorCodeAuthFailed, ErrorCodePeerUnreachable, ErrorCodeWindowsFirewallBlocked, ErrorCodeRouteConflictDetected:
 		return ExitCodeNetwork
+	case ErrorCodeConfigAlreadyUsed:
+		return ExitCodeParam
 	case ErrorCodeEasyTierStartFailed, ErrorCodeWindowsTUNInitFailed, ErrorCodeWindowsAdminCheckFail, ErrorCodeWindowsNotAdmin, ErrorCodeTUNPermissionDenied:
 		return ExitCodeService
 	default:
@@ -1339,7 +1433,7 @@ func probePeerVirtualIP(ip string, port int, timeout time.Duration) error {
 	if net.ParseIP(target) == nil {
 		return fmt.Errorf("invalid peer ip: %q", ip)
 	}
-	addr := fmt.Sprintf("%s:%d", target, port)
+	addr := net.JoinHostPort(target, strconv.Itoa(port))
 	conn, err := net.DialTimeout("tcp", addr, timeout)
 	if err != nil {
 		return err
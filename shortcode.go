@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Short pairing codes ("TH-XXXX-XXXX-...") are a compact binary Config in
+// Crockford base32, meant to be read aloud or typed by hand. The secret
+// and API token are derived from a random seed, and peers in the default
+// pool are left out, so only the network owner and any extras travel.
+const (
+	shortCodePrefix   = "TH-"
+	shortCodeVersion  = 1
+	shortCodeSeedLen  = 8
+	shortCodeGroupLen = 4
+	shortCodeSumLen   = 2
+	shortCodeMaxName  = 32
+)
+
+const (
+	shortFlagRawName = 1 << iota
+	shortFlagPeers
+	shortFlagExpires
+	shortFlagPermissions
+	shortFlagAPIToken
+	shortFlagOnce
+)
+
+// crockfordAlphabet omits I, L, O and U; decoding maps the look-alikes.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func isShortCode(code string) bool {
+	return len(code) > len(shortCodePrefix) && strings.EqualFold(code[:len(shortCodePrefix)], shortCodePrefix)
+}
+
+// mintShortCode encodes cfg as a short code. It replaces the secret (and
+// API token, if one is requested) with values derived from a fresh seed;
+// fields a short code cannot carry are rejected rather than dropped.
+func mintShortCode(cfg *Config) (string, error) {
+	if cfg.Signer != "" {
+		return "", errors.New("short codes cannot carry a signature")
+	}
+	var seed [shortCodeSeedLen]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return "", err
+	}
+	var flags byte
+	name, ok := strings.CutPrefix(cfg.NetworkName, "telehand:")
+	if !ok {
+		name = cfg.NetworkName
+		flags |= shortFlagRawName
+	}
+	if len(name) > shortCodeMaxName {
+		return "", fmt.Errorf("network name too long for a short code (max %d bytes)", shortCodeMaxName)
+	}
+	extra := extraPeers(cfg.Peers)
+	if len(extra) > 0 {
+		flags |= shortFlagPeers
+	}
+	if cfg.ExpiresAt > 0 {
+		flags |= shortFlagExpires
+	}
+	var perms byte
+	for _, p := range cfg.Permissions {
+		for i, known := range knownPermissions {
+			if p == known {
+				perms |= 1 << i
+			}
+		}
+	}
+	if perms != 0 {
+		flags |= shortFlagPermissions
+	}
+	if cfg.APIToken != "" {
+		flags |= shortFlagAPIToken
+	}
+	if cfg.Nonce != "" {
+		flags |= shortFlagOnce
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(shortCodeVersion)
+	buf.WriteByte(flags)
+	buf.Write(seed[:])
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+	if flags&shortFlagExpires != 0 {
+		binary.Write(&buf, binary.BigEndian, uint32(cfg.ExpiresAt))
+	}
+	if flags&shortFlagPermissions != 0 {
+		buf.WriteByte(perms)
+	}
+	if flags&shortFlagPeers != 0 {
+		buf.WriteByte(byte(len(extra)))
+		for _, p := range extra {
+			if len(p) > 255 {
+				return "", fmt.Errorf("peer too long for a short code: %s", p)
+			}
+			buf.WriteByte(byte(len(p)))
+			buf.WriteString(p)
+		}
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	buf.Write(sum[:shortCodeSumLen])
+
+	cfg.Version = pairingFormatVersion
+	cfg.NetworkSecret = deriveShortSecret(seed[:], "secret")
+	if flags&shortFlagAPIToken != 0 {
+		cfg.APIToken = deriveShortSecret(seed[:], "api-token")
+	}
+	if flags&shortFlagOnce != 0 {
+		cfg.Nonce = deriveShortSecret(seed[:], "nonce")
+	}
+	cfg.MinClientVersion = ""
+	return shortCodePrefix + groupShortCode(crockfordEncode(buf.Bytes())), nil
+}
+
+// decodeShortCode is the inverse of mintShortCode. It tolerates lower
+// case, missing or extra dashes and the usual look-alike characters.
+func decodeShortCode(code string) (*Config, error) {
+	body := strings.ToUpper(strings.TrimSpace(code))[len(shortCodePrefix):]
+	body = strings.NewReplacer("-", "", " ", "").Replace(body)
+	raw, err := crockfordDecode(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid short code: %w", err)
+	}
+	if len(raw) < 2+shortCodeSeedLen+1+shortCodeSumLen {
+		return nil, errors.New("invalid short code: too short")
+	}
+	payload, sum := raw[:len(raw)-shortCodeSumLen], raw[len(raw)-shortCodeSumLen:]
+	if want := sha256.Sum256(payload); !bytes.Equal(sum, want[:shortCodeSumLen]) {
+		return nil, errors.New("invalid short code: checksum mismatch (check for typos)")
+	}
+	if payload[0] > shortCodeVersion {
+		return nil, newCodedError(ErrorCodeConfigVersionUnsupported,
+			fmt.Sprintf("short code format v%d is newer than this telehand supports (v%d); please upgrade telehand", payload[0], shortCodeVersion))
+	}
+
+	r := bytes.NewReader(payload[1:])
+	truncated := errors.New("invalid short code: truncated")
+	flags, _ := r.ReadByte()
+	seed := make([]byte, shortCodeSeedLen)
+	if n, _ := r.Read(seed); n != shortCodeSeedLen {
+		return nil, truncated
+	}
+	name, err := readShortString(r)
+	if err != nil {
+		return nil, truncated
+	}
+	cfg := &Config{
+		Version:       pairingFormatVersion,
+		NetworkName:   "telehand:" + name,
+		NetworkSecret: deriveShortSecret(seed, "secret"),
+	}
+	if flags&shortFlagRawName != 0 {
+		cfg.NetworkName = name
+	}
+	if flags&shortFlagExpires != 0 {
+		var exp uint32
+		if err := binary.Read(r, binary.BigEndian, &exp); err != nil {
+			return nil, truncated
+		}
+		cfg.ExpiresAt = int64(exp)
+	}
+	if flags&shortFlagPermissions != 0 {
+		perms, err := r.ReadByte()
+		if err != nil {
+			return nil, truncated
+		}
+		for i, known := range knownPermissions {
+			if perms&(1<<i) != 0 {
+				cfg.Permissions = append(cfg.Permissions, known)
+			}
+		}
+	}
+	var extra []string
+	if flags&shortFlagPeers != 0 {
+		count, err := r.ReadByte()
+		if err != nil {
+			return nil, truncated
+		}
+		for i := 0; i < int(count); i++ {
+			p, err := readShortString(r)
+			if err != nil {
+				return nil, truncated
+			}
+			extra = append(extra, p)
+		}
+	}
+	cfg.Peers = mergePeerPools(normalizePeerPool(extra, MaxPeerCount, InvalidPeerDrop), defaultPeerPool(), MaxPeerCount)
+	if flags&shortFlagAPIToken != 0 {
+		cfg.APIToken = deriveShortSecret(seed, "api-token")
+	}
+	if flags&shortFlagOnce != 0 {
+		cfg.Nonce = deriveShortSecret(seed, "nonce")
+	}
+	if cfg.NetworkName == "" || len(cfg.Peers) == 0 {
+		return nil, errors.New("invalid short code: missing network name or peers")
+	}
+	return cfg, nil
+}
+
+// extraPeers is the part of peers a short code must spell out: everything
+// but the compiled DefaultPeers. The initiator's cached peer list may be
+// newer than the receiver's, or the receiver may have none at all.
+func extraPeers(peers []string) []string {
+	defaults := normalizePeerPool(DefaultPeers, MaxPeerCount, InvalidPeerDrop)
+	var extra []string
+	for _, p := range peers {
+		if !containsString(defaults, p) {
+			extra = append(extra, p)
+		}
+	}
+	return extra
+}
+
+func deriveShortSecret(seed []byte, purpose string) string {
+	sum := sha256.Sum256(append([]byte("telehand-short-code:"+purpose+":"), seed...))
+	return "telehand:" + hex.EncodeToString(sum[:16])
+}
+
+func readShortString(r *bytes.Reader) (string, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if got, _ := r.Read(b); got != int(n) {
+		return "", errors.New("truncated")
+	}
+	return string(b), nil
+}
+
+func groupShortCode(s string) string {
+	var groups []string
+	for len(s) > shortCodeGroupLen {
+		groups = append(groups, s[:shortCodeGroupLen])
+		s = s[shortCodeGroupLen:]
+	}
+	return strings.Join(append(groups, s), "-")
+}
+
+func crockfordEncode(data []byte) string {
+	var (
+		b     strings.Builder
+		acc   uint
+		nbits uint
+	)
+	for _, c := range data {
+		acc = acc<<8 | uint(c)
+		nbits += 8
+		for nbits >= 5 {
+			nbits -= 5
+			b.WriteByte(crockfordAlphabet[(acc>>nbits)&31])
+		}
+	}
+	if nbits > 0 {
+		b.WriteByte(crockfordAlphabet[(acc<<(5-nbits))&31])
+	}
+	return b.String()
+}
+
+func crockfordDecode(s string) ([]byte, error) {
+	var (
+		out   []byte
+		acc   uint
+		nbits uint
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case 'I', 'L':
+			c = '1'
+		case 'O':
+			c = '0'
+		}
+		v := strings.IndexByte(crockfordAlphabet, c)
+		if v < 0 {
+			return nil, fmt.Errorf("unexpected character %q", s[i])
+		}
+		acc = acc<<5 | uint(v)
+		nbits += 5
+		if nbits >= 8 {
+			nbits -= 8
+			out = append(out, byte(acc>>nbits))
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrockfordRoundTrip(t *testing.T) {
+	for _, data := range [][]byte{{0}, {0xff, 0x01}, []byte("telehand short code")} {
+		got, err := crockfordDecode(crockfordEncode(data))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("round trip %x: got %x (%v)", data, got, err)
+		}
+	}
+}
+
+func TestShortCodeWithDefaults(t *testing.T) {
+	orig := hostnameReader
+	hostnameReader = func() (string, error) { return "my-host", nil }
+	t.Cleanup(func() { hostnameReader = orig })
+
+	code, cfg, err := buildEncodedConfigWithDefaults("", "", "", nil, pairingOptions{Short: true})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if !strings.HasPrefix(code, shortCodePrefix) || len(code) > 48 {
+		t.Fatalf("unexpected short code %q (%d chars)", code, len(code))
+	}
+	decoded, err := decodeConfigWithValidation(code)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.NetworkName != "telehand:my-host" || decoded.NetworkSecret != cfg.NetworkSecret || !reflect.DeepEqual(decoded.Peers, cfg.Peers) {
+		t.Fatalf("decoded %+v, minted %+v", decoded, cfg)
+	}
+
+	// Typed by hand: lower case, no dashes, O for 0 and spaces.
+	typed := strings.ToLower(strings.ReplaceAll(code[len(shortCodePrefix):], "-", " "))
+	typed = "th-" + strings.ReplaceAll(typed, "0", "o")
+	if again, err := DecodeConfig(typed); err != nil || again.NetworkSecret != cfg.NetworkSecret {
+		t.Fatalf("hand-typed code rejected: %v", err)
+	}
+}
+
+func TestShortCodeCarriesEnvelope(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	cfg := &Config{
+		NetworkName: "team-net",
+		Peers:       append([]string{"udp://9.9.9.9:11010"}, defaultPeerPool()...),
+		ExpiresAt:   exp,
+		Permissions: []string{PermissionRead, PermissionExec},
+		APIToken:    "placeholder",
+		Nonce:       "placeholder",
+	}
+	code, err := mintShortCode(cfg)
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if cfg.APIToken == "placeholder" || cfg.Nonce == "placeholder" || cfg.NetworkSecret == "" {
+		t.Fatalf("secret and token should be derived: %+v", cfg)
+	}
+	decoded, err := decodeShortCode(code)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.NetworkName != "team-net" || decoded.ExpiresAt != exp || decoded.APIToken != cfg.APIToken || decoded.Nonce != cfg.Nonce ||
+		!reflect.DeepEqual(decoded.Permissions, cfg.Permissions) || !reflect.DeepEqual(decoded.Peers, cfg.Peers) {
+		t.Fatalf("decoded %+v, minted %+v", decoded, cfg)
+	}
+}
+
+func TestShortCodeRejectsTyposAndExpiry(t *testing.T) {
+	code, err := mintShortCode(&Config{NetworkName: "telehand:h", Peers: defaultPeerPool(), ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if _, err := decodeConfigWithValidation(code); errorCodeOf(err) != ErrorCodeConfigExpired {
+		t.Fatalf("expected expired, got %v", err)
+	}
+
+	fresh, err := mintShortCode(&Config{NetworkName: "telehand:h", Peers: defaultPeerPool()})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	i := len(shortCodePrefix) + 1
+	swap := byte('A')
+	if fresh[i] == 'A' {
+		swap = 'B'
+	}
+	if _, err := decodeShortCode(fresh[:i] + string(swap) + fresh[i+1:]); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	if _, err := mintShortCode(&Config{NetworkName: "n", Peers: defaultPeerPool(), Signer: "x"}); err == nil {
+		t.Fatal("signed config must not be shortened silently")
+	}
+}
+
+func TestShortCodeSpellsOutCachedPeers(t *testing.T) {
+	// The initiator has a refreshed peer list, the receiver only the
+	// compiled defaults: the code must carry the cached peer itself.
+	dir := withTempConfigDir(t)
+	key := testPeerListKey(1)
+	withPeerListKeys(t, dir, key)
+	mustWriteFile(t, filepath.Join(dir, peerListFile), string(mustSignPeerList(t, key, time.Now(), "tcp://10.9.8.7:11010")))
+
+	code, cfg, err := buildEncodedConfigWithDefaults("team-net", "", "", nil, pairingOptions{Short: true})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if !containsString(cfg.Peers, "tcp://10.9.8.7:11010") {
+		t.Fatalf("initiator pool should include the cached peer: %v", cfg.Peers)
+	}
+
+	withTempConfigDir(t)
+	decoded, err := decodeConfigWithValidation(code)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, p := range cfg.Peers {
+		if !containsString(decoded.Peers, p) {
+			t.Fatalf("receiver lost peer %s: got %v, minted %v", p, decoded.Peers, cfg.Peers)
+		}
+	}
+}
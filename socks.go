@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SOCKS5 egress: the receiver runs an RFC 1928 server on its virtual IP that
+// only accepts username/password auth (RFC 1929) with the session token as
+// password. The initiator's `connect --socks` listener accepts local clients
+// without auth and performs that handshake upstream on their behalf.
+const (
+	socksVersion        = 0x05
+	socksAuthNone       = 0x00
+	socksAuthPassword   = 0x02
+	socksAuthNoMethods  = 0xff
+	socksCmdConnect     = 0x01
+	socksAtypIPv4       = 0x01
+	socksAtypDomain     = 0x03
+	socksAtypIPv6       = 0x04
+	socksUser           = "telehand"
+	socksDefaultPort    = 1080
+	socksHandshakeLimit = 10 * time.Second
+)
+
+// SOCKS5 reply codes.
+const (
+	socksReplyOK              = 0x00
+	socksReplyFailure         = 0x01
+	socksReplyNetUnreachable  = 0x03
+	socksReplyHostUnreachable = 0x04
+	socksReplyRefused         = 0x05
+	socksReplyCmdUnsupported  = 0x07
+	socksReplyAtypUnsupported = 0x08
+)
+
+type socksServer struct {
+	ln    net.Listener
+	token string
+	logf  func(method, path, summary string)
+	wg    sync.WaitGroup
+}
+
+func startSocksServer(addr, token string, logf func(method, path, summary string)) (*socksServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &socksServer{ln: ln, token: token, logf: logf}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s, nil
+}
+
+func (s *socksServer) Addr() string { return s.ln.Addr().String() }
+
+func (s *socksServer) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *socksServer) handle(conn net.Conn) {
+	client := conn.RemoteAddr().String()
+	conn.SetDeadline(time.Now().Add(socksHandshakeLimit))
+	methods, err := readSocksGreeting(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if !methods[socksAuthPassword] {
+		conn.Write([]byte{socksVersion, socksAuthNoMethods})
+		conn.Close()
+		return
+	}
+	conn.Write([]byte{socksVersion, socksAuthPassword})
+	_, pass, err := readSocksPassword(conn)
+	if err != nil || subtle.ConstantTimeCompare([]byte(pass), []byte(s.token)) != 1 {
+		conn.Write([]byte{0x01, 0x01})
+		conn.Close()
+		s.logf("SOCKS", "/socks", "auth failed from "+client)
+		return
+	}
+	conn.Write([]byte{0x01, 0x00})
+
+	dest, cmd, err := readSocksRequest(conn)
+	if err != nil {
+		code := byte(socksReplyFailure)
+		if errors.Is(err, errSocksAtyp) {
+			code = socksReplyAtypUnsupported
+		}
+		writeSocksReply(conn, code, nil)
+		conn.Close()
+		return
+	}
+	if cmd != socksCmdConnect {
+		writeSocksReply(conn, socksReplyCmdUnsupported, nil)
+		conn.Close()
+		return
+	}
+	target, err := net.DialTimeout("tcp", dest, socksHandshakeLimit)
+	if err != nil {
+		writeSocksReply(conn, socksDialReply(err), nil)
+		conn.Close()
+		s.logf("SOCKS", "/socks", fmt.Sprintf("%s failed: %v", dest, err))
+		return
+	}
+	if err := writeSocksReply(conn, socksReplyOK, target.LocalAddr()); err != nil {
+		target.Close()
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	s.logf("SOCKS", "/socks", dest+" from "+client)
+	pipeConns(conn, target)
+}
+
+// startSessionSocks starts the SOCKS5 side that fits role for one running
+// round and returns the receiver port to advertise plus a stop function.
+func startSessionSocks(opts sessionOptions, role, token, virtIP, peerIP string, apiPort int, logf func(method, path, summary string)) (int, func()) {
+	switch {
+	case role == "server" && opts.SocksPort > 0:
+		srv, err := startSocksServer(net.JoinHostPort(virtIP, strconv.Itoa(opts.SocksPort)), token, logf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "SOCKS5 server failed: %v\n", err)
+			return 0, func() {}
+		}
+		fmt.Printf("SOCKS5 server listening on %s\n", srv.Addr())
+		return opts.SocksPort, srv.Close
+	case role == "client" && opts.SocksListen != "":
+		relay, err := startSocksRelay(opts.SocksListen, token, socksUpstreamFromHealth(peerIP, apiPort), func(format string, args ...any) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "SOCKS5 proxy failed: %v\n", err)
+			return 0, func() {}
+		}
+		fmt.Printf("SOCKS5 proxy listening on %s (exits via %s)\n", relay.Addr(), peerIP)
+		return 0, relay.Close
+	}
+	return 0, func() {}
+}
+
+// socksRelay is the initiator-side listener: local applications speak
+// unauthenticated SOCKS5 to it and it authenticates to the receiver.
+type socksRelay struct {
+	ln       net.Listener
+	token    string
+	upstream func() (string, error)
+	logf     func(format string, args ...any)
+}
+
+func startSocksRelay(listen, token string, upstream func() (string, error), logf func(format string, args ...any)) (*socksRelay, error) {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+	r := &socksRelay{ln: ln, token: token, upstream: upstream, logf: logf}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.handle(conn)
+		}
+	}()
+	return r, nil
+}
+
+func (r *socksRelay) Addr() string { return r.ln.Addr().String() }
+
+func (r *socksRelay) Close() { r.ln.Close() }
+
+func (r *socksRelay) handle(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(socksHandshakeLimit))
+	methods, err := readSocksGreeting(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if !methods[socksAuthNone] {
+		conn.Write([]byte{socksVersion, socksAuthNoMethods})
+		conn.Close()
+		return
+	}
+	conn.Write([]byte{socksVersion, socksAuthNone})
+
+	up, err := r.dialUpstream()
+	if err != nil {
+		r.logf("SOCKS5 upstream failed: %v", err)
+		// Answer the pending request so the client sees a clean failure.
+		if _, _, reqErr := readSocksRequest(conn); reqErr == nil {
+			writeSocksReply(conn, socksReplyNetUnreachable, nil)
+		}
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	// The client's request and the receiver's reply pass through unchanged.
+	pipeConns(conn, up)
+}
+
+func (r *socksRelay) dialUpstream() (net.Conn, error) {
+	addr, err := r.upstream()
+	if err != nil {
+		return nil, err
+	}
+	up, err := net.DialTimeout("tcp", addr, socksHandshakeLimit)
+	if err != nil {
+		return nil, err
+	}
+	up.SetDeadline(time.Now().Add(socksHandshakeLimit))
+	fail := func(err error) (net.Conn, error) {
+		up.Close()
+		return nil, err
+	}
+	if _, err := up.Write([]byte{socksVersion, 1, socksAuthPassword}); err != nil {
+		return fail(err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(up, reply); err != nil {
+		return fail(err)
+	}
+	if reply[1] != socksAuthPassword {
+		return fail(fmt.Errorf("receiver refused password auth"))
+	}
+	auth := []byte{0x01, byte(len(socksUser))}
+	auth = append(auth, socksUser...)
+	auth = append(auth, byte(len(r.token)))
+	auth = append(auth, r.token...)
+	if _, err := up.Write(auth); err != nil {
+		return fail(err)
+	}
+	if _, err := io.ReadFull(up, reply); err != nil {
+		return fail(err)
+	}
+	if reply[1] != 0x00 {
+		return fail(fmt.Errorf("receiver rejected the session token"))
+	}
+	up.SetDeadline(time.Time{})
+	return up, nil
+}
+
+// socksUpstreamFromHealth discovers the receiver's SOCKS5 port from its
+// /health and caches it for the session.
+func socksUpstreamFromHealth(peerIP string, apiPort int) func() (string, error) {
+	var (
+		mu     sync.Mutex
+		cached string
+	)
+	client := &http.Client{Timeout: 5 * time.Second}
+	return func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if cached != "" {
+			return cached, nil
+		}
+		if peerIP == "" {
+			return "", errors.New("receiver virtual IP is unknown")
+		}
+		health, err := fetchPeerHealth(context.Background(), client, peerIP, apiPort)
+		if err != nil {
+			return "", err
+		}
+		if health.SocksPort == 0 {
+			return "", errors.New("SOCKS5 is not enabled on the receiver (start it with serve --socks)")
+		}
+		cached = net.JoinHostPort(peerIP, strconv.Itoa(health.SocksPort))
+		return cached, nil
+	}
+}
+
+func readSocksGreeting(r io.Reader) (map[byte]bool, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if head[0] != socksVersion {
+		return nil, fmt.Errorf("unsupported SOCKS version %d", head[0])
+	}
+	list := make([]byte, head[1])
+	if _, err := io.ReadFull(r, list); err != nil {
+		return nil, err
+	}
+	methods := make(map[byte]bool, len(list))
+	for _, m := range list {
+		methods[m] = true
+	}
+	return methods, nil
+}
+
+func readSocksPassword(r io.Reader) (string, string, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return "", "", err
+	}
+	if head[0] != 0x01 {
+		return "", "", fmt.Errorf("unsupported auth version %d", head[0])
+	}
+	user := make([]byte, head[1])
+	if _, err := io.ReadFull(r, user); err != nil {
+		return "", "", err
+	}
+	n := make([]byte, 1)
+	if _, err := io.ReadFull(r, n); err != nil {
+		return "", "", err
+	}
+	pass := make([]byte, n[0])
+	if _, err := io.ReadFull(r, pass); err != nil {
+		return "", "", err
+	}
+	return string(user), string(pass), nil
+}
+
+var errSocksAtyp = errors.New("unsupported address type")
+
+// readSocksRequest returns the destination as host:port and the command.
+func readSocksRequest(r io.Reader) (string, byte, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return "", 0, err
+	}
+	if head[0] != socksVersion {
+		return "", 0, fmt.Errorf("unsupported SOCKS version %d", head[0])
+	}
+	var host string
+	switch head[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		ip := make([]byte, net.IPv4len)
+		if head[3] == socksAtypIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", 0, err
+		}
+		host = net.IP(ip).String()
+	case socksAtypDomain:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(r, n); err != nil {
+			return "", 0, err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", 0, err
+		}
+		host = string(name)
+	default:
+		return "", 0, errSocksAtyp
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", 0, err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), head[1], nil
+}
+
+func writeSocksReply(w io.Writer, code byte, bound net.Addr) error {
+	reply := []byte{socksVersion, code, 0x00, socksAtypIPv4, 0, 0, 0, 0, 0, 0}
+	if tcp, ok := bound.(*net.TCPAddr); ok {
+		if ip4 := tcp.IP.To4(); ip4 != nil {
+			copy(reply[4:8], ip4)
+		} else {
+			reply = append([]byte{socksVersion, code, 0x00, socksAtypIPv6}, tcp.IP.To16()...)
+			reply = append(reply, 0, 0)
+		}
+		binary.BigEndian.PutUint16(reply[len(reply)-2:], uint16(tcp.Port))
+	}
+	_, err := w.Write(reply)
+	return err
+}
+
+func socksDialReply(err error) byte {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return socksReplyHostUnreachable
+	case errors.As(err, &opErr) && opErr.Timeout():
+		return socksReplyHostUnreachable
+	case errors.As(err, &opErr):
+		return socksReplyRefused
+	default:
+		return socksReplyFailure
+	}
+}
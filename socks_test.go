@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// socksConnect performs an unauthenticated SOCKS5 CONNECT by domain name and
+// returns the connection and reply code.
+func socksConnect(t *testing.T, proxy, host string, port int) (net.Conn, byte) {
+	t.Helper()
+	c, err := net.DialTimeout("tcp", proxy, 3*time.Second)
+	if err != nil {
+		t.Fatalf("dial proxy failed: %v", err)
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	c.Write([]byte{socksVersion, 1, socksAuthNone})
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(c, reply); err != nil || reply[1] != socksAuthNone {
+		t.Fatalf("greeting failed: reply=%v err=%v", reply, err)
+	}
+	req := []byte{socksVersion, socksCmdConnect, 0x00, socksAtypDomain, byte(len(host))}
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	c.Write(req)
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(c, head); err != nil {
+		t.Fatalf("read connect reply failed: %v", err)
+	}
+	return c, head[1]
+}
+
+func TestSocksRelayThroughServer(t *testing.T) {
+	const token = "0123456789abcdef"
+	var (
+		mu   sync.Mutex
+		logs []string
+	)
+	srv, err := startSocksServer("127.0.0.1:0", token, func(method, path, summary string) {
+		mu.Lock()
+		logs = append(logs, method+" "+summary)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("start socks server failed: %v", err)
+	}
+	defer srv.Close()
+	relay, err := startSocksRelay("127.0.0.1:0", token, func() (string, error) { return srv.Addr(), nil }, t.Logf)
+	if err != nil {
+		t.Fatalf("start socks relay failed: %v", err)
+	}
+	defer relay.Close()
+
+	echo := startEchoServer(t, "intranet")
+	_, portStr, _ := net.SplitHostPort(echo.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	c, code := socksConnect(t, relay.Addr(), "localhost", port)
+	if code != socksReplyOK {
+		t.Fatalf("connect reply=%d, want ok", code)
+	}
+	io.WriteString(c, "hello")
+	c.(*net.TCPConn).CloseWrite()
+	out, _ := io.ReadAll(c)
+	c.Close()
+	if string(out) != "intranet:hello" {
+		t.Fatalf("proxied response mismatch: got=%q", out)
+	}
+	mu.Lock()
+	joined := strings.Join(logs, "\n")
+	mu.Unlock()
+	if !strings.Contains(joined, "SOCKS localhost:"+portStr+" from ") {
+		t.Fatalf("destination should be logged, got %q", joined)
+	}
+
+	// A relay holding the wrong token must not get through.
+	bad, err := startSocksRelay("127.0.0.1:0", "wrong", func() (string, error) { return srv.Addr(), nil }, t.Logf)
+	if err != nil {
+		t.Fatalf("start socks relay failed: %v", err)
+	}
+	defer bad.Close()
+	c, code = socksConnect(t, bad.Addr(), "localhost", port)
+	c.Close()
+	if code != socksReplyNetUnreachable {
+		t.Fatalf("wrong token reply=%d, want %d", code, socksReplyNetUnreachable)
+	}
+}
+
+func TestSocksServerRequiresPasswordAuth(t *testing.T) {
+	srv, err := startSocksServer("127.0.0.1:0", "token", func(string, string, string) {})
+	if err != nil {
+		t.Fatalf("start socks server failed: %v", err)
+	}
+	defer srv.Close()
+	c, err := net.Dial("tcp", srv.Addr())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(3 * time.Second))
+	c.Write([]byte{socksVersion, 1, socksAuthNone})
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(c, reply); err != nil || reply[1] != socksAuthNoMethods {
+		t.Fatalf("no-auth should be refused: reply=%v err=%v", reply, err)
+	}
+}
+
+func TestSocksUpstreamFromHealth(t *testing.T) {
+	port := 0
+	s := NewAPIServer("127.0.0.1", 20780, nil, func() HealthResp {
+		return HealthResp{Status: "ok", SocksPort: port}
+	}, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+
+	if _, err := socksUpstreamFromHealth("127.0.0.1", s.Port())(); err == nil || !strings.Contains(err.Error(), "--socks") {
+		t.Fatalf("disabled SOCKS5 should be reported: %v", err)
+	}
+	port = 1080
+	addr, err := socksUpstreamFromHealth("127.0.0.1", s.Port())()
+	if err != nil || addr != "127.0.0.1:1080" {
+		t.Fatalf("upstream mismatch: addr=%s err=%v", addr, err)
+	}
+}
+
+func TestSessionTokenIsStablePerNetwork(t *testing.T) {
+	a := sessionToken("net", "secret")
+	if a != sessionToken(" net ", "secret") || len(a) != 32 {
+		t.Fatalf("session token should be stable 32 hex chars: %q", a)
+	}
+	if a == sessionToken("net", "other") {
+		t.Fatalf("session token must depend on the secret")
+	}
+}
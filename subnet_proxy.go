@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	subnetFetchAttempts = 5
+	subnetFetchRetry    = 2 * time.Second
+	subnetFetchTimeout  = 5 * time.Second
+
+	// minSubnetPrefix rejects 0.0.0.0/1 + 128.0.0.0/1 style splits that
+	// would capture the initiator's whole internet traffic.
+	minSubnetPrefix = 8
+)
+
+// lanSubnetRanges are the only ranges a subnet route may fall in: RFC 1918
+// private networks and IPv4 link-local.
+var lanSubnetRanges = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0).To4(), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0).To4(), Mask: net.CIDRMask(16, 32)},
+	{IP: net.IPv4(169, 254, 0, 0).To4(), Mask: net.CIDRMask(16, 32)},
+}
+
+// parseLANSubnet parses an IPv4 CIDR that lies entirely inside a private
+// or link-local range and is at least a /8.
+func parseLANSubnet(raw string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(raw))
+	if err != nil || ipNet.IP.To4() == nil {
+		return nil, fmt.Errorf("invalid subnet %q: want an IPv4 CIDR like 192.168.1.0/24", raw)
+	}
+	ones, _ := ipNet.Mask.Size()
+	if ones < minSubnetPrefix {
+		return nil, fmt.Errorf("invalid subnet %q: prefix shorter than /%d", raw, minSubnetPrefix)
+	}
+	if !subnetWithin(ipNet, lanSubnetRanges) {
+		return nil, fmt.Errorf("invalid subnet %q: not a private or link-local range", raw)
+	}
+	return ipNet, nil
+}
+
+// subnetWithin reports whether subnet lies entirely inside one of ranges.
+func subnetWithin(subnet *net.IPNet, ranges []*net.IPNet) bool {
+	ones, _ := subnet.Mask.Size()
+	for _, r := range ranges {
+		if rOnes, _ := r.Mask.Size(); rOnes <= ones && r.Contains(subnet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExposedSubnets validates serve --expose-subnet and connect
+// --accept-subnet values and returns them in canonical network form
+// without duplicates.
+func parseExposedSubnets(raw []string) ([]string, error) {
+	out := make([]string, 0, len(raw))
+	seen := map[string]bool{}
+	for _, item := range raw {
+		ipNet, err := parseLANSubnet(item)
+		if err != nil {
+			return nil, err
+		}
+		if key := ipNet.String(); !seen[key] {
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	return out, nil
+}
+
+// exposedSubnetsForRole keeps --expose-subnet to the receiver side.
+func exposedSubnetsForRole(role string, subnets []string) []string {
+	if role != "server" {
+		return nil
+	}
+	return subnets
+}
+
+// fetchPeerHealth reads the peer's /health over the virtual network.
+func fetchPeerHealth(ctx context.Context, client *http.Client, peerIP string, apiPort int) (HealthResp, error) {
+	var health HealthResp
+	url := fmt.Sprintf("http://%s/health", net.JoinHostPort(peerIP, strconv.Itoa(apiPort)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return health, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return health, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return health, fmt.Errorf("invalid /health response: %w", err)
+	}
+	return health, nil
+}
+
+// exposedSubnetConflict explains why routing subnet through the TUN device
+// would shadow something this machine already reaches, or returns "".
+// Less specific routes (the default route, a wide corporate range) are
+// fine because the new prefix simply wins for its own addresses.
+func exposedSubnetConflict(subnet *net.IPNet, localNets, routeNets []*net.IPNet) string {
+	for _, n := range localNets {
+		if n != nil && overlapsAny(subnet, []*net.IPNet{n}) {
+			return "local_net=" + n.String()
+		}
+	}
+	ones, _ := subnet.Mask.Size()
+	for _, n := range routeNets {
+		if n == nil {
+			continue
+		}
+		if routeOnes, _ := n.Mask.Size(); routeOnes >= ones && overlapsAny(subnet, []*net.IPNet{n}) {
+			return "route=" + n.String()
+		}
+	}
+	return ""
+}
+
+// installExposedSubnets routes the receiver's exposed subnets through the
+// TUN device and returns the ones it added, so only those get removed.
+// The receiver decides what it advertises, so a subnet is only routed
+// when it is a LAN range inside one the initiator accepted.
+func installExposedSubnets(subnets, accepted []string, tunDevice string, deps sessionDeps, logf func(string)) []string {
+	var acceptNets []*net.IPNet
+	for _, cidr := range accepted {
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			acceptNets = append(acceptNets, n)
+		}
+	}
+	localNets, err := collectLocalIPv4NetsFn()
+	if err != nil {
+		logf(fmt.Sprintf("[telehand] subnet routes: local nets unavailable: %v", err))
+	}
+	routeNets, err := collectRouteIPv4NetsFn()
+	if err != nil {
+		logf(fmt.Sprintf("[telehand] subnet routes: route table unavailable: %v", err))
+	}
+
+	var installed []string
+	for _, cidr := range subnets {
+		subnet, err := parseLANSubnet(cidr)
+		if err != nil {
+			logf(fmt.Sprintf("[telehand] subnet route skipped: subnet=%s reason=invalid err=%v", cidr, err))
+			continue
+		}
+		if !subnetWithin(subnet, acceptNets) {
+			logf(fmt.Sprintf("[telehand] subnet route skipped: subnet=%s reason=not_accepted (connect --accept-subnet %s)", subnet, subnet))
+			continue
+		}
+		// EasyTier may already have routed the peer's proxy networks into
+		// the TUN device; that is the desired state, not a conflict.
+		if deps.routeInterfaceForTarget != nil {
+			if iface, err := deps.routeInterfaceForTarget(subnet.IP.String()); err == nil && strings.EqualFold(strings.TrimSpace(iface), strings.TrimSpace(tunDevice)) {
+				logf(fmt.Sprintf("[telehand] subnet route present: subnet=%s tun_if=%s", subnet, tunDevice))
+				continue
+			}
+		}
+		if reason := exposedSubnetConflict(subnet, localNets, routeNets); reason != "" {
+			logf(fmt.Sprintf("[telehand] subnet route skipped: subnet=%s conflict %s", subnet, reason))
+			continue
+		}
+		if err := deps.addSubnetRoute(subnet.String(), tunDevice); err != nil {
+			logf(fmt.Sprintf("[telehand] subnet route failed: subnet=%s err=%v", subnet, err))
+			continue
+		}
+		logf(fmt.Sprintf("[telehand] subnet route bound: subnet=%s tun_if=%s", subnet, tunDevice))
+		installed = append(installed, subnet.String())
+	}
+	return installed
+}
+
+// startSessionSubnetRoutes asks the receiver which subnets it exposes and
+// routes the accepted ones locally for one running round. report receives
+// the advertised list (nil once stopped). The returned stop function
+// removes the routes this round installed.
+func startSessionSubnetRoutes(role, peerIP string, apiPort int, tunDevice string, accepted []string, deps sessionDeps, logf func(string), report func([]string)) func() {
+	if role != "client" || peerIP == "" || deps.addSubnetRoute == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var installed []string
+	go func() {
+		defer close(done)
+		client := &http.Client{Timeout: subnetFetchTimeout}
+		for attempt := 0; attempt < subnetFetchAttempts; attempt++ {
+			health, err := fetchPeerHealth(ctx, client, peerIP, apiPort)
+			if err == nil {
+				if len(health.ExposedSubnets) > 0 {
+					report(health.ExposedSubnets)
+					installed = installExposedSubnets(health.ExposedSubnets, accepted, tunDevice, deps, logf)
+				}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(subnetFetchRetry):
+			}
+		}
+		logf(fmt.Sprintf("[telehand] subnet routes: receiver /health unavailable at %s", peerIP))
+	}()
+	return func() {
+		cancel()
+		<-done
+		if deps.removeSubnetRoute != nil {
+			for _, cidr := range installed {
+				_ = deps.removeSubnetRoute(cidr, tunDevice)
+			}
+		}
+		report(nil)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mustCIDR(t *testing.T, raw string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(raw)
+	if err != nil {
+		t.Fatalf("parse %s: %v", raw, err)
+	}
+	return n
+}
+
+func TestParseExposedSubnets(t *testing.T) {
+	got, err := parseExposedSubnets([]string{"192.168.1.7/24", " 10.8.0.0/16", "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []string{"192.168.1.0/24", "10.8.0.0/16"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	if _, err := parseExposedSubnets([]string{"10.0.0.0/8", "172.16.0.0/12", "169.254.10.0/24"}); err != nil {
+		t.Fatalf("private and link-local ranges should be accepted: %v", err)
+	}
+	for _, bad := range []string{"192.168.1.0", "fd00::/64", "0.0.0.0/0", "lan",
+		"0.0.0.0/1", "128.0.0.0/1", "8.0.0.0/7", "10.0.0.0/7", "8.8.8.0/24", "172.32.0.0/16", "100.64.0.0/10"} {
+		if _, err := parseExposedSubnets([]string{bad}); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestExposedSubnetConflict(t *testing.T) {
+	subnet := mustCIDR(t, "192.168.1.0/24")
+	cases := []struct {
+		name   string
+		local  []*net.IPNet
+		routes []*net.IPNet
+		want   string
+	}{
+		{name: "clear", local: []*net.IPNet{mustCIDR(t, "10.0.0.0/24")}, routes: []*net.IPNet{mustCIDR(t, "0.0.0.0/0")}},
+		{name: "same lan", local: []*net.IPNet{mustCIDR(t, "192.168.1.20/24")}, want: "local_net=192.168.1.0/24"},
+		{name: "wider lan", local: []*net.IPNet{mustCIDR(t, "192.168.0.0/16")}, want: "local_net=192.168.0.0/16"},
+		{name: "more specific route", routes: []*net.IPNet{mustCIDR(t, "192.168.1.128/25")}, want: "route=192.168.1.128/25"},
+		{name: "identical route", routes: []*net.IPNet{mustCIDR(t, "192.168.1.0/24")}, want: "route=192.168.1.0/24"},
+		{name: "less specific route", routes: []*net.IPNet{mustCIDR(t, "192.168.0.0/16")}},
+	}
+	for _, tc := range cases {
+		if got := exposedSubnetConflict(subnet, tc.local, tc.routes); got != tc.want {
+			t.Fatalf("%s: got %q want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestInstallExposedSubnetsSkipsConflicts(t *testing.T) {
+	oldLocal, oldRoutes := collectLocalIPv4NetsFn, collectRouteIPv4NetsFn
+	defer func() { collectLocalIPv4NetsFn, collectRouteIPv4NetsFn = oldLocal, oldRoutes }()
+	collectLocalIPv4NetsFn = func() ([]*net.IPNet, error) {
+		return []*net.IPNet{mustCIDR(t, "192.168.1.0/24")}, nil
+	}
+	collectRouteIPv4NetsFn = func() ([]*net.IPNet, error) {
+		return []*net.IPNet{mustCIDR(t, "0.0.0.0/0")}, nil
+	}
+
+	var added []string
+	deps := sessionDeps{
+		routeInterfaceForTarget: func(ip string) (string, error) {
+			if ip == "172.16.5.0" {
+				return "tun0", nil
+			}
+			return "eth0", nil
+		},
+		addSubnetRoute: func(cidr, tun string) error {
+			if tun != "tun0" {
+				t.Fatalf("unexpected tun %s", tun)
+			}
+			if cidr == "10.9.0.0/16" {
+				return errors.New("denied")
+			}
+			added = append(added, cidr)
+			return nil
+		},
+	}
+	var logs []string
+	installed := installExposedSubnets([]string{"192.168.1.0/24", "10.8.0.0/16", "172.16.5.0/24", "10.9.0.0/16"}, []string{"10.0.0.0/8", "172.16.0.0/12"}, "tun0", deps, func(msg string) {
+		logs = append(logs, msg)
+	})
+	if want := []string{"10.8.0.0/16"}; !reflect.DeepEqual(installed, want) || !reflect.DeepEqual(added, want) {
+		t.Fatalf("installed=%v added=%v want %v (logs=%v)", installed, added, want, logs)
+	}
+	if len(logs) != 4 {
+		t.Fatalf("expected one log line per subnet, got %v", logs)
+	}
+}
+
+func TestInstallExposedSubnetsNeedsAcceptedLANRange(t *testing.T) {
+	oldLocal, oldRoutes := collectLocalIPv4NetsFn, collectRouteIPv4NetsFn
+	defer func() { collectLocalIPv4NetsFn, collectRouteIPv4NetsFn = oldLocal, oldRoutes }()
+	collectLocalIPv4NetsFn = func() ([]*net.IPNet, error) { return nil, nil }
+	collectRouteIPv4NetsFn = func() ([]*net.IPNet, error) {
+		return []*net.IPNet{mustCIDR(t, "0.0.0.0/0")}, nil
+	}
+
+	var added []string
+	deps := sessionDeps{addSubnetRoute: func(cidr, tun string) error {
+		added = append(added, cidr)
+		return nil
+	}}
+	// A hostile receiver advertising the internet in halves, a public
+	// range and a LAN the initiator never asked for.
+	advertised := []string{"0.0.0.0/1", "128.0.0.0/1", "8.8.8.0/24", "192.168.9.0/24", "192.168.1.0/24"}
+	var logs []string
+	logf := func(msg string) { logs = append(logs, msg) }
+
+	if got := installExposedSubnets(advertised, nil, "tun0", deps, logf); len(got) != 0 || len(added) != 0 {
+		t.Fatalf("nothing should be routed without --accept-subnet, got %v", added)
+	}
+	installed := installExposedSubnets(advertised, []string{"192.168.1.0/24"}, "tun0", deps, logf)
+	if want := []string{"192.168.1.0/24"}; !reflect.DeepEqual(installed, want) || !reflect.DeepEqual(added, want) {
+		t.Fatalf("installed=%v added=%v want %v (logs=%v)", installed, added, want, logs)
+	}
+	if !strings.Contains(strings.Join(logs, "\n"), "subnet=0.0.0.0/1 reason=invalid") {
+		t.Fatalf("wide split should be logged as invalid: %v", logs)
+	}
+}
+
+func TestSessionSubnetRoutesFollowReceiverHealth(t *testing.T) {
+	oldLocal, oldRoutes := collectLocalIPv4NetsFn, collectRouteIPv4NetsFn
+	defer func() { collectLocalIPv4NetsFn, collectRouteIPv4NetsFn = oldLocal, oldRoutes }()
+	collectLocalIPv4NetsFn = func() ([]*net.IPNet, error) { return nil, nil }
+	collectRouteIPv4NetsFn = func() ([]*net.IPNet, error) { return nil, nil }
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(HealthResp{Status: "ok", ExposedSubnets: []string{"192.168.50.0/24"}})
+	}))
+	defer srv.Close()
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	var (
+		mu       sync.Mutex
+		routes   = map[string]bool{}
+		reported [][]string
+	)
+	deps := sessionDeps{
+		addSubnetRoute: func(cidr, tun string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			routes[cidr] = true
+			return nil
+		},
+		removeSubnetRoute: func(cidr, tun string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(routes, cidr)
+			return nil
+		},
+	}
+	report := func(subnets []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, subnets)
+	}
+
+	startSessionSubnetRoutes("server", host, port, "tun0", []string{"192.168.0.0/16"}, deps, func(string) {}, report)()
+	if len(reported) != 0 {
+		t.Fatalf("receiver must not install routes, got reports %v", reported)
+	}
+
+	stop := startSessionSubnetRoutes("client", host, port, "tun0", []string{"192.168.0.0/16"}, deps, func(string) {}, report)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		ok := routes["192.168.50.0/24"]
+		mu.Unlock()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subnet route was not installed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	stop()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(routes) != 0 {
+		t.Fatalf("routes left after stop: %v", routes)
+	}
+	want := [][]string{{"192.168.50.0/24"}, nil}
+	if !reflect.DeepEqual(reported, want) {
+		t.Fatalf("reported %v want %v", reported, want)
+	}
+}
+
+func TestDarwinRouteArgsForPrefix(t *testing.T) {
+	if darwinRouteKind("10.0.0.2/32") != "-host" || darwinRouteTarget("10.0.0.2/32") != "10.0.0.2" {
+		t.Fatalf("host prefix should map to -host a.b.c.d")
+	}
+	if darwinRouteKind("192.168.1.0/24") != "-net" || darwinRouteTarget("192.168.1.0/24") != "192.168.1.0/24" {
+		t.Fatalf("subnet prefix should map to -net cidr")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	SyncDefaultBlockSize = 64 * 1024
+	SyncMaxBlockSize     = 8 * 1024 * 1024
+)
+
+type SyncEntry struct {
+	Path   string   `json:"path"`
+	IsDir  bool     `json:"is_dir"`
+	Size   int64    `json:"size"`
+	Mtime  int64    `json:"mtime"`
+	Mode   uint32   `json:"mode"`
+	Hash   string   `json:"hash,omitempty"`
+	Blocks []string `json:"blocks,omitempty"`
+}
+
+type SyncManifest struct {
+	Root      string      `json:"root"`
+	Exists    bool        `json:"exists"`
+	BlockSize int         `json:"block_size,omitempty"`
+	Entries   []SyncEntry `json:"entries"`
+}
+
+// buildSyncManifest walks root and describes every regular file and directory
+// below it. Paths are relative to root and always use forward slashes so that
+// manifests from Windows and Unix peers can be compared directly.
+func buildSyncManifest(root string, excludes []string, blockSize int) (SyncManifest, error) {
+	manifest := SyncManifest{Root: root, Entries: []SyncEntry{}}
+	if blockSize > SyncMaxBlockSize {
+		blockSize = SyncMaxBlockSize
+	}
+	if blockSize > 0 {
+		manifest.BlockSize = blockSize
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return manifest, err
+	}
+	if !info.IsDir() {
+		return manifest, fmt.Errorf("%s is not a directory", root)
+	}
+	manifest.Exists = true
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if matchSyncExclude(rel, d.IsDir(), excludes) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			// Symlinks, sockets and devices are not synchronized.
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := SyncEntry{
+			Path:  rel,
+			IsDir: d.IsDir(),
+			Mtime: fi.ModTime().Unix(),
+			Mode:  uint32(fi.Mode().Perm()),
+		}
+		if !d.IsDir() {
+			entry.Size = fi.Size()
+			hash, blocks, err := hashSyncFile(p, blockSize)
+			if err != nil {
+				return err
+			}
+			entry.Hash = hash
+			entry.Blocks = blocks
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+	sort.Slice(manifest.Entries, func(i, j int) bool {
+		return manifest.Entries[i].Path < manifest.Entries[j].Path
+	})
+	return manifest, nil
+}
+
+func hashSyncFile(p string, blockSize int) (string, []string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	whole := sha256.New()
+	if blockSize <= 0 {
+		if _, err := io.Copy(whole, f); err != nil {
+			return "", nil, err
+		}
+		return hex.EncodeToString(whole.Sum(nil)), nil, nil
+	}
+
+	var blocks []string
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			whole.Write(buf[:n])
+			sum := sha256.Sum256(buf[:n])
+			blocks = append(blocks, hex.EncodeToString(sum[:]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return hex.EncodeToString(whole.Sum(nil)), blocks, nil
+}
+
+// matchSyncExclude reports whether rel (slash separated) is excluded. Each
+// pattern is matched against the full relative path and against its base
+// name; a trailing "/" restricts the pattern to directories.
+func matchSyncExclude(rel string, isDir bool, patterns []string) bool {
+	base := path.Base(rel)
+	for _, raw := range patterns {
+		pattern := strings.TrimSpace(raw)
+		if pattern == "" {
+			continue
+		}
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		pattern = strings.TrimPrefix(pattern, "/")
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveUnderRoot joins a slash separated relative path onto root and
+// rejects anything that would escape it.
+func resolveUnderRoot(root, rel string) (string, error) {
+	clean := strings.TrimSpace(rel)
+	if clean == "" {
+		return "", errors.New("relative path is required")
+	}
+	clean = strings.ReplaceAll(clean, "\\", "/")
+	if path.IsAbs(clean) || filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" {
+		return "", fmt.Errorf("path %q must be relative", rel)
+	}
+	clean = path.Clean(clean)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("path %q escapes target directory", rel)
+	}
+	return filepath.Join(root, filepath.FromSlash(clean)), nil
+}
+
+func syncEntriesByPath(entries []SyncEntry) map[string]SyncEntry {
+	out := make(map[string]SyncEntry, len(entries))
+	for _, e := range entries {
+		out[e.Path] = e
+	}
+	return out
+}
+
+func syncEntryChanged(src SyncEntry, dst SyncEntry, ok bool) bool {
+	if !ok || src.IsDir != dst.IsDir {
+		return true
+	}
+	if src.IsDir {
+		return false
+	}
+	return src.Size != dst.Size || src.Hash != dst.Hash
+}
+
+// changedSyncRanges returns the byte ranges of src that differ from dst when
+// both manifests carry block hashes with the same block size.
+func changedSyncRanges(src, dst SyncEntry, blockSize int) [][2]int64 {
+	if blockSize <= 0 || len(src.Blocks) == 0 {
+		if src.Size == 0 {
+			return nil
+		}
+		return [][2]int64{{0, src.Size}}
+	}
+	var ranges [][2]int64
+	for i, h := range src.Blocks {
+		if i < len(dst.Blocks) && dst.Blocks[i] == h {
+			continue
+		}
+		start := int64(i) * int64(blockSize)
+		end := start + int64(blockSize)
+		if end > src.Size {
+			end = src.Size
+		}
+		if n := len(ranges); n > 0 && ranges[n-1][1] == start {
+			ranges[n-1][1] = end
+			continue
+		}
+		ranges = append(ranges, [2]int64{start, end})
+	}
+	return ranges
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildSyncManifestAppliesExcludes(t *testing.T) {
+	root := t.TempDir()
+	mustWriteFile(t, filepath.Join(root, "a.txt"), "a")
+	mustWriteFile(t, filepath.Join(root, "debug.log"), "log")
+	mustWriteFile(t, filepath.Join(root, "node_modules", "x.js"), "x")
+	mustWriteFile(t, filepath.Join(root, "src", "main.go"), "package main")
+
+	m, err := buildSyncManifest(root, []string{"*.log", "node_modules/"}, 4)
+	if err != nil {
+		t.Fatalf("buildSyncManifest failed: %v", err)
+	}
+	var got []string
+	for _, e := range m.Entries {
+		got = append(got, e.Path)
+	}
+	want := []string{"a.txt", "src", "src/main.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("manifest paths mismatch: got=%v want=%v", got, want)
+	}
+	if len(m.Entries[2].Blocks) != 3 {
+		t.Fatalf("block count mismatch: got=%d want=3", len(m.Entries[2].Blocks))
+	}
+}
+
+func TestBuildSyncManifestMissingRoot(t *testing.T) {
+	m, err := buildSyncManifest(filepath.Join(t.TempDir(), "missing"), nil, 0)
+	if err != nil {
+		t.Fatalf("buildSyncManifest failed: %v", err)
+	}
+	if m.Exists || len(m.Entries) != 0 {
+		t.Fatalf("missing root should be empty: got=%+v", m)
+	}
+}
+
+func TestResolveUnderRootRejectsEscape(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{"../x", "a/../../x", "/etc/passwd", "..", ""} {
+		if _, err := resolveUnderRoot(root, rel); err == nil {
+			t.Fatalf("resolveUnderRoot(%q) should fail", rel)
+		}
+	}
+	got, err := resolveUnderRoot(root, "a/./b")
+	if err != nil {
+		t.Fatalf("resolveUnderRoot failed: %v", err)
+	}
+	if want := filepath.Join(root, "a", "b"); got != want {
+		t.Fatalf("resolveUnderRoot mismatch: got=%s want=%s", got, want)
+	}
+}
+
+func TestChangedSyncRangesMergesAdjacentBlocks(t *testing.T) {
+	src := SyncEntry{Size: 10, Blocks: []string{"a", "B", "C", "d", "E"}}
+	dst := SyncEntry{Size: 8, Blocks: []string{"a", "b", "c", "d"}}
+	got := changedSyncRanges(src, dst, 2)
+	want := [][2]int64{{2, 6}, {8, 10}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("changedSyncRanges mismatch: got=%v want=%v", got, want)
+	}
+}
+
+func mustWriteFile(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+}
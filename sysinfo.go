@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SysInfoResp struct {
+	Hostname        string         `json:"hostname"`
+	OS              SysInfoOS      `json:"os"`
+	CPU             SysInfoCPU     `json:"cpu"`
+	Memory          SysInfoMemory  `json:"memory"`
+	Disks           []SysInfoDisk  `json:"disks"`
+	Interfaces      []SysInfoIface `json:"interfaces"`
+	IPv4Subnets     []string       `json:"ipv4_subnets"`
+	Shells          SysInfoShells  `json:"shells"`
+	User            SysInfoUser    `json:"user"`
+	UptimeSec       int64          `json:"uptime_sec"`
+	Timezone        string         `json:"timezone"`
+	TelehandVersion string         `json:"telehand_version"`
+	Warnings        []string       `json:"warnings,omitempty"`
+}
+
+type SysInfoOS struct {
+	Platform string `json:"platform"`
+	Arch     string `json:"arch"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Kernel   string `json:"kernel"`
+}
+
+type SysInfoCPU struct {
+	Model string `json:"model"`
+	Cores int    `json:"cores"`
+}
+
+type SysInfoMemory struct {
+	Total     int64 `json:"total"`
+	Available int64 `json:"available"`
+}
+
+type SysInfoDisk struct {
+	Mount string `json:"mount"`
+	FS    string `json:"fs"`
+	Total int64  `json:"total"`
+	Free  int64  `json:"free"`
+}
+
+type SysInfoIface struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac,omitempty"`
+	MTU   int      `json:"mtu"`
+	Up    bool     `json:"up"`
+	Addrs []string `json:"addrs"`
+}
+
+type SysInfoShells struct {
+	Default   string   `json:"default"`
+	Available []string `json:"available"`
+}
+
+type SysInfoUser struct {
+	Name    string `json:"name"`
+	UID     string `json:"uid"`
+	Home    string `json:"home"`
+	IsAdmin bool   `json:"is_admin"`
+}
+
+var candidateShells = map[string][]string{
+	"windows": {"powershell", "pwsh", "cmd", "bash"},
+	"darwin":  {"zsh", "bash", "sh", "fish", "pwsh"},
+	"linux":   {"bash", "sh", "zsh", "dash", "fish", "pwsh"},
+}
+
+func (s *APIServer) handleSysInfo(w http.ResponseWriter, r *http.Request) {
+	// The request body is optional; accept an empty POST.
+	var req struct{}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	ctx, cancel := context.WithTimeout(r.Context(), sysInfoCommandTimeout)
+	defer cancel()
+	info := collectSysInfo(ctx)
+	s.addLog("POST", "/sysinfo", info.OS.Name+" "+info.OS.Version)
+	json.NewEncoder(w).Encode(info)
+}
+
+// sysInfoCommandTimeout bounds the external commands /sysinfo runs on
+// macOS and Windows; past it the response carries what was collected so
+// far plus a warning.
+const sysInfoCommandTimeout = 5 * time.Second
+
+func collectSysInfo(ctx context.Context) SysInfoResp {
+	info := SysInfoResp{
+		OS:              SysInfoOS{Platform: runtime.GOOS, Arch: runtime.GOARCH},
+		CPU:             SysInfoCPU{Cores: runtime.NumCPU()},
+		Disks:           []SysInfoDisk{},
+		Interfaces:      []SysInfoIface{},
+		IPv4Subnets:     []string{},
+		TelehandVersion: telehandVersion,
+	}
+	info.Timezone, _ = time.Now().Zone()
+	if tz := time.Local.String(); tz != "" && tz != "Local" {
+		info.Timezone = tz
+	}
+	if host, err := hostnameReader(); err == nil {
+		info.Hostname = host
+	}
+
+	collectPlatformSysInfo(ctx, &info)
+
+	if ifaces, err := net.Interfaces(); err == nil {
+		for _, iface := range ifaces {
+			item := SysInfoIface{
+				Name:  iface.Name,
+				MAC:   iface.HardwareAddr.String(),
+				MTU:   iface.MTU,
+				Up:    iface.Flags&net.FlagUp != 0,
+				Addrs: []string{},
+			}
+			if addrs, err := iface.Addrs(); err == nil {
+				for _, a := range addrs {
+					item.Addrs = append(item.Addrs, a.String())
+				}
+			}
+			info.Interfaces = append(info.Interfaces, item)
+		}
+	} else {
+		info.Warnings = append(info.Warnings, "interfaces: "+err.Error())
+	}
+	if nets, err := collectLocalIPv4Nets(); err == nil {
+		info.IPv4Subnets = normalizeUsedNets(nets)
+	}
+
+	shell, _ := getShell()
+	info.Shells.Default = shell
+	info.Shells.Available = []string{}
+	for _, name := range candidateShells[runtime.GOOS] {
+		if p, err := lookPath(name); err == nil {
+			info.Shells.Available = append(info.Shells.Available, p)
+		}
+	}
+
+	if u, err := user.Current(); err == nil {
+		info.User.Name, info.User.UID, info.User.Home = u.Username, u.Uid, u.HomeDir
+	} else {
+		info.Warnings = append(info.Warnings, "user: "+err.Error())
+	}
+	if runtime.GOOS == "windows" {
+		admin, err := isCurrentUserAdmin()
+		if err != nil {
+			info.Warnings = append(info.Warnings, "is_admin: "+err.Error())
+		}
+		info.User.IsAdmin = admin
+	} else {
+		// isCurrentUserAdmin only gates the Windows preflight; on Unix the
+		// question agents care about is whether commands run as root.
+		info.User.IsAdmin = os.Geteuid() == 0
+	}
+	return info
+}
+
+// parseKeyValueLines parses "KEY<sep>value" lines such as /etc/os-release or
+// /proc/meminfo; surrounding quotes on values are removed.
+func parseKeyValueLines(raw, sep string) map[string]string {
+	out := make(map[string]string)
+	for _, line := range strings.Split(raw, "\n") {
+		key, val, ok := strings.Cut(line, sep)
+		if !ok {
+			continue
+		}
+		val = strings.TrimSpace(val)
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		out[strings.TrimSpace(key)] = val
+	}
+	return out
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseDfOutput parses POSIX `df -kP` output, keeping only block devices.
+func parseDfOutput(raw string) []SysInfoDisk {
+	var out []SysInfoDisk
+	for i, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 6 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		total, err1 := strconv.ParseInt(fields[1], 10, 64)
+		free, err2 := strconv.ParseInt(fields[3], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		out = append(out, SysInfoDisk{
+			Mount: strings.Join(fields[5:], " "),
+			Total: total * 1024,
+			Free:  free * 1024,
+		})
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+//go:build darwin
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func darwinCommandOutput(ctx context.Context, name string, args ...string) string {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	cmd.WaitDelay = execWaitDelay
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func collectPlatformSysInfo(ctx context.Context, info *SysInfoResp) {
+	defer func() {
+		if ctx.Err() != nil {
+			info.Warnings = append(info.Warnings, "commands timed out: "+ctx.Err().Error())
+		}
+	}()
+	info.OS.Name = firstNonEmpty(darwinCommandOutput(ctx, "sw_vers", "-productName"), "macOS")
+	info.OS.Version = darwinCommandOutput(ctx, "sw_vers", "-productVersion")
+	info.OS.Kernel = darwinCommandOutput(ctx, "uname", "-r")
+	info.CPU.Model = darwinCommandOutput(ctx, "sysctl", "-n", "machdep.cpu.brand_string")
+
+	info.Memory.Total, _ = strconv.ParseInt(darwinCommandOutput(ctx, "sysctl", "-n", "hw.memsize"), 10, 64)
+	info.Memory.Available = parseVMStatAvailable(darwinCommandOutput(ctx, "vm_stat"))
+
+	// kern.boottime prints "{ sec = 1700000000, usec = 0 } Tue Nov 14 ...".
+	boot := darwinCommandOutput(ctx, "sysctl", "-n", "kern.boottime")
+	if _, rest, ok := strings.Cut(boot, "sec = "); ok {
+		secStr, _, _ := strings.Cut(rest, ",")
+		if sec, err := strconv.ParseInt(strings.TrimSpace(secStr), 10, 64); err == nil {
+			info.UptimeSec = time.Now().Unix() - sec
+		}
+	}
+
+	df := darwinCommandOutput(ctx, "df", "-kP")
+	if df == "" {
+		info.Warnings = append(info.Warnings, "disks: df failed")
+		return
+	}
+	mountFS := parseDarwinMountFS(darwinCommandOutput(ctx, "mount"))
+	for _, d := range parseDfOutput(df) {
+		d.FS = mountFS[d.Mount]
+		info.Disks = append(info.Disks, d)
+	}
+}
+
+// parseVMStatAvailable estimates available memory like Activity Monitor:
+// free + inactive + speculative pages.
+func parseVMStatAvailable(raw string) int64 {
+	pageSize := int64(4096)
+	if _, rest, ok := strings.Cut(raw, "page size of "); ok {
+		// Truncated output may end right after the marker.
+		if fields := strings.Fields(rest); len(fields) > 0 {
+			if n, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+				pageSize = n
+			}
+		}
+	}
+	kv := parseKeyValueLines(raw, ":")
+	var pages int64
+	for _, key := range []string{"Pages free", "Pages inactive", "Pages speculative"} {
+		n, _ := strconv.ParseInt(strings.TrimSuffix(kv[key], "."), 10, 64)
+		pages += n
+	}
+	return pages * pageSize
+}
+
+// parseDarwinMountFS maps mount point to filesystem type from `mount` lines
+// such as "/dev/disk3s1s1 on / (apfs, sealed, local, read-only)".
+func parseDarwinMountFS(raw string) map[string]string {
+	out := make(map[string]string)
+	for _, line := range strings.Split(raw, "\n") {
+		_, rest, ok := strings.Cut(line, " on ")
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(rest, " (")
+		if i < 0 {
+			continue
+		}
+		fsType, _, _ := strings.Cut(rest[i+2:], ",")
+		out[rest[:i]] = strings.TrimSuffix(fsType, ")")
+	}
+	return out
+}
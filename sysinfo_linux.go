@@ -0,0 +1,90 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Pseudo and container filesystems that say nothing about usable disk space.
+var linuxSkipFS = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true,
+	"cgroup": true, "cgroup2": true, "securityfs": true, "pstore": true, "debugfs": true,
+	"tracefs": true, "configfs": true, "fusectl": true, "mqueue": true, "hugetlbfs": true,
+	"bpf": true, "autofs": true, "binfmt_misc": true, "rpc_pipefs": true, "nsfs": true,
+	"squashfs": true, "overlay": true, "ramfs": true, "efivarfs": true, "selinuxfs": true,
+}
+
+func collectPlatformSysInfo(_ context.Context, info *SysInfoResp) {
+	if raw, err := os.ReadFile("/etc/os-release"); err == nil {
+		kv := parseKeyValueLines(string(raw), "=")
+		info.OS.Name = firstNonEmpty(kv["PRETTY_NAME"], kv["NAME"])
+		info.OS.Version = kv["VERSION_ID"]
+	} else {
+		info.OS.Name = "Linux"
+	}
+	if raw, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		info.OS.Kernel = strings.TrimSpace(string(raw))
+	}
+
+	if raw, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		for _, line := range strings.Split(string(raw), "\n") {
+			key, val, ok := strings.Cut(line, ":")
+			key = strings.TrimSpace(key)
+			if ok && (key == "model name" || key == "Model" || key == "Hardware") {
+				info.CPU.Model = strings.TrimSpace(val)
+				break
+			}
+		}
+	}
+
+	if raw, err := os.ReadFile("/proc/meminfo"); err == nil {
+		kv := parseKeyValueLines(string(raw), ":")
+		info.Memory.Total = parseMeminfoKB(kv["MemTotal"])
+		info.Memory.Available = parseMeminfoKB(kv["MemAvailable"])
+	} else {
+		info.Warnings = append(info.Warnings, "memory: "+err.Error())
+	}
+
+	if raw, err := os.ReadFile("/proc/uptime"); err == nil {
+		if fields := strings.Fields(string(raw)); len(fields) > 0 {
+			up, _ := strconv.ParseFloat(fields[0], 64)
+			info.UptimeSec = int64(up)
+		}
+	}
+
+	raw, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		info.Warnings = append(info.Warnings, "disks: "+err.Error())
+		return
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(raw), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || linuxSkipFS[fields[2]] || seen[fields[0]] {
+			continue
+		}
+		// /proc/mounts escapes spaces in mount points as \040.
+		mount := strings.ReplaceAll(fields[1], `\040`, " ")
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(mount, &st); err != nil || st.Blocks == 0 {
+			continue
+		}
+		seen[fields[0]] = true
+		info.Disks = append(info.Disks, SysInfoDisk{
+			Mount: mount,
+			FS:    fields[2],
+			Total: int64(st.Blocks) * int64(st.Bsize),
+			Free:  int64(st.Bavail) * int64(st.Bsize),
+		})
+	}
+}
+
+func parseMeminfoKB(v string) int64 {
+	n, _ := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), "kB")), 10, 64)
+	return n * 1024
+}
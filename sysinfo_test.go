@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseDfOutputKeepsBlockDevices(t *testing.T) {
+	raw := `Filesystem     1024-blocks      Used Available Capacity Mounted on
+/dev/disk3s1s1   482797652  10264544 297395868     4%    /
+devfs                  205       205         0   100%    /dev
+/dev/disk5s1        102400     51200     51200    50%    /Volumes/My Disk`
+	got := parseDfOutput(raw)
+	want := []SysInfoDisk{
+		{Mount: "/", Total: 482797652 * 1024, Free: 297395868 * 1024},
+		{Mount: "/Volumes/My Disk", Total: 102400 * 1024, Free: 51200 * 1024},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseDfOutput mismatch: got=%+v want=%+v", got, want)
+	}
+}
+
+func TestParseKeyValueLinesStripsQuotes(t *testing.T) {
+	got := parseKeyValueLines("NAME=\"Ubuntu\"\nVERSION_ID='22.04'\nID=ubuntu\n# comment", "=")
+	if got["NAME"] != "Ubuntu" || got["VERSION_ID"] != "22.04" || got["ID"] != "ubuntu" {
+		t.Fatalf("parseKeyValueLines mismatch: got=%v", got)
+	}
+}
+
+func TestAPISysInfo(t *testing.T) {
+	s := NewAPIServer("127.0.0.1", 20280, nil, nil, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start api server failed: %v", err)
+	}
+	defer s.Stop()
+	client := &http.Client{Timeout: 8 * time.Second}
+
+	status, out := callRaw(t, client, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/sysinfo", s.Port()), map[string]any{})
+	var info SysInfoResp
+	if err := json.Unmarshal(out, &info); err != nil {
+		t.Fatalf("decode sysinfo failed: %v body=%s", err, out)
+	}
+	if status != http.StatusOK || info.OS.Platform != runtime.GOOS || info.OS.Arch != runtime.GOARCH || info.CPU.Cores <= 0 {
+		t.Fatalf("sysinfo mismatch: status=%d body=%s", status, out)
+	}
+	if info.TelehandVersion != telehandVersion || info.Shells.Default == "" || len(info.Interfaces) == 0 {
+		t.Fatalf("sysinfo missing fields: body=%s", out)
+	}
+	if runtime.GOOS == "linux" && (info.Memory.Total <= 0 || info.OS.Kernel == "") {
+		t.Fatalf("linux sysinfo missing memory/kernel: body=%s", out)
+	}
+}
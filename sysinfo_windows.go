@@ -0,0 +1,56 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+)
+
+const windowsSysInfoScript = `$ErrorActionPreference='SilentlyContinue';` +
+	`$os=Get-CimInstance Win32_OperatingSystem;$cpu=Get-CimInstance Win32_Processor | Select-Object -First 1;` +
+	`$disks=@(Get-CimInstance Win32_LogicalDisk -Filter 'DriveType=3' | ForEach-Object {[pscustomobject]@{mount=[string]$_.DeviceID+'\';fs=[string]$_.FileSystem;total=[int64]$_.Size;free=[int64]$_.FreeSpace}});` +
+	`[pscustomobject]@{name=[string]$os.Caption;version=[string]$os.Version;build=[string]$os.BuildNumber;` +
+	`cpu=[string]$cpu.Name;mem_total=[int64]$os.TotalVisibleMemorySize*1024;mem_free=[int64]$os.FreePhysicalMemory*1024;` +
+	`uptime=[int64]((Get-Date)-$os.LastBootUpTime).TotalSeconds;disks=$disks} | ConvertTo-Json -Compress -Depth 3`
+
+type windowsSysInfoRow struct {
+	Name     string        `json:"name"`
+	Version  string        `json:"version"`
+	Build    string        `json:"build"`
+	CPU      string        `json:"cpu"`
+	MemTotal int64         `json:"mem_total"`
+	MemFree  int64         `json:"mem_free"`
+	Uptime   int64         `json:"uptime"`
+	Disks    []SysInfoDisk `json:"disks"`
+}
+
+func collectPlatformSysInfo(ctx context.Context, info *SysInfoResp) {
+	info.OS.Name = "Windows"
+	cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-Command", windowsSysInfoScript)
+	cmd.WaitDelay = execWaitDelay
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		info.Warnings = append(info.Warnings, "Get-CimInstance timed out: "+ctx.Err().Error())
+		return
+	}
+	if err != nil {
+		info.Warnings = append(info.Warnings, "Get-CimInstance failed: "+err.Error())
+		return
+	}
+	var row windowsSysInfoRow
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(out))), &row); err != nil {
+		info.Warnings = append(info.Warnings, "parse sysinfo failed: "+err.Error())
+		return
+	}
+	info.OS.Name = firstNonEmpty(row.Name, "Windows")
+	info.OS.Version = row.Version
+	info.OS.Kernel = row.Build
+	info.CPU.Model = strings.TrimSpace(row.CPU)
+	info.Memory.Total = row.MemTotal
+	info.Memory.Available = row.MemFree
+	info.UptimeSec = row.Uptime
+	info.Disks = append(info.Disks, row.Disks...)
+}